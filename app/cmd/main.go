@@ -10,8 +10,13 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/aorticweb/msg-app/app/config"
 	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/events"
 	api "github.com/aorticweb/msg-app/app/handlers"
+	"github.com/aorticweb/msg-app/app/jobs"
+	"github.com/aorticweb/msg-app/app/storage"
+	"gorm.io/gorm"
 )
 
 var dbConnectionWaitTime time.Duration = 5 * time.Minute
@@ -24,10 +29,16 @@ func registerKillSwitch() chan os.Signal {
 	return shutdown
 }
 
-func gracefullyShutdown(server *http.Server) error {
+func gracefullyShutdown(server *http.Server, API *api.API, runner *jobs.Runner) error {
 	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer cancel()
 
+	if err := runner.Stop(ctx); err != nil {
+		log.Printf("Background jobs did not stop in %v: %v\n", shutdownTimeout, err)
+	}
+	if err := API.Shutdown(ctx); err != nil {
+		log.Printf("Event streams did not close in %v: %v\n", shutdownTimeout, err)
+	}
 	err := server.Shutdown(ctx)
 	if err == nil {
 		return nil
@@ -41,9 +52,20 @@ func gracefullyShutdown(server *http.Server) error {
 	return nil
 }
 
-func waitForKillSwitch(kill chan os.Signal, server *http.Server) {
+func waitForKillSwitch(kill chan os.Signal, server *http.Server, API *api.API, runner *jobs.Runner) {
 	<-kill
-	gracefullyShutdown(server)
+	gracefullyShutdown(server, API, runner)
+}
+
+func startJobs(db *gorm.DB, cfg config.Config, blobs storage.BlobStore, bus events.Bus, logger *log.Logger) *jobs.Runner {
+	runner := jobs.NewRunner(logger)
+	runner.Every("trash purge", cfg.PurgeInterval, jobs.TrashPurge(db, blobs, cfg.TrashRetention))
+	runner.Every("scheduled delivery", cfg.ScheduleInterval, jobs.ScheduledDelivery(db, bus))
+	runner.Every("expiry sweep", cfg.ExpiryInterval, jobs.ExpirySweep(db, blobs))
+	runner.Every("event purge", cfg.PurgeInterval, jobs.EventPurge(db, cfg.EventRetention))
+	runner.Every("webhook log purge", cfg.PurgeInterval, jobs.WebhookLogPurge(db, cfg.WebhookLogRetention))
+	runner.Every("webhook delivery", cfg.WebhookInterval, jobs.WebhookDelivery(db, cfg.Admins, cfg.WebhookTimeout, cfg.WebhookAllowPrivate))
+	return runner
 }
 
 func setupServer(logger *log.Logger) (*http.Server, error) {
@@ -52,15 +74,32 @@ func setupServer(logger *log.Logger) (*http.Server, error) {
 		logger.Println("Failed to fetch database connection")
 		return nil, err
 	}
+	cfg, err := config.FromEnv()
+	if err != nil {
+		logger.Println("Failed to read configuration")
+		return nil, err
+	}
+	blobs, err := config.NewBlobStore(cfg)
+	if err != nil {
+		logger.Println("Failed to set up the blob store")
+		return nil, err
+	}
+	bus, err := events.NewPostgresBus(context.Background(), db, logger)
+	if err != nil {
+		logger.Println("Failed to listen for events")
+		return nil, err
+	}
 	killSwitch := registerKillSwitch()
-	API := api.NewAPI(db, logger)
+	API := api.NewAPI(db, logger, cfg, blobs, bus)
+	runner := startJobs(db, cfg, blobs, bus, logger)
+	// the mailbox streams hijack their connection and set their own deadlines, they are not cut by WriteTimeout
 	server := http.Server{
 		Addr:         serverListenAddr,
 		Handler:      API,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 	}
-	go waitForKillSwitch(killSwitch, &server)
+	go waitForKillSwitch(killSwitch, &server, API, runner)
 	return &server, nil
 }
 
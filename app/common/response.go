@@ -7,14 +7,21 @@ type APIResponse struct {
 	Data    interface{}
 	Message string
 	Err     error
+	// Written ... the handler already wrote the response body, e.g. a file download
+	Written bool
 }
 
 func NewBadResponse(code int, message string, err error) *APIResponse {
-	return &APIResponse{code, nil, message, err}
+	return &APIResponse{code, nil, message, err, false}
 }
 
 func NewGoodResponse(code int, data interface{}) *APIResponse {
-	return &APIResponse{code, data, "", nil}
+	return &APIResponse{code, data, "", nil, false}
+}
+
+// NewWrittenResponse ... for handlers that wrote the response themselves, only logged by the middleware
+func NewWrittenResponse(code int, err error) *APIResponse {
+	return &APIResponse{code, nil, "", err, true}
 }
 
 var InvalidRequestResponse APIResponse = *NewBadResponse(http.StatusBadRequest, "invalid request", nil)
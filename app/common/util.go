@@ -18,6 +18,15 @@ func GetIDFromRequest(r *http.Request) (int64, error) {
 	return strconv.ParseInt(id, 10, 64)
 }
 
+func GetAttachmentIDFromRequest(r *http.Request) (int64, error) {
+	vars := mux.Vars(r)
+	id, ok := vars["attachment"]
+	if !ok {
+		return 0, errors.New("attachment id not found in request")
+	}
+	return strconv.ParseInt(id, 10, 64)
+}
+
 func GetUsernameFromRequest(r *http.Request) (string, error) {
 	vars := mux.Vars(r)
 	username, ok := vars["username"]
@@ -27,6 +36,15 @@ func GetUsernameFromRequest(r *http.Request) (string, error) {
 	return username, nil
 }
 
+func GetGroupnameFromRequest(r *http.Request) (string, error) {
+	vars := mux.Vars(r)
+	groupname, ok := vars["groupname"]
+	if !ok {
+		return "", errors.New("groupname not found in request")
+	}
+	return groupname, nil
+}
+
 func WrapError(context string, e error) error {
 	return fmt.Errorf("%s: %s", context, e)
 }
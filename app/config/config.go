@@ -0,0 +1,191 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aorticweb/msg-app/app/storage"
+)
+
+const (
+	BlobStoreLocal = "local"
+	BlobStoreS3    = "s3"
+)
+
+// Config ... settings of the api and its background jobs, read from the environment
+type Config struct {
+	// DeleteWindow ... how long after sending a message its sender can delete it for everyone
+	DeleteWindow time.Duration
+	// EditWindow ... how long after sending a message its sender can edit it
+	EditWindow time.Duration
+	// TrashRetention ... how long deleted messages can be restored before being purged
+	TrashRetention time.Duration
+	// PurgeInterval ... how often the trash purge runs
+	PurgeInterval time.Duration
+	// ScheduleInterval ... how often messages scheduled for later are checked for delivery
+	ScheduleInterval time.Duration
+	// ExpiryInterval ... how often expired messages are deleted
+	ExpiryInterval time.Duration
+	// EventRetention ... how long mailbox events can be replayed by a reconnecting stream
+	EventRetention time.Duration
+	// WebhookInterval ... how often queued webhook deliveries are sent
+	WebhookInterval time.Duration
+	// WebhookTimeout ... how long a webhook receiver has to answer
+	WebhookTimeout time.Duration
+	// WebhookLogRetention ... how long the deliveries done stay in the delivery log of their webhook
+	WebhookLogRetention time.Duration
+	// WebhookAllowPrivate ... let webhooks target loopback, private and link-local addresses, for local development
+	WebhookAllowPrivate bool
+	// Admins ... usernames allowed to manage global webhooks
+	Admins []string
+	// IncomingWebhookRate ... messages an incoming webhook token can post per minute
+	IncomingWebhookRate int
+
+	// BlobStore ... where attachments are stored, local or s3
+	BlobStore string
+	// BlobDir ... root directory of the local blob store
+	BlobDir string
+	S3      storage.S3Config
+	// AttachmentMaxSize ... in bytes
+	AttachmentMaxSize int64
+	// AttachmentTypes ... accepted media types, detected from the content of the upload
+	AttachmentTypes []string
+}
+
+func Default() Config {
+	return Config{
+		DeleteWindow:        time.Hour,
+		EditWindow:          15 * time.Minute,
+		TrashRetention:      30 * 24 * time.Hour,
+		PurgeInterval:       time.Hour,
+		ScheduleInterval:    10 * time.Second,
+		ExpiryInterval:      time.Minute,
+		EventRetention:      24 * time.Hour,
+		WebhookInterval:     5 * time.Second,
+		WebhookTimeout:      10 * time.Second,
+		WebhookLogRetention: 7 * 24 * time.Hour,
+		IncomingWebhookRate: 30,
+		BlobStore:           BlobStoreLocal,
+		BlobDir:             "data/attachments",
+		AttachmentMaxSize:   10 << 20,
+		AttachmentTypes:     []string{"application/pdf", "application/zip", "image/gif", "image/jpeg", "image/png", "image/webp", "text/plain"},
+	}
+}
+
+// durationFromEnv ... set *d from env variable name when it is set
+func durationFromEnv(name string, d *time.Duration) error {
+	value, exist := os.LookupEnv(name)
+	if !exist {
+		return nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		return fmt.Errorf("Env variable %s must be a positive duration, got %q", name, value)
+	}
+	*d = parsed
+	return nil
+}
+
+func sizeFromEnv(name string, size *int64) error {
+	value, exist := os.LookupEnv(name)
+	if !exist {
+		return nil
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || parsed <= 0 {
+		return fmt.Errorf("Env variable %s must be a positive number of bytes, got %q", name, value)
+	}
+	*size = parsed
+	return nil
+}
+
+func countFromEnv(name string, n *int) error {
+	value, exist := os.LookupEnv(name)
+	if !exist {
+		return nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed <= 0 {
+		return fmt.Errorf("Env variable %s must be a positive number, got %q", name, value)
+	}
+	*n = parsed
+	return nil
+}
+
+func boolFromEnv(name string, b *bool) error {
+	value, exist := os.LookupEnv(name)
+	if !exist {
+		return nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("Env variable %s must be a boolean, got %q", name, value)
+	}
+	*b = parsed
+	return nil
+}
+
+func stringFromEnv(name string, s *string) {
+	if value, exist := os.LookupEnv(name); exist {
+		*s = value
+	}
+}
+
+// FromEnv ... Default overridden by the MSG_* env variables
+func FromEnv() (Config, error) {
+	cfg := Default()
+	durations := map[string]*time.Duration{
+		"MSG_DELETE_WINDOW":         &cfg.DeleteWindow,
+		"MSG_EDIT_WINDOW":           &cfg.EditWindow,
+		"MSG_TRASH_RETENTION":       &cfg.TrashRetention,
+		"MSG_PURGE_INTERVAL":        &cfg.PurgeInterval,
+		"MSG_SCHEDULE_INTERVAL":     &cfg.ScheduleInterval,
+		"MSG_EXPIRY_INTERVAL":       &cfg.ExpiryInterval,
+		"MSG_EVENT_RETENTION":       &cfg.EventRetention,
+		"MSG_WEBHOOK_INTERVAL":      &cfg.WebhookInterval,
+		"MSG_WEBHOOK_TIMEOUT":       &cfg.WebhookTimeout,
+		"MSG_WEBHOOK_LOG_RETENTION": &cfg.WebhookLogRetention,
+	}
+	for name, d := range durations {
+		if err := durationFromEnv(name, d); err != nil {
+			return cfg, err
+		}
+	}
+	if err := sizeFromEnv("MSG_ATTACHMENT_MAX_SIZE", &cfg.AttachmentMaxSize); err != nil {
+		return cfg, err
+	}
+	if err := countFromEnv("MSG_INCOMING_WEBHOOK_RATE", &cfg.IncomingWebhookRate); err != nil {
+		return cfg, err
+	}
+	if err := boolFromEnv("MSG_WEBHOOK_ALLOW_PRIVATE", &cfg.WebhookAllowPrivate); err != nil {
+		return cfg, err
+	}
+	if types, exist := os.LookupEnv("MSG_ATTACHMENT_TYPES"); exist {
+		cfg.AttachmentTypes = strings.Split(types, ",")
+	}
+	if admins, exist := os.LookupEnv("MSG_ADMINS"); exist && admins != "" {
+		cfg.Admins = strings.Split(admins, ",")
+	}
+	stringFromEnv("MSG_BLOB_STORE", &cfg.BlobStore)
+	stringFromEnv("MSG_BLOB_DIR", &cfg.BlobDir)
+	stringFromEnv("MSG_S3_ENDPOINT", &cfg.S3.Endpoint)
+	stringFromEnv("MSG_S3_BUCKET", &cfg.S3.Bucket)
+	stringFromEnv("MSG_S3_REGION", &cfg.S3.Region)
+	stringFromEnv("MSG_S3_ACCESS_KEY", &cfg.S3.AccessKey)
+	stringFromEnv("MSG_S3_SECRET_KEY", &cfg.S3.SecretKey)
+	if cfg.BlobStore != BlobStoreLocal && cfg.BlobStore != BlobStoreS3 {
+		return cfg, fmt.Errorf("Env variable MSG_BLOB_STORE must be %s or %s, got %q", BlobStoreLocal, BlobStoreS3, cfg.BlobStore)
+	}
+	return cfg, nil
+}
+
+// NewBlobStore ... blob store selected by cfg
+func NewBlobStore(cfg Config) (storage.BlobStore, error) {
+	if cfg.BlobStore == BlobStoreS3 {
+		return storage.NewS3Store(cfg.S3, nil)
+	}
+	return storage.NewLocalStore(cfg.BlobDir)
+}
@@ -0,0 +1,78 @@
+package crud
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Attachment ... file attached to a message, its content lives in the blob store under StorageKey
+type Attachment struct {
+	ID          int64     `gorm:"column:id;type:bigserial;primary_key"`
+	MessageID   int64     `gorm:"column:message_id;integer"`
+	Filename    string    `gorm:"column:filename;type:text"`
+	ContentType string    `gorm:"column:content_type;type:text"`
+	Size        int64     `gorm:"column:size;type:bigint"`
+	SHA256      string    `gorm:"column:sha256;type:char(64)"`
+	StorageKey  string    `gorm:"column:storage_key;type:text;unique"`
+	CreatedAt   time.Time `gorm:"column:created_at;type:timestamp with time zone"`
+}
+
+func (a *Attachment) TableName() string {
+	return "public.attachment"
+}
+
+// NewAttachmentKey ... random blob key of a new attachment of message
+func NewAttachmentKey(messageID int64) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("attachments/%d/%s", messageID, hex.EncodeToString(b)), nil
+}
+
+// CreateAttachment ... attach to a message that is still scheduled, ErrNotScheduled is returned once it was
+// delivered. The message is locked so that it is not delivered meanwhile, its readers get it with the attachment
+func CreateAttachment(db *gorm.DB, attachment *Attachment) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var ids []int64
+		err := tx.Model(&Message{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("message.id = ? and message.send_at is not null", attachment.MessageID).Pluck("message.id", &ids).Error
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return ErrNotScheduled
+		}
+		return tx.Create(attachment).Error
+	})
+}
+
+func GetAttachment(db *gorm.DB, messageID int64, attachmentID int64) (*Attachment, bool, error) {
+	var attachment Attachment
+	err := db.Where("message_id = ? and id = ?", messageID, attachmentID).First(&attachment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &attachment, true, nil
+}
+
+// GetPurgedAttachments ... attachments of purged messages, up to limit
+func GetPurgedAttachments(db *gorm.DB, limit int) ([]Attachment, error) {
+	var attachments []Attachment
+	purged := db.Session(&gorm.Session{NewDB: true}).Model(&Message{}).Select("message.id").Where("message.purged_at is not null")
+	err := db.Where("message_id in (?)", purged).Order("id").Limit(limit).Find(&attachments).Error
+	return attachments, err
+}
+
+func DeleteAttachment(db *gorm.DB, attachment *Attachment) error {
+	return db.Delete(attachment).Error
+}
@@ -0,0 +1,77 @@
+package crud
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type AuthToken struct {
+	ID        int64     `gorm:"column:id;type:bigserial;primary_key"`
+	TokenHash string    `gorm:"column:token_hash;type:char(64);unique"`
+	UserID    int64     `gorm:"column:user_id;integer"`
+	User      User      `gorm:"foreignKey:user_id"`
+	CreatedAt time.Time `gorm:"column:created_at;type:timestamp with time zone"`
+	ExpiresAt time.Time `gorm:"column:expires_at;type:timestamp with time zone"`
+}
+
+func (t *AuthToken) TableName() string {
+	return "public.auth_token"
+}
+
+// hashToken ... only the sha256 of a token is stored, the token itself is handed to the client
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CreateAuthToken ... issue a new bearer token for user valid for ttl
+func CreateAuthToken(db *gorm.DB, userID int64, ttl time.Duration) (string, *AuthToken, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now().UTC()
+	authToken := AuthToken{
+		TokenHash: hashToken(token),
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return tx.Create(&authToken).Error
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return token, &authToken, nil
+}
+
+// FindUserByToken ... user owning a non expired token
+func FindUserByToken(db *gorm.DB, token string) (*User, bool, error) {
+	var authToken AuthToken
+	err := db.Preload("User").Where("token_hash = ? and expires_at > ?", hashToken(token), time.Now().UTC()).First(&authToken).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &authToken.User, true, nil
+}
+
+func DeleteAuthToken(db *gorm.DB, token string) error {
+	return db.Where("token_hash = ?", hashToken(token)).Delete(&AuthToken{}).Error
+}
@@ -0,0 +1,113 @@
+package crud
+
+import (
+	"gorm.io/gorm"
+)
+
+// threadKeySQL ... thread a message belongs to, messages whose root is gone form their own thread
+const threadKeySQL = "coalesce(message.thread_id, message.id)"
+
+// Conversation ... summary of a thread from the point of view of one user,
+// only the messages they can read and did not delete are counted
+type Conversation struct {
+	ThreadID     int64
+	Latest       Message
+	Participants []string
+	MessageCount int64
+	UnreadCount  int64
+}
+
+// participantSQL ... users a message is addressed to, the members of its groups included, bcc recipients
+// are not disclosed
+const participantSQL = "select coalesce(message_recipient.user_id, user_group.user_id) from public.message_recipient " +
+	"left join public.user_group on user_group.group_id = message_recipient.group_id " +
+	"where message_recipient.message_id = message.id and message_recipient.role <> 'bcc' " +
+	"and coalesce(message_recipient.user_id, user_group.user_id) is not null"
+
+type conversationStats struct {
+	ThreadID     int64 `gorm:"column:thread_id"`
+	MessageCount int64 `gorm:"column:message_count"`
+	UnreadCount  int64 `gorm:"column:unread_count"`
+}
+
+type conversationParticipant struct {
+	ThreadID int64  `gorm:"column:thread_id"`
+	Username string `gorm:"column:username"`
+}
+
+// GetUserConversations ... mailbox of user grouped by thread, a thread is listed when one of the
+// messages user received in it matches filter. Conversations are paged on their latest message
+func GetUserConversations(db *gorm.DB, userID int64, filter MailboxFilter, page Page) ([]Conversation, *Cursor, error) {
+	newDB := db.Session(&gorm.Session{NewDB: true})
+	threads := newDB.Model(&Message{}).Select(threadKeySQL).Scopes(receivedBy(userID), notDeleted(userID), filter.filter(userID))
+	mailbox := func() *gorm.DB {
+		return newDB.Model(&Message{}).Select("message.id, message.sent_at, "+threadKeySQL+" as thread_id").
+			Scopes(visibleTo(userID), notDeleted(userID))
+	}
+	// the latest message of a thread is the one without a newer message in the thread, the page
+	// is walked in sent order from the cursor instead of finding the latest message of every thread
+	newer := newDB.Table("(?) as newer", mailbox()).Select("1").
+		Where("newer.thread_id = latest.thread_id and (newer.sent_at, newer.id) > (latest.sent_at, latest.id)")
+	latest := newDB.Table("(?) as latest", mailbox()).Select("latest.id").
+		Where("latest.thread_id in (?) and not exists (?)", threads, newer).
+		Scopes(paginateOn("latest", "sent_at", page))
+
+	var msgs []Message
+	query := db.Scopes(withParticipants, WithReadState(userID))
+	err := query.Where("message.id in (?)", latest).Scopes(paginate(page)).Find(&msgs).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	msgs, next := nextPage(msgs, page)
+	if len(msgs) == 0 {
+		return []Conversation{}, next, nil
+	}
+
+	var threadIDs []int64
+	for _, msg := range msgs {
+		threadIDs = append(threadIDs, threadOf(&msg))
+	}
+	var stats []conversationStats
+	err = db.Model(&Message{}).
+		Select(threadKeySQL+" as thread_id, count(*) as message_count, count(*) filter (where message.sender_id <> ? and message_state.read_at is null) as unread_count", userID).
+		Joins("left join public.message_state on message_state.message_id = message.id and message_state.user_id = ?", userID).
+		Scopes(visibleTo(userID), notDeleted(userID)).Where(threadKeySQL+" in ?", threadIDs).
+		Group(threadKeySQL).Scan(&stats).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	var participants []conversationParticipant
+	err = db.Model(&Message{}).
+		Select("distinct "+threadKeySQL+` as thread_id, "user".username`).
+		Joins(`join public.user on "user".id = message.sender_id or "user".id in (`+participantSQL+`)`).
+		Scopes(visibleTo(userID), notDeleted(userID)).Where(threadKeySQL+" in ?", threadIDs).
+		Order(`"user".username`).Scan(&participants).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conversations := []Conversation{}
+	byThread := map[int64]*Conversation{}
+	for _, msg := range msgs {
+		conversations = append(conversations, Conversation{ThreadID: threadOf(&msg), Latest: msg, Participants: []string{}})
+	}
+	for i := range conversations {
+		byThread[conversations[i].ThreadID] = &conversations[i]
+	}
+	for _, s := range stats {
+		byThread[s.ThreadID].MessageCount = s.MessageCount
+		byThread[s.ThreadID].UnreadCount = s.UnreadCount
+	}
+	for _, p := range participants {
+		conversation := byThread[p.ThreadID]
+		conversation.Participants = append(conversation.Participants, p.Username)
+	}
+	return conversations, next, nil
+}
+
+func threadOf(msg *Message) int64 {
+	if msg.ThreadID != nil {
+		return *msg.ThreadID
+	}
+	return msg.ID
+}
@@ -0,0 +1,112 @@
+package crud
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrDraftChanged ... the draft was updated, sent or deleted while it was being sent
+var ErrDraftChanged = errors.New("draft changed")
+
+// DraftRecipients ... recipients as entered, they are only resolved when the draft is sent
+type DraftRecipients struct {
+	Recipient map[string]string   `json:"recipient,omitempty"`
+	To        []map[string]string `json:"to,omitempty"`
+	Cc        []map[string]string `json:"cc,omitempty"`
+	Bcc       []map[string]string `json:"bcc,omitempty"`
+}
+
+func (r DraftRecipients) Value() (driver.Value, error) {
+	return json.Marshal(r)
+}
+
+func (r *DraftRecipients) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, r)
+	case string:
+		return json.Unmarshal([]byte(v), r)
+	default:
+		return fmt.Errorf("cannot scan %T into draft recipients", value)
+	}
+}
+
+// Draft ... message being composed by its owner, every field may be incomplete
+type Draft struct {
+	ID         int64           `gorm:"column:id;type:bigserial;primary_key"`
+	OwnerID    int64           `gorm:"column:owner_id;integer"`
+	Subject    string          `gorm:"column:subject;type:text"`
+	Body       string          `gorm:"column:body;type:text"`
+	Recipients DraftRecipients `gorm:"column:recipients;type:jsonb"`
+	CreatedAt  time.Time       `gorm:"column:created_at;type:timestamp with time zone"`
+	UpdatedAt  time.Time       `gorm:"column:updated_at;type:timestamp with time zone"`
+}
+
+func (d *Draft) TableName() string {
+	return "public.draft"
+}
+
+func CreateDraft(db *gorm.DB, draft *Draft) error {
+	return db.Create(draft).Error
+}
+
+// GetDraft ... draft of owner, drafts of other users do not exist for them
+func GetDraft(db *gorm.DB, ownerID int64, draftID int64) (*Draft, bool, error) {
+	var draft Draft
+	err := db.Where("owner_id = ? and id = ?", ownerID, draftID).First(&draft).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &draft, true, nil
+}
+
+// GetUserDrafts ... drafts of owner, last updated first unless page is ascending
+func GetUserDrafts(db *gorm.DB, ownerID int64, page Page) ([]Draft, *Cursor, error) {
+	drafts := []Draft{}
+	err := db.Where("draft.owner_id = ?", ownerID).Scopes(paginateOn("draft", "updated_at", page)).Find(&drafts).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(drafts) <= page.Limit {
+		return drafts, nil, nil
+	}
+	drafts = drafts[:page.Limit]
+	last := drafts[len(drafts)-1]
+	return drafts, &Cursor{SentAt: last.UpdatedAt, ID: last.ID}, nil
+}
+
+func UpdateDraft(db *gorm.DB, draft *Draft) error {
+	return db.Save(draft).Error
+}
+
+func DeleteDraft(db *gorm.DB, draft *Draft) error {
+	return db.Delete(draft).Error
+}
+
+// SendDraft ... create message and delete draft in one transaction. The draft is only
+// deleted if it was not updated since it was read, otherwise ErrDraftChanged is returned
+// and nothing is sent
+func SendDraft(db *gorm.DB, draft *Draft, message *Message) (*Message, error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("owner_id = ? and updated_at = ?", draft.OwnerID, draft.UpdatedAt).Delete(draft)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrDraftChanged
+		}
+		if err := tx.Create(message).Error; err != nil {
+			return err
+		}
+		return queueCreatedMessage(tx, message)
+	})
+	return message, err
+}
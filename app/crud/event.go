@@ -0,0 +1,100 @@
+package crud
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/aorticweb/msg-app/app/events"
+	"gorm.io/gorm"
+)
+
+// MailboxEvent ... change to the mailbox of a user, kept for a while so that streams can
+// replay what a reconnecting client missed. MessageID is not a foreign key, events outlive
+// the messages they are about
+type MailboxEvent struct {
+	ID        int64     `gorm:"column:id;type:bigserial;primary_key"`
+	UserID    int64     `gorm:"column:user_id;integer"`
+	Kind      string    `gorm:"column:kind;text"`
+	MessageID *int64    `gorm:"column:message_id;bigint"`
+	CreatedAt time.Time `gorm:"column:created_at;type:timestamp with time zone"`
+}
+
+func (e *MailboxEvent) TableName() string {
+	return "public.mailbox_event"
+}
+
+// CreateMailboxEvents ... store events and fill their ids, which grow with time
+func CreateMailboxEvents(db *gorm.DB, published []events.Event) error {
+	if len(published) == 0 {
+		return nil
+	}
+	now := time.Now().UTC()
+	dbEvents := make([]MailboxEvent, 0, len(published))
+	for _, event := range published {
+		dbEvent := MailboxEvent{UserID: event.UserID, Kind: event.Kind, CreatedAt: now}
+		if event.MessageID != 0 {
+			messageID := event.MessageID
+			dbEvent.MessageID = &messageID
+		}
+		dbEvents = append(dbEvents, dbEvent)
+	}
+	if err := db.Create(&dbEvents).Error; err != nil {
+		return err
+	}
+	for i := range published {
+		published[i].ID = dbEvents[i].ID
+	}
+	return nil
+}
+
+// PublishEvents ... store published for the streams to replay then send them on bus
+func PublishEvents(ctx context.Context, db *gorm.DB, bus events.Bus, published []events.Event) error {
+	if len(published) == 0 {
+		return nil
+	}
+	if err := CreateMailboxEvents(db.WithContext(ctx), published); err != nil {
+		return err
+	}
+	return bus.Publish(ctx, published...)
+}
+
+// deliveredSQL ... a message or reply event for every reader of the messages in @messages
+const deliveredSQL = `select readers.user_id, readers.message_id,
+case when message.re_id is null then @message else @reply end as kind
+from (
+	select message_recipient.message_id, message_recipient.user_id from public.message_recipient
+	where message_recipient.message_id in @messages and message_recipient.user_id is not null
+	union
+	select message_recipient.message_id, user_group.user_id from public.message_recipient
+	join public.user_group on user_group.group_id = message_recipient.group_id
+	where message_recipient.message_id in @messages
+) readers join public.message on message.id = readers.message_id
+order by readers.message_id, readers.user_id`
+
+// DeliveredEvents ... events telling the readers of messageIDs about them, each reader once per message
+func DeliveredEvents(db *gorm.DB, messageIDs []int64) ([]events.Event, error) {
+	delivered := []events.Event{}
+	if len(messageIDs) == 0 {
+		return delivered, nil
+	}
+	err := db.Raw(deliveredSQL,
+		sql.Named("messages", messageIDs),
+		sql.Named("message", events.KindMessage),
+		sql.Named("reply", events.KindReply),
+	).Scan(&delivered).Error
+	return delivered, err
+}
+
+// GetMailboxEvents ... up to limit events of user following afterID, oldest first
+func GetMailboxEvents(db *gorm.DB, userID int64, afterID int64, limit int) ([]MailboxEvent, error) {
+	events := []MailboxEvent{}
+	err := db.Where("user_id = ? and id > ?", userID, afterID).Order("id").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+// PurgeMailboxEvents ... delete the events created before cutoff, returns how many were deleted
+func PurgeMailboxEvents(db *gorm.DB, cutoff time.Time) (int64, error) {
+	result := db.Where("created_at < ?", cutoff).Delete(&MailboxEvent{})
+	return result.RowsAffected, result.Error
+}
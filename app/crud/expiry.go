@@ -0,0 +1,27 @@
+package crud
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// GetExpiredMessages ... ids of up to limit messages expired at now
+func GetExpiredMessages(db *gorm.DB, now time.Time, limit int) ([]int64, error) {
+	ids := []int64{}
+	err := db.Model(&Message{}).Where("message.expires_at <= ?", now).Order("message.expires_at").Limit(limit).Pluck("message.id", &ids).Error
+	return ids, err
+}
+
+// GetMessagesAttachments ... attachments of every message in messageIDs
+func GetMessagesAttachments(db *gorm.DB, messageIDs []int64) ([]Attachment, error) {
+	attachments := []Attachment{}
+	err := db.Where("message_id in ?", messageIDs).Order("id").Find(&attachments).Error
+	return attachments, err
+}
+
+// DeleteMessages ... hard delete messageIDs, their recipients, read states, revisions and attachment
+// rows go with them. Replies and forwards stay and lose their link to the deleted messages
+func DeleteMessages(db *gorm.DB, messageIDs []int64) error {
+	return db.Where("message.id in ?", messageIDs).Delete(&Message{}).Error
+}
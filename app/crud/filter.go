@@ -0,0 +1,70 @@
+package crud
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	MailboxKindGroup  = "group"
+	MailboxKindDirect = "direct"
+)
+
+// MailboxFilter ... optional mailbox criteria, zero values are ignored
+type MailboxFilter struct {
+	Sender     string
+	Kind       string
+	Since      *time.Time
+	Until      *time.Time
+	UnreadOnly bool
+	HasReplies *bool
+	Subject    string
+}
+
+// groupRecipientSQL ... a message is a group message when one of its recipients is a group
+const groupRecipientSQL = "select 1 from public.message_recipient where message_recipient.message_id = message.id and message_recipient.group_id is not null"
+
+// escapeLike ... match s literally inside a like pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// filter ... translate f into conditions on the mailbox of user
+func (f MailboxFilter) filter(userID int64) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if f.Sender != "" {
+			db = db.Where(`message.sender_id = (select id from public.user where username = ?)`, f.Sender)
+		}
+		switch f.Kind {
+		case MailboxKindGroup:
+			db = db.Where("exists (" + groupRecipientSQL + ")")
+		case MailboxKindDirect:
+			db = db.Where("not exists (" + groupRecipientSQL + ")")
+		}
+		if f.Since != nil {
+			db = db.Where("message.sent_at >= ?", *f.Since)
+		}
+		if f.Until != nil {
+			db = db.Where("message.sent_at < ?", *f.Until)
+		}
+		if f.UnreadOnly {
+			db = db.Scopes(unread(userID))
+		}
+		if f.HasReplies != nil {
+			// only replies user can read count, private replies in a thread stay hidden
+			replies := db.Session(&gorm.Session{NewDB: true}).Model(&Message{}).
+				Select("message.re_id").Where("message.re_id is not null").Scopes(visibleTo(userID))
+			if *f.HasReplies {
+				db = db.Where("message.id in (?)", replies)
+			} else {
+				db = db.Where("message.id not in (?)", replies)
+			}
+		}
+		if f.Subject != "" {
+			db = db.Where("message.subject ilike ?", "%"+escapeLike(f.Subject)+"%")
+		}
+		return db
+	}
+}
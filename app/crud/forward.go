@@ -0,0 +1,36 @@
+package crud
+
+import (
+	"gorm.io/gorm"
+)
+
+// ReserveMessageID ... id of a message created later, its attachments can be stored under their
+// keys before the message exists
+func ReserveMessageID(db *gorm.DB) (int64, error) {
+	var id int64
+	err := db.Raw("select nextval(pg_get_serial_sequence('public.message', 'id'))").Scan(&id).Error
+	return id, err
+}
+
+// ForwardMessage ... create message, whose id was reserved, along with attachments whose content was
+// already copied under their key. Either everything is created or nothing is
+func ForwardMessage(db *gorm.DB, message *Message, attachments []Attachment) (*Message, error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(message).Error
+		if err != nil {
+			return err
+		}
+		message.Attachments = []Attachment{}
+		for _, attachment := range attachments {
+			attachment.MessageID = message.ID
+			attachment.CreatedAt = message.SentAt
+			err = tx.Create(&attachment).Error
+			if err != nil {
+				return err
+			}
+			message.Attachments = append(message.Attachments, attachment)
+		}
+		return queueCreatedMessage(tx, message)
+	})
+	return message, err
+}
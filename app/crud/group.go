@@ -2,13 +2,30 @@ package crud
 
 import (
 	"errors"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+var (
+	ErrLastOwner      = errors.New("group must keep at least one owner")
+	ErrGroupnameTaken = errors.New("groupname is taken by another group")
 )
 
 type Group struct {
 	ID        int64  `gorm:"column:id;type:bigserial;primary_key" json:"-"`
 	Groupname string `gorm:"column:groupname;type:varchar(240);unique" json:"groupname"`
+	// DefaultTTL ... seconds after which messages to the group expire unless they set their own ttl
+	DefaultTTL *int64 `gorm:"column:default_ttl;type:integer" json:"-"`
+	// DeletedAt ... deleted groups cannot be found nor messaged, their messages stay with their members
+	DeletedAt *time.Time `gorm:"column:deleted_at;type:timestamp with time zone" json:"-"`
 }
 
 func (g *Group) TableName() string {
@@ -16,20 +33,26 @@ func (g *Group) TableName() string {
 }
 
 type UserGroup struct {
-	ID      int64 `gorm:"column:id;type:bigserial;primary_key" json:"-"`
-	GroupID int64 `gorm:"column:group_id;integer"`
-	Group   Group `gorm:"foreignKey:group_id"`
-	UserID  int64 `gorm:"column:user_id;integer"`
-	User    User  `gorm:"foreignKey:user_id"`
+	ID      int64  `gorm:"column:id;type:bigserial;primary_key" json:"-"`
+	GroupID int64  `gorm:"column:group_id;integer"`
+	Group   Group  `gorm:"foreignKey:group_id"`
+	UserID  int64  `gorm:"column:user_id;integer"`
+	User    User   `gorm:"foreignKey:user_id"`
+	Role    string `gorm:"column:role;type:varchar(16);default:member"`
 }
 
 func (u *UserGroup) TableName() string {
 	return "public.user_group"
 }
 
+// IsManager ... owners and admins manage the group membership, name and lifetime
+func (u *UserGroup) IsManager() bool {
+	return u.Role == RoleOwner || u.Role == RoleAdmin
+}
+
 func FindGroup(db *gorm.DB, groupname string) (*Group, bool, error) {
 	var group Group
-	err := db.Where("groupname = ?", groupname).First(&group).Error
+	err := db.Where("groupname = ? and deleted_at is null", groupname).First(&group).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, false, nil
 	}
@@ -57,16 +80,189 @@ func FindGroupsByUserID(db *gorm.DB, userID int64) ([]int64, error) {
 	return groupIDs, nil
 }
 
-func CreateGroup(db *gorm.DB, groupname string, users []User) (*Group, error) {
+func IsGroupMember(db *gorm.DB, groupID int64, userID int64) (bool, error) {
+	_, exist, err := GetGroupMembership(db, groupID, userID)
+	return exist, err
+}
+
+func GetGroupMembership(db *gorm.DB, groupID int64, userID int64) (*UserGroup, bool, error) {
+	var userGroup UserGroup
+	err := db.Where("group_id = ? and user_id = ?", groupID, userID).First(&userGroup).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &userGroup, true, nil
+}
+
+func GetGroupMembers(db *gorm.DB, groupID int64) ([]UserGroup, error) {
+	var userGroups []UserGroup
+	err := db.Joins("User").Where("user_group.group_id = ?", groupID).Order(`"User"."username"`).Find(&userGroups).Error
+	if err != nil {
+		return nil, err
+	}
+	return userGroups, nil
+}
+
+// AddGroupMembers ... users already in the group are skipped, new members get the member role
+func AddGroupMembers(db *gorm.DB, groupID int64, users []User) error {
+	var userGroups []UserGroup
+	for _, user := range users {
+		userGroups = append(userGroups, UserGroup{GroupID: groupID, UserID: user.ID, Role: RoleMember})
+	}
+	if len(userGroups) == 0 {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&userGroups).Error
+	})
+}
+
+// lockOwners ... lock the owner rows of a group for the rest of the transaction
+func lockOwners(tx *gorm.DB, groupID int64) ([]UserGroup, error) {
+	var owners []UserGroup
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("group_id = ? and role = ?", groupID, RoleOwner).Find(&owners).Error
+	return owners, err
+}
+
+// isLastOwner ... true when userID is the only owner in owners
+func isLastOwner(owners []UserGroup, userID int64) bool {
+	return len(owners) == 1 && owners[0].UserID == userID
+}
+
+// RemoveGroupMember ... removed is false when user was not a member of the group,
+// ErrLastOwner is returned instead of removing the last owner
+func RemoveGroupMember(db *gorm.DB, groupID int64, userID int64) (bool, error) {
+	removed := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		owners, err := lockOwners(tx, groupID)
+		if err != nil {
+			return err
+		}
+		if isLastOwner(owners, userID) {
+			return ErrLastOwner
+		}
+		result := tx.Where("group_id = ? and user_id = ?", groupID, userID).Delete(&UserGroup{})
+		removed = result.RowsAffected > 0
+		return result.Error
+	})
+	return removed, err
+}
+
+// SetGroupMemberRole ... ErrLastOwner is returned instead of demoting the last owner
+func SetGroupMemberRole(db *gorm.DB, groupID int64, userID int64, role string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		owners, err := lockOwners(tx, groupID)
+		if err != nil {
+			return err
+		}
+		if role != RoleOwner && isLastOwner(owners, userID) {
+			return ErrLastOwner
+		}
+		return tx.Model(&UserGroup{}).Where("group_id = ? and user_id = ?", groupID, userID).Update("role", role).Error
+	})
+}
+
+// TransferGroupOwnership ... to becomes owner and from is demoted to admin, from cannot transfer to
+// themself as they would be demoted right away
+func TransferGroupOwnership(db *gorm.DB, groupID int64, fromUserID int64, toUserID int64) error {
+	if fromUserID == toUserID {
+		return ErrLastOwner
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		_, err := lockOwners(tx, groupID)
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&UserGroup{}).Where("group_id = ? and user_id = ?", groupID, toUserID).Update("role", RoleOwner).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&UserGroup{}).Where("group_id = ? and user_id = ?", groupID, fromUserID).Update("role", RoleAdmin).Error
+	})
+}
+
+// GroupUpdate ... changes to a group, an empty Groupname is left unchanged and DefaultTTL is only
+// set with SetDefaultTTL, nil stops messages to the group from expiring by default
+type GroupUpdate struct {
+	Groupname     string
+	DefaultTTL    *int64
+	SetDefaultTTL bool
+}
+
+// UpdateGroup ... apply update to group at once, ErrGroupnameTaken is returned instead of renaming
+// group after another group
+func UpdateGroup(db *gorm.DB, group *Group, update GroupUpdate) error {
+	rename := update.Groupname != "" && update.Groupname != group.Groupname
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if rename {
+			exist, err := GroupExists(tx, update.Groupname)
+			if err != nil {
+				return err
+			}
+			if exist {
+				return ErrGroupnameTaken
+			}
+			err = tx.Model(group).Update("groupname", update.Groupname).Error
+			if err != nil {
+				return err
+			}
+		}
+		if update.SetDefaultTTL {
+			return tx.Model(group).Update("default_ttl", update.DefaultTTL).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if rename {
+		group.Groupname = update.Groupname
+	}
+	if update.SetDefaultTTL {
+		group.DefaultTTL = update.DefaultTTL
+	}
+	return nil
+}
+
+// DeleteGroup ... the group is only marked deleted, memberships are kept so that members still read
+// the messages sent to it. Its incoming webhooks are revoked and its webhooks removed
+func DeleteGroup(db *gorm.DB, group *Group) error {
+	now := time.Now().UTC()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(group).Update("deleted_at", now).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&IncomingWebhook{}).Where("group_id = ? and revoked_at is null", group.ID).Update("revoked_at", now).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("group_id = ?", group.ID).Delete(&Webhook{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	group.DeletedAt = &now
+	return nil
+}
+
+// CreateGroup ... owner is always part of the group, other members get the member role
+func CreateGroup(db *gorm.DB, groupname string, owner User, users []User) (*Group, error) {
 	group := Group{Groupname: groupname}
 	err := db.Transaction(func(tx *gorm.DB) error {
 		result := tx.Create(&group)
 		if result.Error != nil {
 			return result.Error
 		}
-		var userGroups []UserGroup
+		userGroups := []UserGroup{{Group: group, User: owner, Role: RoleOwner}}
 		for _, user := range users {
-			userGroups = append(userGroups, UserGroup{Group: group, User: user})
+			if user.ID == owner.ID {
+				continue
+			}
+			userGroups = append(userGroups, UserGroup{Group: group, User: user, Role: RoleMember})
 		}
 		result = tx.Create(&userGroups)
 		if result.Error != nil {
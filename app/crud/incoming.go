@@ -0,0 +1,130 @@
+package crud
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BotSuffix ... ends the username of the bot posting the messages of an incoming webhook,
+// users cannot register such usernames
+const BotSuffix = "[bot]"
+
+// IsBotUsername ... username belongs to the bot of an incoming webhook
+func IsBotUsername(username string) bool {
+	return strings.HasSuffix(username, BotSuffix)
+}
+
+// IncomingWebhook ... token letting an external system post into a group as its bot, revoked
+// webhooks are kept so that their bot remains the sender of what it posted
+type IncomingWebhook struct {
+	ID        int64      `gorm:"column:id;type:bigserial;primary_key"`
+	GroupID   int64      `gorm:"column:group_id;integer"`
+	Group     *Group     `gorm:"foreignKey:group_id"`
+	BotID     int64      `gorm:"column:bot_id;integer"`
+	Bot       *User      `gorm:"foreignKey:bot_id"`
+	Name      string     `gorm:"column:name;type:varchar(64)"`
+	TokenHash string     `gorm:"column:token_hash;type:char(64);unique"`
+	CreatedBy *int64     `gorm:"column:created_by;integer"`
+	CreatedAt time.Time  `gorm:"column:created_at;type:timestamp with time zone"`
+	RevokedAt *time.Time `gorm:"column:revoked_at;type:timestamp with time zone"`
+}
+
+func (w *IncomingWebhook) TableName() string {
+	return "public.incoming_webhook"
+}
+
+// CreateIncomingWebhook ... create the bot of webhook, named after it, and issue its token
+func CreateIncomingWebhook(db *gorm.DB, webhook *IncomingWebhook) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	webhook.TokenHash = hashToken(token)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		bot := User{Username: webhook.Name + BotSuffix}
+		if err := tx.Create(&bot).Error; err != nil {
+			return err
+		}
+		webhook.BotID, webhook.Bot = bot.ID, &bot
+		return tx.Omit(clause.Associations).Create(webhook).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// GetIncomingWebhook ... incoming webhook id of group
+func GetIncomingWebhook(db *gorm.DB, groupID int64, id int64) (*IncomingWebhook, bool, error) {
+	var webhook IncomingWebhook
+	err := db.Preload("Bot").Where("group_id = ? and id = ?", groupID, id).First(&webhook).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &webhook, true, nil
+}
+
+// GetGroupIncomingWebhooks ... revoked ones included
+func GetGroupIncomingWebhooks(db *gorm.DB, groupID int64) ([]IncomingWebhook, error) {
+	webhooks := []IncomingWebhook{}
+	err := db.Preload("Bot").Where("group_id = ?", groupID).Order("id").Find(&webhooks).Error
+	return webhooks, err
+}
+
+// FindIncomingWebhookByToken ... non revoked webhook of token with its group and bot
+func FindIncomingWebhookByToken(db *gorm.DB, token string) (*IncomingWebhook, bool, error) {
+	var webhook IncomingWebhook
+	err := db.Preload("Group").Preload("Bot").Where("token_hash = ? and revoked_at is null", hashToken(token)).First(&webhook).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &webhook, true, nil
+}
+
+// RevokeIncomingWebhook ... its token stops working for good
+func RevokeIncomingWebhook(db *gorm.DB, webhook *IncomingWebhook) error {
+	if webhook.RevokedAt != nil {
+		return nil
+	}
+	now := time.Now().UTC()
+	webhook.RevokedAt = &now
+	return db.Model(webhook).Update("revoked_at", now).Error
+}
+
+// CreateBotMessage ... create message from the bot of webhook unless it already sent limit messages
+// since, created is false when it did. The webhook is locked so that concurrent posts with the same
+// token are counted one after the other
+func CreateBotMessage(db *gorm.DB, webhook *IncomingWebhook, message *Message, since time.Time, limit int) (*Message, bool, error) {
+	created := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var locked IncomingWebhook
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? and revoked_at is null", webhook.ID).First(&locked).Error
+		if err != nil {
+			return err
+		}
+		var sent int64
+		err = tx.Model(&Message{}).Where("sender_id = ? and sent_at > ?", webhook.BotID, since).Count(&sent).Error
+		if err != nil || sent >= int64(limit) {
+			return err
+		}
+		if err = tx.Create(message).Error; err != nil {
+			return err
+		}
+		if err = queueCreatedMessage(tx, message); err != nil {
+			return err
+		}
+		created = true
+		return nil
+	})
+	return message, created, err
+}
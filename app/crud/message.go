@@ -1,6 +1,7 @@
 package crud
 
 import (
+	"database/sql"
 	"errors"
 	"time"
 
@@ -8,33 +9,99 @@ import (
 )
 
 type Message struct {
-	ID          int64     `gorm:"column:id;type:bigserial;primary_key"`
-	REID        *int64    `gorm:"column:re_id;integer"`
-	SenderID    *int64    `gorm:"column:sender_id;integer"`
-	Sender      *User     `gorm:"foreignKey:sender_id"`
-	RecipientID *int64    `gorm:"column:recipient_id;integer"`
-	Recipient   *User     `gorm:"foreignKey:recipient_id"`
-	GroupID     *int64    `gorm:"column:group_id;integer"`
-	Group       *Group    `gorm:"foreignKey:group_id"`
-	Subject     string    `gorm:"column:subject;type:text;" json:"subject"`
-	Body        string    `gorm:"column:body;type:text;" json:"body"`
-	SentAt      time.Time `gorm:"column:sent_at;type:timestamp with time zone;" json:"sentAt"`
+	ID              int64              `gorm:"column:id;type:bigserial;primary_key"`
+	REID            *int64             `gorm:"column:re_id;integer"`
+	ThreadID        *int64             `gorm:"column:thread_id;integer"`
+	ForwardedFromID *int64             `gorm:"column:forwarded_from_id;integer"` // message this one forwards
+	SenderID        *int64             `gorm:"column:sender_id;integer"`
+	Sender          *User              `gorm:"foreignKey:sender_id"`
+	RecipientID     *int64             `gorm:"column:recipient_id;integer"`
+	Recipient       *User              `gorm:"foreignKey:recipient_id"`
+	GroupID         *int64             `gorm:"column:group_id;integer"`
+	Group           *Group             `gorm:"foreignKey:group_id"`
+	Recipients      []MessageRecipient `gorm:"foreignKey:MessageID"` // every recipient, Recipient and Group are the first to recipient
+	Attachments     []Attachment       `gorm:"foreignKey:MessageID"`
+	Subject         string             `gorm:"column:subject;type:text;" json:"subject"`
+	Body            string             `gorm:"column:body;type:text;" json:"body"`
+	SentAt          time.Time          `gorm:"column:sent_at;type:timestamp with time zone;" json:"sentAt"`
+	SendAt          *time.Time         `gorm:"column:send_at;type:timestamp with time zone" json:"-"` // pending until then, none once delivered
+	ExpiresAt       *time.Time         `gorm:"column:expires_at;type:timestamp with time zone" json:"-"`
+	EditedAt        *time.Time         `gorm:"column:edited_at;type:timestamp with time zone" json:"-"`
+	DeletedAt       *time.Time         `gorm:"column:deleted_at;type:timestamp with time zone" json:"-"` // deleted for everyone by its sender
+	PurgedAt        *time.Time         `gorm:"column:purged_at;type:timestamp with time zone" json:"-"`
+	Unread          *bool              `gorm:"column:unread;->" json:"-"`     // only filled when queried WithReadState
+	TrashedAt       *time.Time         `gorm:"column:trashed_at;->" json:"-"` // only filled when queried WithReadState
 }
 
 func (m *Message) TableName() string {
 	return "public.message"
 }
+
+// BeforeCreate ... a reply joins the thread of the message it replies to
+func (m *Message) BeforeCreate(tx *gorm.DB) error {
+	if m.ThreadID != nil || m.REID == nil {
+		return nil
+	}
+	var threadIDs []int64
+	err := tx.Session(&gorm.Session{NewDB: true}).Model(&Message{}).
+		Where("message.id = ?", *m.REID).Pluck("coalesce(message.thread_id, message.id)", &threadIDs).Error
+	if err != nil {
+		return err
+	}
+	if len(threadIDs) == 1 {
+		m.ThreadID = &threadIDs[0]
+	}
+	return nil
+}
+
+// AfterCreate ... a message that is not a reply starts its own thread, a message created
+// with Recipient or Group only gets it as its to recipient
+func (m *Message) AfterCreate(tx *gorm.DB) error {
+	newDB := tx.Session(&gorm.Session{NewDB: true})
+	if m.ThreadID == nil {
+		threadID := m.ID
+		m.ThreadID = &threadID
+		err := newDB.Model(&Message{}).Where("message.id = ?", m.ID).UpdateColumn("thread_id", m.ID).Error
+		if err != nil {
+			return err
+		}
+	}
+	if len(m.Recipients) == 0 && (m.RecipientID != nil || m.GroupID != nil) {
+		recipient := MessageRecipient{MessageID: m.ID, UserID: m.RecipientID, GroupID: m.GroupID, Role: RecipientTo}
+		if m.GroupID != nil {
+			recipient.UserID = nil
+		}
+		err := newDB.Create(&recipient).Error
+		if err != nil {
+			return err
+		}
+		recipient.User, recipient.Group = m.Recipient, m.Group
+		m.Recipients = []MessageRecipient{recipient}
+	}
+	return nil
+}
+
 func CreateMessage(db *gorm.DB, message *Message) (*Message, error) {
 	err := db.Transaction(func(tx *gorm.DB) error {
 		result := tx.Create(&message)
-		return result.Error
+		if result.Error != nil {
+			return result.Error
+		}
+		return queueCreatedMessage(tx, message)
 	})
 	return message, err
 }
 
-func GetMessage(db *gorm.DB, messageID int64) (*Message, bool, error) {
+// uploadOrder ... attachments in upload order
+func uploadOrder(db *gorm.DB) *gorm.DB {
+	return db.Order("id")
+}
+
+// GetMessage ... with its attachments, listings leave them out
+func GetMessage(db *gorm.DB, messageID int64, scopes ...func(*gorm.DB) *gorm.DB) (*Message, bool, error) {
 	var msg Message
-	err := db.Preload("Sender").Preload("Recipient").Preload("Group").Where("id = ?", messageID).First(&msg).Error
+	query := db.Scopes(withParticipants, notExpired).Preload("Attachments", uploadOrder).Scopes(scopes...)
+	err := query.Where("message.id = ?", messageID).First(&msg).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, false, nil
 	}
@@ -44,30 +111,88 @@ func GetMessage(db *gorm.DB, messageID int64) (*Message, bool, error) {
 	return &msg, true, nil
 }
 
-func GetMessageReplies(db *gorm.DB, messageID int64) ([]Message, error) {
-	var msgs []Message
-	query := db.Preload("Sender").Preload("Recipient").Preload("Group")
-	err := query.Where("re_id = ?", messageID).Order("sent_at DESC").Find(&msgs).Error
+// unexpiredSQL ... condition on message not having expired at @now, expired messages are gone
+// for everyone even before the sweeper deletes them
+const unexpiredSQL = "(message.expires_at is null or message.expires_at > @now)"
+
+// receivedSQL ... condition on message being delivered to @user directly or through one of their groups,
+// in any role. A message reaching @user through several recipients still matches once, a message
+// scheduled for later is only seen by its sender
+const receivedSQL = "(message.send_at is null and " + unexpiredSQL + " and message.id in (select message_recipient.message_id from public.message_recipient " +
+	"where message_recipient.user_id = @user or message_recipient.group_id in (select group_id from public.user_group where user_id = @user)))"
+
+// visibleSQL ... condition on message being readable by @user: received or sent by @user
+const visibleSQL = "((message.sender_id = @user and " + unexpiredSQL + ") or " + receivedSQL + ")"
+
+// receivedBy ... messages addressed to user directly or through one of their groups
+func receivedBy(userID int64) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(receivedSQL, sql.Named("user", userID), sql.Named("now", time.Now().UTC()))
+	}
+}
+
+// visibleTo ... messages user is allowed to read: received or sent by user
+func visibleTo(userID int64) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(visibleSQL, sql.Named("user", userID), sql.Named("now", time.Now().UTC()))
+	}
+}
+
+// notExpired ... hide messages past their expiry
+func notExpired(db *gorm.DB) *gorm.DB {
+	return db.Where(unexpiredSQL, sql.Named("now", time.Now().UTC()))
+}
+
+// IsMessageVisible ... true when user is the sender, the recipient or a member of the message group
+func IsMessageVisible(db *gorm.DB, messageID int64, userID int64) (bool, error) {
+	var count int64
+	err := db.Model(&Message{}).Scopes(visibleTo(userID)).Where("message.id = ?", messageID).Count(&count).Error
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	return msgs, nil
+	return count == 1, nil
 }
 
-func GetUserMailbox(db *gorm.DB, userID int64) ([]Message, error) {
-	// Query
-	// Get Messages where RecipientID = <UserID>
-	// Get Messages Where GroupID IN (Get UserGroup where UserID = <UserID>)
-	groupIDs, err := FindGroupsByUserID(db, userID)
+// notDeleted ... hide messages deleted for everyone or moved to the trash by user
+func notDeleted(userID int64) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(
+			"message.deleted_at is null and not exists (select 1 from public.message_state where message_state.message_id = message.id and message_state.user_id = ? and message_state.deleted_at is not null)",
+			userID,
+		)
+	}
+}
+
+// GetMessageReplies ... deleted replies are kept so the thread stays whole, they render as tombstones
+func GetMessageReplies(db *gorm.DB, messageID int64, viewerID int64, page Page) ([]Message, *Cursor, error) {
+	var msgs []Message
+	query := db.Scopes(withParticipants, visibleTo(viewerID), WithReadState(viewerID))
+	err := query.Where("message.re_id = ?", messageID).Scopes(paginate(page)).Find(&msgs).Error
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	msgs, next := nextPage(msgs, page)
+	return msgs, next, nil
+}
+
+func GetUserMailbox(db *gorm.DB, userID int64, filter MailboxFilter, page Page) ([]Message, *Cursor, error) {
 	var msgs []Message
-	query := db.Preload("Sender").Preload("Recipient").Preload("Group")
-	err = query.Where("(recipient_id = ? or group_id in ?)", userID, groupIDs).Order("sent_at desc").Find(&msgs).Error
+	query := db.Scopes(withParticipants, receivedBy(userID), notDeleted(userID), WithReadState(userID))
+	err := query.Scopes(filter.filter(userID), paginate(page)).Find(&msgs).Error
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return msgs, nil
+	msgs, next := nextPage(msgs, page)
+	return msgs, next, nil
+}
 
+func GetUserSent(db *gorm.DB, userID int64, page Page) ([]Message, *Cursor, error) {
+	var msgs []Message
+	query := db.Scopes(withParticipants, notDeleted(userID), notExpired, WithReadState(userID))
+	err := query.Where("message.sender_id = ? and message.send_at is null", userID).Scopes(paginate(page)).Find(&msgs).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	msgs, next := nextPage(msgs, page)
+	return msgs, next, nil
 }
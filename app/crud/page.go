@@ -0,0 +1,89 @@
+package crud
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 200
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor ... position of a message in a listing ordered on (sent_at, id)
+type Cursor struct {
+	SentAt time.Time
+	ID     int64
+}
+
+// Encode ... opaque representation handed to clients
+func (c *Cursor) Encode() string {
+	raw := fmt.Sprintf("%s|%d", c.SentAt.UTC().Format(time.RFC3339Nano), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(encoded string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+	sentAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &Cursor{SentAt: sentAt, ID: id}, nil
+}
+
+// Page ... keyset pagination, After is nil for the first page
+// listings are newest first unless Ascending is set
+type Page struct {
+	Limit     int
+	After     *Cursor
+	Ascending bool
+}
+
+// paginate ... fetch one extra row to know if there is a next page
+func paginate(page Page) func(*gorm.DB) *gorm.DB {
+	return paginateOn("message", "sent_at", page)
+}
+
+// paginateOn ... paginate rows of table on their timestamp column then id, cursors hold the
+// column value as SentAt
+func paginateOn(table string, column string, page Page) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		comparison, direction := "<", "desc"
+		if page.Ascending {
+			comparison, direction = ">", "asc"
+		}
+		if page.After != nil {
+			db = db.Where(fmt.Sprintf("(%s.%s, %s.id) %s (?, ?)", table, column, table, comparison), page.After.SentAt, page.After.ID)
+		}
+		return db.Order(fmt.Sprintf("%s.%s %s, %s.id %s", table, column, direction, table, direction)).Limit(page.Limit + 1)
+	}
+}
+
+// nextPage ... trim the extra row fetched by paginate, cursor is nil on the last page
+func nextPage(msgs []Message, page Page) ([]Message, *Cursor) {
+	if len(msgs) <= page.Limit {
+		return msgs, nil
+	}
+	msgs = msgs[:page.Limit]
+	last := msgs[len(msgs)-1]
+	return msgs, &Cursor{SentAt: last.SentAt, ID: last.ID}
+}
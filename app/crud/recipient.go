@@ -0,0 +1,52 @@
+package crud
+
+import (
+	"database/sql"
+
+	"gorm.io/gorm"
+)
+
+const (
+	RecipientTo  = "to"
+	RecipientCc  = "cc"
+	RecipientBcc = "bcc"
+)
+
+// MessageRecipient ... a user or a group a message is addressed to
+type MessageRecipient struct {
+	ID        int64  `gorm:"column:id;type:bigserial;primary_key"`
+	MessageID int64  `gorm:"column:message_id;integer"`
+	UserID    *int64 `gorm:"column:user_id;integer"`
+	User      *User  `gorm:"foreignKey:user_id"`
+	GroupID   *int64 `gorm:"column:group_id;integer"`
+	Group     *Group `gorm:"foreignKey:group_id"`
+	Role      string `gorm:"column:role;type:varchar(3)"`
+}
+
+func (r *MessageRecipient) TableName() string {
+	return "public.message_recipient"
+}
+
+// withParticipants ... preload the sender and every recipient of the messages
+func withParticipants(db *gorm.DB) *gorm.DB {
+	return db.Preload("Sender").Preload("Recipient").Preload("Group").
+		Preload("Recipients", recipientOrder).Preload("Recipients.User").Preload("Recipients.Group")
+}
+
+func recipientOrder(db *gorm.DB) *gorm.DB {
+	return db.Order("id")
+}
+
+// readersSQL ... users @message was delivered to, directly or through one of their groups
+const readersSQL = `select message_recipient.user_id from public.message_recipient
+where message_recipient.message_id = @message and message_recipient.user_id is not null
+union
+select user_group.user_id from public.message_recipient join public.user_group on user_group.group_id = message_recipient.group_id
+where message_recipient.message_id = @message`
+
+// GetMessageReaders ... ids of the users a message was delivered to, each once
+func GetMessageReaders(db *gorm.DB, messageID int64) ([]int64, error) {
+	ids := []int64{}
+	err := db.Raw(readersSQL, sql.Named("message", messageID)).Scan(&ids).Error
+	return ids, err
+}
@@ -0,0 +1,75 @@
+package crud
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MessageRevision ... content a message had before one of its edits,
+// it was written at WrittenAt and replaced at ReplacedAt
+type MessageRevision struct {
+	ID         int64     `gorm:"column:id;type:bigserial;primary_key"`
+	MessageID  int64     `gorm:"column:message_id;integer"`
+	Subject    string    `gorm:"column:subject;type:text"`
+	Body       string    `gorm:"column:body;type:text"`
+	WrittenAt  time.Time `gorm:"column:written_at;type:timestamp with time zone"`
+	ReplacedAt time.Time `gorm:"column:replaced_at;type:timestamp with time zone"`
+}
+
+func (r *MessageRevision) TableName() string {
+	return "public.message_revision"
+}
+
+// EditMessage ... replace subject and body of message, nil values are left unchanged,
+// the previous content is kept as a revision. msg is updated in place, ErrMessageDeleted is
+// returned when it was deleted for everyone
+func EditMessage(db *gorm.DB, msg *Message, subject *string, body *string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var current Message
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("message.id = ?", msg.ID).First(&current).Error
+		if err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		revision := MessageRevision{
+			MessageID:  current.ID,
+			Subject:    current.Subject,
+			Body:       current.Body,
+			WrittenAt:  current.SentAt,
+			ReplacedAt: now,
+		}
+		if current.EditedAt != nil {
+			revision.WrittenAt = *current.EditedAt
+		}
+		err = tx.Create(&revision).Error
+		if err != nil {
+			return err
+		}
+		if subject != nil {
+			current.Subject = *subject
+		}
+		if body != nil {
+			current.Body = *body
+		}
+		// a deletion for everyone is never undone by an edit
+		result := tx.Model(&Message{}).Where("message.id = ? and message.deleted_at is null", current.ID).
+			Updates(map[string]interface{}{"subject": current.Subject, "body": current.Body, "edited_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrMessageDeleted
+		}
+		msg.Subject, msg.Body, msg.EditedAt = current.Subject, current.Body, &now
+		return nil
+	})
+}
+
+// GetMessageRevisions ... previous contents of a message, oldest first
+func GetMessageRevisions(db *gorm.DB, messageID int64) ([]MessageRevision, error) {
+	revisions := []MessageRevision{}
+	err := db.Where("message_id = ?", messageID).Order("replaced_at asc, id asc").Find(&revisions).Error
+	return revisions, err
+}
@@ -0,0 +1,88 @@
+package crud
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrNotScheduled ... the message is not waiting to be sent anymore, it was delivered or cancelled
+var ErrNotScheduled = errors.New("message is not scheduled")
+
+// GetUserScheduled ... messages of sender waiting to be delivered, next to go first when page is ascending
+func GetUserScheduled(db *gorm.DB, senderID int64, page Page) ([]Message, *Cursor, error) {
+	msgs := []Message{}
+	err := db.Scopes(withParticipants).Where("message.sender_id = ? and message.send_at is not null", senderID).
+		Scopes(paginateOn("message", "send_at", page)).Find(&msgs).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(msgs) <= page.Limit {
+		return msgs, nil, nil
+	}
+	msgs = msgs[:page.Limit]
+	last := msgs[len(msgs)-1]
+	return msgs, &Cursor{SentAt: *last.SendAt, ID: last.ID}, nil
+}
+
+// expiryShiftSQL ... expires_at moved along with sent_at so the message keeps its ttl
+const expiryShiftSQL = "message.expires_at + (?::timestamptz - message.sent_at)"
+
+// RescheduleMessage ... move the delivery of a pending message of sender to sendAt
+func RescheduleMessage(db *gorm.DB, messageID int64, senderID int64, sendAt time.Time) error {
+	result := db.Model(&Message{}).
+		Where("message.id = ? and message.sender_id = ? and message.send_at is not null", messageID, senderID).
+		Updates(map[string]interface{}{"send_at": sendAt, "sent_at": sendAt, "expires_at": gorm.Expr(expiryShiftSQL, sendAt)})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotScheduled
+	}
+	return nil
+}
+
+// CancelScheduledMessage ... delete a pending message of sender before anyone got it, the attachments
+// it had are returned so their blobs can be deleted
+func CancelScheduledMessage(db *gorm.DB, messageID int64, senderID int64) ([]Attachment, error) {
+	attachments := []Attachment{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("message_id = ?", messageID).Find(&attachments).Error
+		if err != nil {
+			return err
+		}
+		result := tx.Where("message.id = ? and message.sender_id = ? and message.send_at is not null", messageID, senderID).
+			Delete(&Message{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotScheduled
+		}
+		return nil
+	})
+	return attachments, err
+}
+
+// deliverSQL ... rows locked by another replica delivering them are skipped, once they are
+// released their send_at is null and they do not match anymore. The ttl of a message runs from its delivery
+const deliverSQL = `update public.message set sent_at = @now, send_at = null, expires_at = message.expires_at + (@now::timestamptz - message.sent_at)
+where message.id in (
+	select id from public.message where send_at <= @now order by send_at limit @limit for update skip locked
+) returning message.id`
+
+// DeliverScheduledMessages ... deliver up to limit messages due at now and queue them for the webhooks,
+// ids of the delivered messages
+func DeliverScheduledMessages(db *gorm.DB, now time.Time, limit int) ([]int64, error) {
+	ids := []int64{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Raw(deliverSQL, sql.Named("now", now), sql.Named("limit", limit)).Scan(&ids).Error
+		if err != nil {
+			return err
+		}
+		return QueueWebhookDeliveries(tx, ids)
+	})
+	return ids, err
+}
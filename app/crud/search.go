@@ -0,0 +1,78 @@
+package crud
+
+import (
+	"gorm.io/gorm"
+)
+
+// searchText ... subject and body html escaped, the snippet is html with only the <mark> tags unescaped
+const searchText = "replace(replace(replace(replace(" +
+	"coalesce(message.subject, '') || ' ' || coalesce(message.body, ''), " +
+	"'&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '\"', '&quot;')"
+
+// searchSelect ... the text search configuration must match the one of the search column
+const searchSelect = "message.id, ts_rank(message.search, query) as rank, " +
+	"ts_headline('english', " + searchText + ", query, " +
+	"'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=30, MinWords=10') as snippet"
+
+// SearchResult ... a message matching a search with its rank and highlighted snippet
+type SearchResult struct {
+	Message Message
+	Rank    float64
+	Snippet string
+}
+
+type searchHit struct {
+	ID      int64   `gorm:"column:id"`
+	Rank    float64 `gorm:"column:rank"`
+	Snippet string  `gorm:"column:snippet"`
+}
+
+// SearchMessages ... full text search over subject and body of the mailbox of user, best match first
+// q supports the web search syntax ("quoted phrases", or, -excluded). next is the offset of the
+// following page, nil on the last one
+func SearchMessages(db *gorm.DB, userID int64, q string, limit int, offset int) ([]SearchResult, *int, error) {
+	var hits []searchHit
+	query := db.Model(&Message{}).
+		Select(searchSelect).
+		Joins("cross join websearch_to_tsquery('english', ?) as query", q).
+		Where("message.search @@ query").
+		Scopes(receivedBy(userID), notDeleted(userID))
+	err := query.Order("rank desc, message.sent_at desc, message.id desc").Limit(limit + 1).Offset(offset).Find(&hits).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	// the next page is known from the hits, results may be fewer when messages are deleted in between
+	var next *int
+	if len(hits) > limit {
+		hits = hits[:limit]
+		nextOffset := offset + limit
+		next = &nextOffset
+	}
+	if len(hits) == 0 {
+		return []SearchResult{}, next, nil
+	}
+
+	var ids []int64
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	var msgs []Message
+	err = db.Scopes(withParticipants, WithReadState(userID), receivedBy(userID), notDeleted(userID)).Where("message.id in ?", ids).Find(&msgs).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	byID := map[int64]Message{}
+	for _, msg := range msgs {
+		byID[msg.ID] = msg
+	}
+	results := []SearchResult{}
+	for _, hit := range hits {
+		msg, found := byID[hit.ID]
+		if !found {
+			// expired or deleted between the two queries
+			continue
+		}
+		results = append(results, SearchResult{Message: msg, Rank: hit.Rank, Snippet: hit.Snippet})
+	}
+	return results, next, nil
+}
@@ -0,0 +1,90 @@
+package crud
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MessageState ... per recipient state of a message, a missing row means unread
+type MessageState struct {
+	ID        int64      `gorm:"column:id;type:bigserial;primary_key"`
+	MessageID int64      `gorm:"column:message_id;integer"`
+	UserID    int64      `gorm:"column:user_id;integer"`
+	ReadAt    *time.Time `gorm:"column:read_at;type:timestamp with time zone"`
+	DeletedAt *time.Time `gorm:"column:deleted_at;type:timestamp with time zone"` // moved to the trash
+	PurgedAt  *time.Time `gorm:"column:purged_at;type:timestamp with time zone"`  // removed from the trash for good
+}
+
+func (s *MessageState) TableName() string {
+	return "public.message_state"
+}
+
+// WithReadState ... join the state of user, fills Message.Unread and Message.TrashedAt
+// messages sent by user are never unread
+func WithReadState(userID int64) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Select("message.*, (message.sender_id <> ? and message_state.read_at is null) as unread, message_state.deleted_at as trashed_at", userID).
+			Joins("left join public.message_state on message_state.message_id = message.id and message_state.user_id = ?", userID)
+	}
+}
+
+// unread ... messages received by user without read state, excluding their own messages
+func unread(userID int64) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(
+			"message.sender_id <> ? and not exists (select 1 from public.message_state where message_state.message_id = message.id and message_state.user_id = ? and message_state.read_at is not null)",
+			userID, userID,
+		)
+	}
+}
+
+// setReadAt ... upsert the read state of user for every received message matched by selection
+func setReadAt(db *gorm.DB, userID int64, readAt *time.Time, selection func(*gorm.DB) *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		messages := tx.Model(&Message{}).Select("message.id, ?::int, ?::timestamptz", userID, readAt).Scopes(receivedBy(userID), selection)
+		return tx.Exec(
+			"insert into public.message_state (message_id, user_id, read_at) (?) on conflict (user_id, message_id) do update set read_at = excluded.read_at",
+			messages,
+		).Error
+	})
+}
+
+func byIDs(messageIDs []int64) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("message.id in ?", messageIDs)
+	}
+}
+
+func all(db *gorm.DB) *gorm.DB {
+	return db
+}
+
+// MarkMessagesRead ... ids of messages user did not receive are ignored
+func MarkMessagesRead(db *gorm.DB, userID int64, messageIDs []int64) error {
+	now := time.Now().UTC()
+	return setReadAt(db, userID, &now, byIDs(messageIDs))
+}
+
+// MarkMessagesUnread ... ids of messages user did not receive are ignored
+func MarkMessagesUnread(db *gorm.DB, userID int64, messageIDs []int64) error {
+	return setReadAt(db, userID, nil, byIDs(messageIDs))
+}
+
+// MarkMailboxRead ... mark every message of the mailbox of user as read
+func MarkMailboxRead(db *gorm.DB, userID int64) error {
+	now := time.Now().UTC()
+	return setReadAt(db, userID, &now, all)
+}
+
+// MarkMailboxUnread ... mark every message of the mailbox of user as unread
+func MarkMailboxUnread(db *gorm.DB, userID int64) error {
+	return db.Model(&MessageState{}).Where("user_id = ?", userID).Update("read_at", nil).Error
+}
+
+// CountUnread ... number of unread messages in the mailbox of user
+func CountUnread(db *gorm.DB, userID int64) (int64, error) {
+	var count int64
+	err := db.Model(&Message{}).Scopes(receivedBy(userID), notDeleted(userID), unread(userID)).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,59 @@
+package crud
+
+import (
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const MaxThreadDepth = 100
+
+// ThreadNode ... message of a thread with its distance to the message the walk started from
+type ThreadNode struct {
+	Message Message
+	Depth   int
+}
+
+type threadRow struct {
+	ID    int64 `gorm:"column:id"`
+	Depth int   `gorm:"column:depth"`
+}
+
+// threadSQL ... walk the re_id tree down from @root, replies @user cannot read are
+// skipped along with everything below them
+const threadSQL = `with recursive thread as (
+	select message.id, 0 as depth from public.message where message.id = @root
+	union all
+	select message.id, thread.depth + 1 from public.message join thread on message.re_id = thread.id
+	where thread.depth < @depth and ` + visibleSQL + `
+) select id, depth from thread`
+
+// GetThread ... rootID and all the replies below it up to maxDepth levels, oldest first
+func GetThread(db *gorm.DB, rootID int64, viewerID int64, maxDepth int) ([]ThreadNode, error) {
+	var rows []threadRow
+	err := db.Raw(threadSQL, sql.Named("root", rootID), sql.Named("depth", maxDepth), sql.Named("user", viewerID), sql.Named("now", time.Now().UTC())).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return []ThreadNode{}, nil
+	}
+	depths := map[int64]int{}
+	var ids []int64
+	for _, row := range rows {
+		depths[row.ID] = row.Depth
+		ids = append(ids, row.ID)
+	}
+	var msgs []Message
+	query := db.Scopes(withParticipants, WithReadState(viewerID))
+	err = query.Where("message.id in ?", ids).Order("message.sent_at asc, message.id asc").Find(&msgs).Error
+	if err != nil {
+		return nil, err
+	}
+	nodes := []ThreadNode{}
+	for _, msg := range msgs {
+		nodes = append(nodes, ThreadNode{Message: msg, Depth: depths[msg.ID]})
+	}
+	return nodes, nil
+}
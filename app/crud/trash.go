@@ -0,0 +1,88 @@
+package crud
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrMessageDeleted ... the message was deleted for everyone in the meantime
+var ErrMessageDeleted = errors.New("message was deleted")
+
+// TrashMessage ... move message to the trash of user, the other readers keep it
+// trashing a message twice keeps the original deletion time
+func TrashMessage(db *gorm.DB, messageID int64, userID int64) error {
+	state := MessageState{MessageID: messageID, UserID: userID, DeletedAt: timePtr(time.Now().UTC())}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "message_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"deleted_at": gorm.Expr("coalesce(message_state.deleted_at, excluded.deleted_at)")}),
+	}).Create(&state).Error
+}
+
+// RestoreMessage ... take message out of the trash of user, false when it is not in the trash anymore
+func RestoreMessage(db *gorm.DB, messageID int64, userID int64) (bool, error) {
+	result := db.Model(&MessageState{}).
+		Where("message_id = ? and user_id = ? and deleted_at is not null and purged_at is null", messageID, userID).
+		Update("deleted_at", nil)
+	return result.RowsAffected == 1, result.Error
+}
+
+// DeleteMessageForEveryone ... turn message into a tombstone for all its readers,
+// the content is kept until the purge so the deletion cannot be undone through the api
+func DeleteMessageForEveryone(db *gorm.DB, messageID int64) error {
+	result := db.Model(&Message{}).Where("message.id = ? and message.deleted_at is null", messageID).
+		Update("deleted_at", time.Now().UTC())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrMessageDeleted
+	}
+	return nil
+}
+
+// GetUserTrash ... messages user moved to the trash and that were not purged yet
+func GetUserTrash(db *gorm.DB, userID int64, page Page) ([]Message, *Cursor, error) {
+	var msgs []Message
+	query := db.Scopes(withParticipants, visibleTo(userID), WithReadState(userID))
+	err := query.Where("message_state.deleted_at is not null and message_state.purged_at is null").Scopes(paginate(page)).Find(&msgs).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	msgs, next := nextPage(msgs, page)
+	return msgs, next, nil
+}
+
+// PurgeTrash ... drop for good trash entries and messages deleted for everyone before cutoff,
+// the content and revisions of purged messages are erased but the row stays for the replies pointing at it
+func PurgeTrash(db *gorm.DB, cutoff time.Time) (int64, error) {
+	var purged int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		result := tx.Model(&MessageState{}).
+			Where("deleted_at < ? and purged_at is null", cutoff).
+			Update("purged_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		purged += result.RowsAffected
+		expired := tx.Session(&gorm.Session{NewDB: true}).Model(&Message{}).Select("message.id").
+			Where("message.deleted_at < ? and message.purged_at is null", cutoff)
+		err := tx.Where("message_id in (?)", expired).Delete(&MessageRevision{}).Error
+		if err != nil {
+			return err
+		}
+		result = tx.Model(&Message{}).
+			Where("message.deleted_at < ? and message.purged_at is null", cutoff).
+			Updates(map[string]interface{}{"subject": "", "body": "", "purged_at": now})
+		purged += result.RowsAffected
+		return result.Error
+	})
+	return purged, err
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
@@ -2,13 +2,16 @@ package crud
 
 import (
 	"errors"
+	"sync"
 
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 type User struct {
-	ID       int64  `gorm:"column:id;type:bigserial;primary_key" json:"-"`
-	Username string `gorm:"column:username;type:varchar(240);unique" json:"username" validate:"required"`
+	ID           int64  `gorm:"column:id;type:bigserial;primary_key" json:"-"`
+	Username     string `gorm:"column:username;type:varchar(240);unique" json:"username" validate:"required"`
+	PasswordHash string `gorm:"column:password_hash;type:varchar(60)" json:"-"`
 }
 
 func (c *User) TableName() string {
@@ -51,3 +54,30 @@ func CreateUser(db *gorm.DB, user User) error {
 		return result.Error
 	})
 }
+
+// HashPassword ... bcrypt hash of password to be stored in User.PasswordHash
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+var (
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+// CheckPassword ... unknown (nil) users and users without credentials never match, a hash is
+// still compared so that response times do not tell which usernames exist
+func CheckPassword(user *User, password string) bool {
+	if user == nil || user.PasswordHash == "" {
+		dummyHashOnce.Do(func() {
+			dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+		})
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil
+}
@@ -0,0 +1,217 @@
+package crud
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// WebhookScopeUser ... messages received by the owner of the webhook
+	WebhookScopeUser = "user"
+	// WebhookScopeGroup ... messages sent to the group of the webhook
+	WebhookScopeGroup = "group"
+	// WebhookScopeGlobal ... every message, restricted to the admins of the api
+	WebhookScopeGlobal = "global"
+
+	// WebhookEventMessage ... a message was delivered
+	WebhookEventMessage = "message.created"
+
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+	// WebhookDeliveryCanceled ... its message expired or was deleted before it could be sent
+	WebhookDeliveryCanceled = "canceled"
+)
+
+type Webhook struct {
+	ID      int64  `gorm:"column:id;type:bigserial;primary_key"`
+	OwnerID int64  `gorm:"column:owner_id;integer"`
+	Owner   *User  `gorm:"foreignKey:owner_id"`
+	Scope   string `gorm:"column:scope;text"`
+	GroupID *int64 `gorm:"column:group_id;integer"`
+	Group   *Group `gorm:"foreignKey:group_id"`
+	URL     string `gorm:"column:url;text"`
+	// Secret ... key of the HMAC signature of the payloads, handed to the owner on creation
+	Secret string `gorm:"column:secret;text"`
+	// FailureCount ... failed attempts in a row, the webhook is disabled past a threshold
+	FailureCount int        `gorm:"column:failure_count;integer"`
+	DisabledAt   *time.Time `gorm:"column:disabled_at;type:timestamp with time zone"`
+	CreatedAt    time.Time  `gorm:"column:created_at;type:timestamp with time zone"`
+}
+
+func (w *Webhook) TableName() string {
+	return "public.webhook"
+}
+
+// WebhookDelivery ... message queued for a webhook along with the outcome of its last attempt, the payload
+// is rendered from the message when sending. Deliveries are kept once done as the delivery log of the webhook
+type WebhookDelivery struct {
+	ID        int64    `gorm:"column:id;type:bigserial;primary_key"`
+	WebhookID int64    `gorm:"column:webhook_id;integer"`
+	Webhook   *Webhook `gorm:"foreignKey:webhook_id"`
+	MessageID *int64   `gorm:"column:message_id;bigint"` // none once the message is deleted
+	Event     string   `gorm:"column:event;text"`
+	Status    string   `gorm:"column:status;text"`
+	Attempts  int      `gorm:"column:attempts;integer"`
+	// NextAttemptAt ... only set while pending
+	NextAttemptAt  *time.Time `gorm:"column:next_attempt_at;type:timestamp with time zone"`
+	LastAttemptAt  *time.Time `gorm:"column:last_attempt_at;type:timestamp with time zone"`
+	LastStatusCode *int       `gorm:"column:last_status_code;integer"`
+	LastError      string     `gorm:"column:last_error;text"`
+	CreatedAt      time.Time  `gorm:"column:created_at;type:timestamp with time zone"`
+}
+
+func (d *WebhookDelivery) TableName() string {
+	return "public.webhook_delivery"
+}
+
+// CreateWebhook ... generates the secret of webhook, its group must exist
+func CreateWebhook(db *gorm.DB, webhook *Webhook) error {
+	secret, err := newToken()
+	if err != nil {
+		return err
+	}
+	webhook.Secret = secret
+	return db.Omit(clause.Associations).Create(webhook).Error
+}
+
+// GetWebhook ... webhook id if it belongs to owner
+func GetWebhook(db *gorm.DB, ownerID int64, id int64) (*Webhook, bool, error) {
+	var webhook Webhook
+	err := db.Preload("Group").Where("owner_id = ? and id = ?", ownerID, id).First(&webhook).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &webhook, true, nil
+}
+
+func GetUserWebhooks(db *gorm.DB, ownerID int64) ([]Webhook, error) {
+	webhooks := []Webhook{}
+	err := db.Preload("Group").Where("owner_id = ?", ownerID).Order("id").Find(&webhooks).Error
+	return webhooks, err
+}
+
+// DeleteWebhook ... its deliveries, pending or not, go with it
+func DeleteWebhook(db *gorm.DB, webhook *Webhook) error {
+	return db.Delete(webhook).Error
+}
+
+// EnableWebhook ... clear the failures of a disabled webhook, its pending deliveries resume
+func EnableWebhook(db *gorm.DB, webhook *Webhook) error {
+	webhook.DisabledAt = nil
+	webhook.FailureCount = 0
+	return db.Model(webhook).Select("disabled_at", "failure_count").Updates(webhook).Error
+}
+
+// queueSQL ... a pending delivery of @message for every enabled webhook interested in it, group webhooks
+// only while their owner still manages the group. Admins of global webhooks are checked when sending
+const queueSQL = `insert into public.webhook_delivery (webhook_id, message_id, event, status, attempts, next_attempt_at, last_error, created_at)
+select webhook.id, @message, @event, 'pending', 0, @now, '', @now from public.webhook
+where webhook.disabled_at is null and (
+	webhook.scope = 'global'
+	or (webhook.scope = 'group' and webhook.group_id in (
+		select message_recipient.group_id from public.message_recipient where message_recipient.message_id = @message
+	) and exists (
+		select 1 from public.user_group where user_group.group_id = webhook.group_id
+		and user_group.user_id = webhook.owner_id and user_group.role in ('owner', 'admin')
+	))
+	or (webhook.scope = 'user' and webhook.owner_id in (` + readersSQL + `))
+)`
+
+// QueueWebhookDeliveries ... queue a delivery of each message in messageIDs, once delivered, for every
+// webhook interested in it. Call it in the transaction delivering the messages
+func QueueWebhookDeliveries(db *gorm.DB, messageIDs []int64) error {
+	now := time.Now().UTC()
+	for _, messageID := range messageIDs {
+		err := db.Exec(queueSQL, sql.Named("message", messageID), sql.Named("event", WebhookEventMessage), sql.Named("now", now)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueCreatedMessage ... queue message for the webhooks in the transaction creating it so that they never
+// miss it, unless it is scheduled in which case it is queued once delivered
+func queueCreatedMessage(db *gorm.DB, message *Message) error {
+	if message.SendAt != nil {
+		return nil
+	}
+	return QueueWebhookDeliveries(db, []int64{message.ID})
+}
+
+// claimSQL ... push back the due deliveries by the lease so that no other replica picks them
+// while they are being sent, a delivery whose sender died is retried once the lease is over
+const claimSQL = `update public.webhook_delivery set next_attempt_at = @lease
+where webhook_delivery.id in (
+	select webhook_delivery.id from public.webhook_delivery
+	join public.webhook on webhook.id = webhook_delivery.webhook_id
+	where webhook_delivery.status = 'pending' and webhook_delivery.next_attempt_at <= @now and webhook.disabled_at is null
+	order by webhook_delivery.next_attempt_at
+	limit @limit
+	for update of webhook_delivery skip locked
+)
+returning webhook_delivery.id`
+
+// ClaimWebhookDeliveries ... up to limit deliveries due at now with their webhook and its owner, held until leaseEnd
+func ClaimWebhookDeliveries(db *gorm.DB, now time.Time, leaseEnd time.Time, limit int) ([]WebhookDelivery, error) {
+	ids := []int64{}
+	err := db.Raw(claimSQL, sql.Named("now", now), sql.Named("lease", leaseEnd), sql.Named("limit", limit)).Scan(&ids).Error
+	if err != nil || len(ids) == 0 {
+		return []WebhookDelivery{}, err
+	}
+	deliveries := []WebhookDelivery{}
+	err = db.Preload("Webhook.Owner").Where("id in ?", ids).Order("id").Find(&deliveries).Error
+	return deliveries, err
+}
+
+// RecordWebhookAttempt ... save the outcome of an attempt, set on delivery by the caller, and count it
+// for the webhook of the delivery which is disabled after disableAfter failed attempts in a row
+func RecordWebhookAttempt(db *gorm.DB, delivery *WebhookDelivery, failed bool, disableAfter int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(delivery).
+			Select("status", "attempts", "next_attempt_at", "last_attempt_at", "last_status_code", "last_error").
+			Updates(delivery).Error
+		if err != nil {
+			return err
+		}
+		if !failed {
+			return tx.Model(&Webhook{}).Where("id = ?", delivery.WebhookID).Update("failure_count", 0).Error
+		}
+		return tx.Exec(
+			`update public.webhook set failure_count = failure_count + 1,
+			disabled_at = case when disabled_at is null and failure_count + 1 >= ? then ?::timestamptz else disabled_at end
+			where id = ?`,
+			disableAfter, delivery.LastAttemptAt, delivery.WebhookID,
+		).Error
+	})
+}
+
+// CancelWebhookDelivery ... give up delivery without sending it, it does not count as a failure of its webhook
+func CancelWebhookDelivery(db *gorm.DB, delivery *WebhookDelivery, reason string) error {
+	delivery.Status = WebhookDeliveryCanceled
+	delivery.NextAttemptAt = nil
+	delivery.LastError = reason
+	return db.Model(delivery).Select("status", "next_attempt_at", "last_error").Updates(delivery).Error
+}
+
+// PurgeWebhookDeliveries ... delete the deliveries done, whatever their outcome, created before cutoff,
+// returns how many were deleted
+func PurgeWebhookDeliveries(db *gorm.DB, cutoff time.Time) (int64, error) {
+	result := db.Where("status <> ? and created_at < ?", WebhookDeliveryPending, cutoff).Delete(&WebhookDelivery{})
+	return result.RowsAffected, result.Error
+}
+
+// GetWebhookDeliveries ... the limit latest deliveries of a webhook, latest first
+func GetWebhookDeliveries(db *gorm.DB, webhookID int64, limit int) ([]WebhookDelivery, error) {
+	deliveries := []WebhookDelivery{}
+	err := db.Where("webhook_id = ?", webhookID).Order("id desc").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
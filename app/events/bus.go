@@ -0,0 +1,35 @@
+package events
+
+import "context"
+
+// Bus ... carries the events published by any replica of the api to the subscriptions of this one
+type Bus interface {
+	Publish(ctx context.Context, events ...Event) error
+	// Subscribe ... see Hub.Subscribe
+	Subscribe(userID int64, buffer int) *Subscription
+	// Close ... end every subscription with ErrHubClosed
+	Close() error
+}
+
+// MemoryBus ... only reaches the subscriptions of the process, enough for a single replica and tests
+type MemoryBus struct {
+	hub *Hub
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{hub: NewHub()}
+}
+
+func (b *MemoryBus) Publish(ctx context.Context, events ...Event) error {
+	b.hub.Publish(events...)
+	return nil
+}
+
+func (b *MemoryBus) Subscribe(userID int64, buffer int) *Subscription {
+	return b.hub.Subscribe(userID, buffer)
+}
+
+func (b *MemoryBus) Close() error {
+	b.hub.Close()
+	return nil
+}
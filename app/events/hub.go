@@ -0,0 +1,146 @@
+package events
+
+import (
+	"errors"
+	"sync"
+)
+
+const (
+	// KindMessage ... a message was delivered to the user
+	KindMessage = "message"
+	// KindReply ... a reply was delivered to the user
+	KindReply = "reply"
+	// KindRead ... the user read a message, or their whole mailbox without MessageID
+	KindRead = "read"
+	// KindUnread ... the user marked a message, or their whole mailbox without MessageID, unread
+	KindUnread = "unread"
+	// KindDelete ... a message left the mailbox, moved to the trash or deleted for everyone
+	KindDelete = "delete"
+)
+
+var (
+	// ErrSlowConsumer ... the subscriber did not keep up and missed events
+	ErrSlowConsumer = errors.New("subscriber is too slow")
+	// ErrHubClosed ... the hub was closed, the api is shutting down
+	ErrHubClosed = errors.New("hub is closed")
+	// ErrEventsLost ... events may have been published without reaching the subscriber
+	ErrEventsLost = errors.New("events were lost")
+)
+
+// Event ... something happened in the mailbox of UserID, subscribers load what
+// they need to render it so that every user only sees their own view of a message
+type Event struct {
+	// ID ... position of the event in the mailbox of the user, zero when it was not persisted
+	ID        int64  `json:"id,omitempty"`
+	UserID    int64  `json:"user_id"`
+	Kind      string `json:"kind"`
+	MessageID int64  `json:"message_id,omitempty"`
+}
+
+// Subscription ... events of one user, typically for one connection
+type Subscription struct {
+	hub    *Hub
+	userID int64
+	events chan Event
+	err    error
+}
+
+// Events ... closed when the subscription ends, Err tells why
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Err ... nil while the subscription is running or after Close
+func (s *Subscription) Err() error {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.err
+}
+
+// Close ... stop receiving events, closing twice is a no-op
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s, nil)
+}
+
+// Hub ... fans events out to the subscriptions of their user within the process.
+// Publishing never blocks: a subscription whose buffer is full is ended with
+// ErrSlowConsumer and its client is expected to reconnect and catch up
+type Hub struct {
+	mu            sync.Mutex
+	subscriptions map[int64]map[*Subscription]struct{}
+	closed        bool
+}
+
+func NewHub() *Hub {
+	return &Hub{subscriptions: map[int64]map[*Subscription]struct{}{}}
+}
+
+// Subscribe ... events of user, up to buffer of them are queued for a slow reader
+func (h *Hub) Subscribe(userID int64, buffer int) *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := &Subscription{hub: h, userID: userID, events: make(chan Event, buffer)}
+	if h.closed {
+		s.err = ErrHubClosed
+		close(s.events)
+		return s
+	}
+	if h.subscriptions[userID] == nil {
+		h.subscriptions[userID] = map[*Subscription]struct{}{}
+	}
+	h.subscriptions[userID][s] = struct{}{}
+	return s
+}
+
+func (h *Hub) Publish(events ...Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, event := range events {
+		for s := range h.subscriptions[event.UserID] {
+			select {
+			case s.events <- event:
+			default:
+				h.remove(s, ErrSlowConsumer)
+			}
+		}
+	}
+}
+
+// Interrupt ... end every subscription with err, the hub keeps accepting new ones
+func (h *Hub) Interrupt(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, subscriptions := range h.subscriptions {
+		for s := range subscriptions {
+			h.remove(s, err)
+		}
+	}
+}
+
+// Close ... end every subscription with ErrHubClosed, later subscriptions end right away
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for _, subscriptions := range h.subscriptions {
+		for s := range subscriptions {
+			h.remove(s, ErrHubClosed)
+		}
+	}
+}
+
+// remove ... end s with err, h.mu must be held
+func (h *Hub) remove(s *Subscription, err error) {
+	subscriptions := h.subscriptions[s.userID]
+	if _, ok := subscriptions[s]; !ok {
+		return
+	}
+	delete(subscriptions, s)
+	if len(subscriptions) == 0 {
+		delete(h.subscriptions, s.userID)
+	}
+	s.err = err
+	close(s.events)
+}
@@ -0,0 +1,144 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const (
+	// pgChannel ... notification channel shared by the replicas
+	pgChannel = "mailbox_events"
+	// pgNotifyBatch ... events per notification, payloads are limited to 8000 bytes
+	pgNotifyBatch = 50
+	pgRetryMin    = time.Second
+	pgRetryMax    = 30 * time.Second
+)
+
+// PostgresBus ... publishes events with NOTIFY and feeds the ones LISTENed to, including its own,
+// to a local hub. Notifications sent inside a transaction are only delivered once it commits.
+// Notifications are not queued while the listener is disconnected, the subscriptions are then
+// ended with ErrEventsLost so that their clients resume from the stored events
+type PostgresBus struct {
+	db        *gorm.DB
+	dsn       string
+	logger    *log.Logger
+	hub       *Hub
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewPostgresBus ... start listening with a connection of its own, next to the pool of db
+func NewPostgresBus(ctx context.Context, db *gorm.DB, logger *log.Logger) (*PostgresBus, error) {
+	dialector, ok := db.Dialector.(*postgres.Dialector)
+	if !ok {
+		return nil, errors.New("the event bus needs a postgres database")
+	}
+	b := &PostgresBus{db: db, dsn: dialector.DSN, logger: logger, hub: NewHub(), done: make(chan struct{})}
+	conn, err := b.listen(ctx)
+	if err != nil {
+		return nil, err
+	}
+	listenCtx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+	go b.run(listenCtx, conn)
+	return b, nil
+}
+
+func (b *PostgresBus) listen(ctx context.Context) (*pgx.Conn, error) {
+	conn, err := pgx.Connect(ctx, b.dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = conn.Exec(ctx, "listen "+pgChannel); err != nil {
+		conn.Close(ctx)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// run ... deliver the notifications received on conn, reconnect when it breaks until ctx is done
+func (b *PostgresBus) run(ctx context.Context, conn *pgx.Conn) {
+	defer close(b.done)
+	retry := pgRetryMin
+	for {
+		err := b.receive(ctx, conn)
+		conn.Close(context.Background())
+		if ctx.Err() != nil {
+			return
+		}
+		b.logger.Printf("Event bus listener disconnected: %v\n", err)
+		b.hub.Interrupt(ErrEventsLost)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retry):
+			}
+			conn, err = b.listen(ctx)
+			if err == nil {
+				retry = pgRetryMin
+				break
+			}
+			b.logger.Printf("Event bus failed to listen: %v\n", err)
+			if retry *= 2; retry > pgRetryMax {
+				retry = pgRetryMax
+			}
+		}
+	}
+}
+
+func (b *PostgresBus) receive(ctx context.Context, conn *pgx.Conn) error {
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var events []Event
+		if err = json.Unmarshal([]byte(notification.Payload), &events); err != nil {
+			b.logger.Printf("Event bus dropped a malformed notification: %v\n", err)
+			continue
+		}
+		b.hub.Publish(events...)
+	}
+}
+
+func (b *PostgresBus) Publish(ctx context.Context, events ...Event) error {
+	db := b.db.WithContext(ctx)
+	for start := 0; start < len(events); start += pgNotifyBatch {
+		end := start + pgNotifyBatch
+		if end > len(events) {
+			end = len(events)
+		}
+		payload, err := json.Marshal(events[start:end])
+		if err != nil {
+			return err
+		}
+		if err = db.Exec("select pg_notify(?, ?)", pgChannel, string(payload)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *PostgresBus) Subscribe(userID int64, buffer int) *Subscription {
+	return b.hub.Subscribe(userID, buffer)
+}
+
+// Close ... stop listening, then end the subscriptions
+func (b *PostgresBus) Close() error {
+	b.closeOnce.Do(func() {
+		b.cancel()
+		<-b.done
+		b.hub.Close()
+	})
+	return nil
+}
@@ -1,12 +1,18 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/config"
+	"github.com/aorticweb/msg-app/app/events"
+	m "github.com/aorticweb/msg-app/app/model"
+	"github.com/aorticweb/msg-app/app/storage"
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
 	"gorm.io/gorm"
@@ -19,14 +25,47 @@ type API struct {
 	router   *mux.Router
 	logger   *log.Logger
 	validate *validator.Validate
+	config   config.Config
+	blobs    storage.BlobStore
+	// bus ... events of every replica, published by this one on message creation and state changes
+	bus events.Bus
+	// streams ... connections pushing events to clients, they outlive their request
+	streams sync.WaitGroup
 }
 
-func NewAPI(db *gorm.DB, logger *log.Logger) *API {
-	a := &API{db, mux.NewRouter(), logger, validator.New()}
+func NewAPI(db *gorm.DB, logger *log.Logger, cfg config.Config, blobs storage.BlobStore, bus events.Bus) *API {
+	a := &API{
+		db:       db,
+		router:   mux.NewRouter(),
+		logger:   logger,
+		validate: m.NewValidator(),
+		config:   cfg,
+		blobs:    blobs,
+		bus:      bus,
+	}
 	a.routes()
 	return a
 }
 
+// Shutdown ... close the event bus and wait for the event streams to say goodbye to their clients,
+// http.Server.Shutdown does not track them
+func (a *API) Shutdown(ctx context.Context) error {
+	if err := a.bus.Close(); err != nil {
+		a.logger.Println(c.WrapError("failed to close event bus", err))
+	}
+	done := make(chan struct{})
+	go func() {
+		a.streams.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	a.router.ServeHTTP(w, r)
 }
@@ -34,10 +73,19 @@ func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func (a *API) middleware(next HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		startTime := time.Now()
-		resp := next(w, r)
+		r, resp := a.authenticate(r)
+		if resp == nil {
+			resp = next(w, r)
+		}
 		defer func() {
 			a.logger.Printf("[%s] %s response [%d]: %s", r.Method, r.URL.Path, resp.Code, time.Now().Sub(startTime))
 		}()
+		if resp.Written {
+			if resp.Err != nil {
+				a.logger.Println(resp.Err)
+			}
+			return
+		}
 		if http.StatusOK <= resp.Code && resp.Code < 300 {
 			a.okResponse(w, resp.Code, resp.Data)
 			return
@@ -45,6 +93,9 @@ func (a *API) middleware(next HandlerFunc) http.HandlerFunc {
 		if resp.Err != nil {
 			a.logger.Println(resp.Err)
 		}
+		if resp.Code == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+		}
 		if resp.Message != "" {
 			http.Error(w, resp.Message, resp.Code)
 			return
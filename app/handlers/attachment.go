@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+	m "github.com/aorticweb/msg-app/app/model"
+	"github.com/aorticweb/msg-app/app/policy"
+	"github.com/aorticweb/msg-app/app/storage"
+)
+
+// storeUpload ... put upload in the blob store as an attachment of message messageID
+func (a *API) storeUpload(ctx context.Context, messageID int64, upload *m.AttachmentUpload, createdAt time.Time) (*crud.Attachment, error) {
+	key, err := crud.NewAttachmentKey(messageID)
+	if err != nil {
+		return nil, c.WrapError("failed to generate attachment key", err)
+	}
+	content, err := upload.Content()
+	if err != nil {
+		return nil, c.WrapError("failed to read spooled attachment", err)
+	}
+	if err = a.blobs.Put(ctx, key, content, upload.Size, upload.ContentType); err != nil {
+		return nil, c.WrapError("failed to store attachment", err)
+	}
+	return &crud.Attachment{
+		MessageID:   messageID,
+		Filename:    upload.Filename,
+		ContentType: upload.ContentType,
+		Size:        upload.Size,
+		SHA256:      upload.SHA256,
+		StorageKey:  key,
+		CreatedAt:   createdAt,
+	}, nil
+}
+
+// storeUploads ... put uploads in the blob store as attachments of message messageID, nothing is left
+// behind when one of them fails
+func (a *API) storeUploads(ctx context.Context, messageID int64, uploads []*m.AttachmentUpload, createdAt time.Time) ([]crud.Attachment, error) {
+	attachments := []crud.Attachment{}
+	for _, upload := range uploads {
+		attachment, err := a.storeUpload(ctx, messageID, upload, createdAt)
+		if err != nil {
+			a.deleteBlobs(ctx, attachments)
+			return nil, err
+		}
+		attachments = append(attachments, *attachment)
+	}
+	return attachments, nil
+}
+
+// handleAttachmentPost ... readers are told about a message when it is delivered so files can only be
+// attached to a scheduled message, the others are composed with their attachments
+func (a *API) handleAttachmentPost() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		dbMessage, badResp := a.messageFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		// attaching a file is an edit of the message
+		badResp = policy.AuthorizeMessageEdit(authenticatedUser(r), dbMessage, a.config.EditWindow)
+		if badResp != nil {
+			return badResp
+		}
+		alreadySent := c.NewBadResponse(http.StatusConflict, "message was already sent, attach files when composing it", nil)
+		if dbMessage.SendAt == nil {
+			return alreadySent
+		}
+		upload, badResp := m.AttachmentUploadFromRequest(w, r, a.config.AttachmentMaxSize, a.config.AttachmentTypes)
+		if badResp != nil {
+			return badResp
+		}
+		defer upload.Close()
+		attachment, err := a.storeUpload(r.Context(), dbMessage.ID, upload, time.Now().UTC())
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", err)
+		}
+		err = crud.CreateAttachment(a.db, attachment)
+		if err != nil {
+			a.deleteBlobs(r.Context(), []crud.Attachment{*attachment})
+			if errors.Is(err, crud.ErrNotScheduled) {
+				return alreadySent
+			}
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to create attachment", err))
+		}
+		return c.NewGoodResponse(http.StatusCreated, m.ResponseAttachmentFromDBAttachment(attachment))
+	}
+}
+
+// attachmentFromRequest ... attachment identified in the route, readable by whoever can read its message
+func (a *API) attachmentFromRequest(r *http.Request) (*crud.Attachment, *c.APIResponse) {
+	dbMessage, badResp := a.messageFromRequest(r)
+	if badResp != nil {
+		return nil, badResp
+	}
+	if dbMessage.DeletedAt != nil {
+		return nil, c.NewBadResponse(http.StatusGone, "message was deleted", nil)
+	}
+	attachmentID, err := c.GetAttachmentIDFromRequest(r)
+	if err != nil {
+		return nil, &c.InvalidRequestResponse
+	}
+	attachment, exist, err := crud.GetAttachment(a.db, dbMessage.ID, attachmentID)
+	if err != nil {
+		return nil, c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query attachment", err))
+	}
+	if !exist {
+		return nil, c.NewBadResponse(http.StatusNotFound, "attachment not found", nil)
+	}
+	return attachment, nil
+}
+
+func (a *API) handleAttachmentGet() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		attachment, badResp := a.attachmentFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		blob, err := a.blobs.Get(r.Context(), attachment.StorageKey)
+		if errors.Is(err, storage.ErrBlobNotFound) {
+			return c.NewBadResponse(http.StatusNotFound, "attachment not found", c.WrapError("attachment blob is missing", err))
+		}
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to fetch attachment", err))
+		}
+		defer blob.Close()
+
+		header := w.Header()
+		header.Set("Content-Type", attachment.ContentType)
+		header.Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+		header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("ETag", `"`+attachment.SHA256+`"`)
+		if sum, err := hex.DecodeString(attachment.SHA256); err == nil {
+			header.Set("Digest", "sha-256="+base64.StdEncoding.EncodeToString(sum))
+		}
+		w.WriteHeader(http.StatusOK)
+		_, err = io.Copy(w, blob)
+		if err != nil {
+			return c.NewWrittenResponse(http.StatusOK, c.WrapError("failed to send attachment", err))
+		}
+		return c.NewWrittenResponse(http.StatusOK, nil)
+	}
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+	m "github.com/aorticweb/msg-app/app/model"
+)
+
+var authTokenTTL time.Duration = 24 * time.Hour
+
+type contextKey int
+
+const userContextKey contextKey = iota
+
+var unauthorizedResponse c.APIResponse = *c.NewBadResponse(http.StatusUnauthorized, "authentication required", nil)
+
+// bearerToken ... token from a Bearer Authorization header, ok is false when there is none. Other
+// schemes, e.g. the basic auth of a proxy in front of the api, leave the request anonymous
+func bearerToken(r *http.Request) (string, bool) {
+	parts := strings.SplitN(strings.TrimSpace(r.Header.Get("Authorization")), " ", 2)
+	if !strings.EqualFold(parts[0], "Bearer") {
+		return "", false
+	}
+	if len(parts) == 1 {
+		return "", true
+	}
+	return strings.TrimSpace(parts[1]), true
+}
+
+// authenticate ... attach the user owning the bearer token to the request context
+// requests without an Authorization header are left anonymous
+func (a *API) authenticate(r *http.Request) (*http.Request, *c.APIResponse) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return r, nil
+	}
+	if token == "" {
+		return r, &unauthorizedResponse
+	}
+	user, exist, err := crud.FindUserByToken(a.db, token)
+	if err != nil {
+		return r, c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query auth token", err))
+	}
+	if !exist {
+		return r, &unauthorizedResponse
+	}
+	return r.WithContext(context.WithValue(r.Context(), userContextKey, user)), nil
+}
+
+// streamToken ... browsers cannot set headers on WebSocket and EventSource connections, streams
+// also accept the token in the access_token query parameter
+func streamToken(r *http.Request) string {
+	if token, ok := bearerToken(r); ok {
+		return token
+	}
+	return r.URL.Query().Get("access_token")
+}
+
+// streamAuth ... authenticate a stream request from its access_token when it has no Authorization header
+func (a *API) streamAuth(next HandlerFunc) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		token := streamToken(r)
+		if authenticatedUser(r) != nil || token == "" {
+			return next(w, r)
+		}
+		user, exist, err := crud.FindUserByToken(a.db, token)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query auth token", err))
+		}
+		if !exist {
+			return &unauthorizedResponse
+		}
+		return next(w, r.WithContext(context.WithValue(r.Context(), userContextKey, user)))
+	}
+}
+
+// authenticatedUser ... user attached by authenticate, nil for anonymous requests
+func authenticatedUser(r *http.Request) *crud.User {
+	user, _ := r.Context().Value(userContextKey).(*crud.User)
+	return user
+}
+
+// auth ... reject anonymous requests
+func (a *API) auth(next HandlerFunc) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		if authenticatedUser(r) == nil {
+			return &unauthorizedResponse
+		}
+		return next(w, r)
+	}
+}
+
+func (a *API) handleLoginPost() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		var credentials m.Credentials
+		err := json.NewDecoder(r.Body).Decode(&credentials)
+		if err != nil {
+			return c.NewBadResponse(http.StatusBadRequest, "invalid request", c.WrapError("JSON decoding error", err))
+		}
+		if err = a.validate.Struct(credentials); err != nil {
+			return &c.InvalidRequestResponse
+		}
+		// user is nil when unknown, the password is checked all the same
+		user, _, err := crud.FindUser(a.db, credentials.Username)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query user", err))
+		}
+		if !crud.CheckPassword(user, credentials.Password) {
+			return c.NewBadResponse(http.StatusUnauthorized, "invalid username or password", nil)
+		}
+		token, authToken, err := crud.CreateAuthToken(a.db, user.ID, authTokenTTL)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to create auth token", err))
+		}
+		return c.NewGoodResponse(http.StatusCreated, m.AuthToken{Token: token, ExpiresAt: authToken.ExpiresAt})
+	}
+}
+
+func (a *API) handleLogoutPost() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		token, _ := bearerToken(r)
+		err := crud.DeleteAuthToken(a.db, token)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to delete auth token", err))
+		}
+		return c.NewGoodResponse(http.StatusNoContent, nil)
+	}
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+	m "github.com/aorticweb/msg-app/app/model"
+)
+
+// draftFromRequest ... draft identified in the route, only its owner can see it
+func (a *API) draftFromRequest(r *http.Request) (*crud.Draft, *c.APIResponse) {
+	draftID, err := c.GetIDFromRequest(r)
+	if err != nil {
+		return nil, &c.InvalidRequestResponse
+	}
+	draft, exist, err := crud.GetDraft(a.db, authenticatedUser(r).ID, draftID)
+	if err != nil {
+		return nil, c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query draft", err))
+	}
+	if !exist {
+		return nil, c.NewBadResponse(http.StatusNotFound, "draft not found", nil)
+	}
+	return draft, nil
+}
+
+func (a *API) handleDraftPost() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		var draftInput m.DraftPost
+		err := json.NewDecoder(r.Body).Decode(&draftInput)
+		if err != nil {
+			return c.NewBadResponse(http.StatusBadRequest, "invalid request", c.WrapError("JSON decoding error", err))
+		}
+		draft := draftInput.ToDBDraft(authenticatedUser(r))
+		err = crud.CreateDraft(a.db, draft)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to create draft", err))
+		}
+		return c.NewGoodResponse(http.StatusCreated, m.ResponseDraftFromDBDraft(draft))
+	}
+}
+
+func (a *API) handleDraftsGet() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		page, badResp := m.PageFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		drafts, next, err := crud.GetUserDrafts(a.db, authenticatedUser(r).ID, *page)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query drafts", err))
+		}
+		return c.NewGoodResponse(http.StatusOK, m.ResponseDraftsFromDBDrafts(drafts, next))
+	}
+}
+
+func (a *API) handleDraftGet() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		draft, badResp := a.draftFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		return c.NewGoodResponse(http.StatusOK, m.ResponseDraftFromDBDraft(draft))
+	}
+}
+
+func (a *API) handleDraftPatch() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		draft, badResp := a.draftFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		var patchInput m.DraftPatch
+		err := json.NewDecoder(r.Body).Decode(&patchInput)
+		if err != nil {
+			return c.NewBadResponse(http.StatusBadRequest, "invalid request", c.WrapError("JSON decoding error", err))
+		}
+		patchInput.Apply(draft)
+		err = crud.UpdateDraft(a.db, draft)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to update draft", err))
+		}
+		return c.NewGoodResponse(http.StatusOK, m.ResponseDraftFromDBDraft(draft))
+	}
+}
+
+func (a *API) handleDraftDelete() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		draft, badResp := a.draftFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		err := crud.DeleteDraft(a.db, draft)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to delete draft", err))
+		}
+		return c.NewGoodResponse(http.StatusNoContent, nil)
+	}
+}
+
+// handleDraftSendPost ... the draft goes through the validation of POST /messages and
+// is replaced by the message it turns into
+func (a *API) handleDraftSendPost() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		draft, badResp := a.draftFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		messageInput := m.ComposedMessageFromDBDraft(draft)
+		if err := a.validate.Struct(messageInput); err != nil {
+			return c.NewBadResponse(http.StatusBadRequest, "draft is incomplete", nil)
+		}
+		user := authenticatedUser(r)
+		message, badResp := messageInput.Validate(a.db, user)
+		if badResp != nil {
+			return badResp
+		}
+		dbMessage, err := crud.SendDraft(a.db, draft, message)
+		if errors.Is(err, crud.ErrDraftChanged) {
+			return c.NewBadResponse(http.StatusConflict, "draft was changed while being sent", nil)
+		}
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to send draft", err))
+		}
+		a.publishMessage(dbMessage)
+		return c.NewGoodResponse(http.StatusAccepted, m.ResponseMessageFromDBMessage(dbMessage, user.ID))
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/events"
+	m "github.com/aorticweb/msg-app/app/model"
+)
+
+// publish ... store published for the streams to replay, then send them to the clients connected
+// to any replica. Failing to do so does not fail the request, clients catch up from their mailbox
+func (a *API) publish(published []events.Event) {
+	if err := crud.PublishEvents(context.Background(), a.db, a.bus, published); err != nil {
+		a.logger.Println(c.WrapError("failed to publish mailbox events", err))
+	}
+}
+
+// publishMessage ... tell every reader of a delivered message about it, the webhooks got it queued
+// when it was created
+func (a *API) publishMessage(msg *crud.Message) {
+	if msg.SendAt != nil {
+		return
+	}
+	delivered, err := crud.DeliveredEvents(a.db, []int64{msg.ID})
+	if err != nil {
+		a.logger.Println(c.WrapError("failed to query message readers", err))
+		return
+	}
+	a.publish(delivered)
+}
+
+// publishState ... kind happened to messageIDs in the mailbox of user, to the whole mailbox without messageIDs
+func (a *API) publishState(userID int64, kind string, messageIDs []int64) {
+	if len(messageIDs) == 0 {
+		a.publish([]events.Event{{UserID: userID, Kind: kind}})
+		return
+	}
+	published := make([]events.Event, 0, len(messageIDs))
+	for _, id := range messageIDs {
+		published = append(published, events.Event{UserID: userID, Kind: kind, MessageID: id})
+	}
+	a.publish(published)
+}
+
+// publishDeleteForEveryone ... the message left the mailbox of its sender and of every reader
+func (a *API) publishDeleteForEveryone(msg *crud.Message) {
+	readers, err := crud.GetMessageReaders(a.db, msg.ID)
+	if err != nil {
+		a.logger.Println(c.WrapError("failed to query message readers", err))
+		return
+	}
+	published := []events.Event{}
+	if msg.SenderID != nil {
+		published = append(published, events.Event{UserID: *msg.SenderID, Kind: events.KindDelete, MessageID: msg.ID})
+	}
+	for _, reader := range readers {
+		if msg.SenderID == nil || reader != *msg.SenderID {
+			published = append(published, events.Event{UserID: reader, Kind: events.KindDelete, MessageID: msg.ID})
+		}
+	}
+	a.publish(published)
+}
+
+// renderEvent ... event as seen by user, ok is false when there is nothing left to show
+// e.g. the message expired since or user can no longer read it after leaving its group
+func (a *API) renderEvent(user *crud.User, event events.Event) (*m.MailboxEvent, bool, error) {
+	rendered := m.MailboxEvent{ID: event.ID, Kind: event.Kind, MessageID: event.MessageID}
+	if event.Kind != events.KindMessage && event.Kind != events.KindReply {
+		return &rendered, true, nil
+	}
+	dbMessage, exist, err := crud.GetMessage(a.db, event.MessageID, crud.WithReadState(user.ID))
+	if err != nil || !exist {
+		return nil, false, err
+	}
+	visible, err := crud.IsMessageVisible(a.db, dbMessage.ID, user.ID)
+	if err != nil || !visible {
+		return nil, false, err
+	}
+	rendered.Message = m.ResponseMessageFromDBMessage(dbMessage, user.ID)
+	return &rendered, true, nil
+}
+
+// eventFromDBEvent ... stored event as it was published
+func eventFromDBEvent(dbEvent *crud.MailboxEvent) events.Event {
+	event := events.Event{ID: dbEvent.ID, UserID: dbEvent.UserID, Kind: dbEvent.Kind}
+	if dbEvent.MessageID != nil {
+		event.MessageID = *dbEvent.MessageID
+	}
+	return event
+}
+
+// streamTokenValid ... whether the token a stream was opened with still authenticates its user,
+// streams outlive the request that checked it. A failing check keeps the stream open
+func (a *API) streamTokenValid(token string) bool {
+	_, valid, err := crud.FindUserByToken(a.db, token)
+	if err != nil {
+		a.logger.Println(c.WrapError("failed to query auth token", err))
+		return true
+	}
+	return valid
+}
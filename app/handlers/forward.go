@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+	m "github.com/aorticweb/msg-app/app/model"
+	"github.com/aorticweb/msg-app/app/storage"
+)
+
+func (a *API) handleMessageForwardPost() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		original, badResp := a.messageFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		if original.DeletedAt != nil {
+			return c.NewBadResponse(http.StatusGone, "cannot forward a deleted message", nil)
+		}
+		if original.SendAt != nil {
+			return c.NewBadResponse(http.StatusConflict, "cannot forward a message that is not sent yet", nil)
+		}
+		var forwardInput m.ForwardPost
+		err := json.NewDecoder(r.Body).Decode(&forwardInput)
+		if err != nil {
+			return c.NewBadResponse(http.StatusBadRequest, "invalid request", c.WrapError("JSON decoding error", err))
+		}
+		if err = a.validate.Struct(forwardInput); err != nil {
+			return &c.InvalidRequestResponse
+		}
+		user := authenticatedUser(r)
+		message, badResp := forwardInput.Validate(a.db, user, original)
+		if badResp != nil {
+			return badResp
+		}
+		// the blobs are copied before the transaction so that it does not wait on the blob store
+		message.ID, err = crud.ReserveMessageID(a.db)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to reserve message id", err))
+		}
+		copies, err := a.copyAttachments(r.Context(), message.ID, original.Attachments)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to copy attachments", err))
+		}
+		dbMessage, err := crud.ForwardMessage(a.db, message, copies)
+		if err != nil {
+			a.deleteBlobs(r.Context(), copies)
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to forward message", err))
+		}
+		a.publishMessage(dbMessage)
+		return c.NewGoodResponse(http.StatusAccepted, m.ResponseMessageFromDBMessage(dbMessage, user.ID))
+	}
+}
+
+// copyAttachments ... copies of attachments for message messageID with their content copied under
+// new keys, nothing is left behind when one of them fails
+func (a *API) copyAttachments(ctx context.Context, messageID int64, attachments []crud.Attachment) ([]crud.Attachment, error) {
+	copies := []crud.Attachment{}
+	for _, original := range attachments {
+		key, err := crud.NewAttachmentKey(messageID)
+		if err != nil {
+			a.deleteBlobs(ctx, copies)
+			return nil, err
+		}
+		copies = append(copies, crud.Attachment{
+			Filename:    original.Filename,
+			ContentType: original.ContentType,
+			Size:        original.Size,
+			SHA256:      original.SHA256,
+			StorageKey:  key,
+		})
+		// a failed copy may have left part of the blob behind
+		if err = storage.Copy(ctx, a.blobs, original.StorageKey, key, original.Size, original.ContentType); err != nil {
+			a.deleteBlobs(ctx, copies)
+			return nil, err
+		}
+	}
+	return copies, nil
+}
+
+// deleteBlobs ... delete the content of attachments that were never saved
+func (a *API) deleteBlobs(ctx context.Context, attachments []crud.Attachment) {
+	for _, attachment := range attachments {
+		if err := a.blobs.Delete(ctx, attachment.StorageKey); err != nil {
+			a.logger.Println(c.WrapError("failed to delete orphan attachment", err))
+		}
+	}
+}
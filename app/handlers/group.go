@@ -2,11 +2,13 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	c "github.com/aorticweb/msg-app/app/common"
 	"github.com/aorticweb/msg-app/app/crud"
 	m "github.com/aorticweb/msg-app/app/model"
+	"github.com/aorticweb/msg-app/app/policy"
 )
 
 func (a *API) handleGroupPost() HandlerFunc {
@@ -36,10 +38,277 @@ func (a *API) handleGroupPost() HandlerFunc {
 			return c.NewBadResponse(http.StatusConflict, "group with the same Groupname already registered", nil)
 		}
 
-		_, err = crud.CreateGroup(a.db, groupInput.Groupname, users)
+		_, err = crud.CreateGroup(a.db, groupInput.Groupname, *authenticatedUser(r), users)
 		if err != nil {
 			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to create group", err))
 		}
 		return c.NewGoodResponse(http.StatusCreated, groupInput)
 	}
 }
+
+var lastOwnerResponse c.APIResponse = *c.NewBadResponse(http.StatusConflict, "the last owner of a group cannot leave it, transfer ownership first", nil)
+
+// groupFromRequest ... group named in the route along with the caller membership,
+// the caller must be a member
+func (a *API) groupFromRequest(r *http.Request) (*crud.Group, *crud.UserGroup, *c.APIResponse) {
+	groupname, err := c.GetGroupnameFromRequest(r)
+	if err != nil {
+		return nil, nil, &c.InvalidRequestResponse
+	}
+	group, exist, err := crud.FindGroup(a.db, groupname)
+	if err != nil {
+		return nil, nil, c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query group", err))
+	}
+	if !exist {
+		return nil, nil, c.NewBadResponse(http.StatusNotFound, "group with given groupname does not exist", nil)
+	}
+	membership, badResp := policy.AuthorizeGroupMember(a.db, authenticatedUser(r), group)
+	if badResp != nil {
+		return nil, nil, badResp
+	}
+	return group, membership, nil
+}
+
+// memberFromRequest ... membership of the user named in the route
+func (a *API) memberFromRequest(r *http.Request, group *crud.Group) (*crud.UserGroup, *c.APIResponse) {
+	username, err := c.GetUsernameFromRequest(r)
+	if err != nil {
+		return nil, &c.InvalidRequestResponse
+	}
+	return a.findMember(group, username)
+}
+
+func (a *API) findMember(group *crud.Group, username string) (*crud.UserGroup, *c.APIResponse) {
+	user, exist, err := crud.FindUser(a.db, username)
+	if err != nil {
+		return nil, c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query user", err))
+	}
+	if !exist {
+		return nil, c.NewBadResponse(http.StatusNotFound, "user is not a member of the group", nil)
+	}
+	membership, exist, err := crud.GetGroupMembership(a.db, group.ID, user.ID)
+	if err != nil {
+		return nil, c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query group membership", err))
+	}
+	if !exist {
+		return nil, c.NewBadResponse(http.StatusNotFound, "user is not a member of the group", nil)
+	}
+	return membership, nil
+}
+
+func (a *API) groupResponse(group *crud.Group) *c.APIResponse {
+	members, err := crud.GetGroupMembers(a.db, group.ID)
+	if err != nil {
+		return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query group members", err))
+	}
+	return c.NewGoodResponse(http.StatusOK, m.ResponseGroupFromDBGroup(group, members))
+}
+
+func (a *API) handleGroupGet() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		group, _, badResp := a.groupFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		return a.groupResponse(group)
+	}
+}
+
+func (a *API) handleGroupPatch() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		group, membership, badResp := a.groupFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		badResp = policy.AuthorizeGroupManage(membership)
+		if badResp != nil {
+			return badResp
+		}
+		var groupInput m.GroupPatch
+		err := json.NewDecoder(r.Body).Decode(&groupInput)
+		if err != nil {
+			return c.NewBadResponse(http.StatusBadRequest, "invalid request", c.WrapError("JSON decoding error", err))
+		}
+		if err = a.validate.Struct(groupInput); err != nil {
+			return &c.InvalidRequestResponse
+		}
+		badResp = groupInput.Validate()
+		if badResp != nil {
+			return badResp
+		}
+		update := crud.GroupUpdate{Groupname: groupInput.Groupname}
+		if groupInput.DefaultTTL != nil {
+			update.SetDefaultTTL = true
+			if *groupInput.DefaultTTL != 0 {
+				update.DefaultTTL = groupInput.DefaultTTL
+			}
+		}
+		err = crud.UpdateGroup(a.db, group, update)
+		if errors.Is(err, crud.ErrGroupnameTaken) {
+			return c.NewBadResponse(http.StatusConflict, "group with the same Groupname already registered", nil)
+		}
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to update group", err))
+		}
+		return a.groupResponse(group)
+	}
+}
+
+func (a *API) handleGroupDelete() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		group, membership, badResp := a.groupFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		badResp = policy.AuthorizeGroupManage(membership)
+		if badResp != nil {
+			return badResp
+		}
+		err := crud.DeleteGroup(a.db, group)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to delete group", err))
+		}
+		return c.NewGoodResponse(http.StatusNoContent, nil)
+	}
+}
+
+func (a *API) handleGroupMembersPost() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		group, membership, badResp := a.groupFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		badResp = policy.AuthorizeGroupManage(membership)
+		if badResp != nil {
+			return badResp
+		}
+		var membersInput m.GroupMembersPost
+		err := json.NewDecoder(r.Body).Decode(&membersInput)
+		if err != nil {
+			return c.NewBadResponse(http.StatusBadRequest, "invalid request", c.WrapError("JSON decoding error", err))
+		}
+		if err = a.validate.Struct(membersInput); err != nil {
+			return &c.InvalidRequestResponse
+		}
+		users, err := crud.FindUsers(a.db, membersInput.Usernames)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query users", err))
+		}
+		if len(users) != len(membersInput.Usernames) {
+			return c.NewBadResponse(http.StatusConflict, "one or more group member username does not exist", nil)
+		}
+		err = crud.AddGroupMembers(a.db, group.ID, users)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to add group members", err))
+		}
+		return a.groupResponse(group)
+	}
+}
+
+func (a *API) removeGroupMember(member *crud.UserGroup) *c.APIResponse {
+	removed, err := crud.RemoveGroupMember(a.db, member.GroupID, member.UserID)
+	if errors.Is(err, crud.ErrLastOwner) {
+		return &lastOwnerResponse
+	}
+	if err != nil {
+		return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to remove group member", err))
+	}
+	if !removed {
+		return c.NewBadResponse(http.StatusNotFound, "user is not a member of the group", nil)
+	}
+	return c.NewGoodResponse(http.StatusNoContent, nil)
+}
+
+func (a *API) handleGroupMemberDelete() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		group, membership, badResp := a.groupFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		member, badResp := a.memberFromRequest(r, group)
+		if badResp != nil {
+			return badResp
+		}
+		badResp = policy.AuthorizeMemberChange(membership, member)
+		if badResp != nil {
+			return badResp
+		}
+		return a.removeGroupMember(member)
+	}
+}
+
+func (a *API) handleGroupMemberPut() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		group, membership, badResp := a.groupFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		member, badResp := a.memberFromRequest(r, group)
+		if badResp != nil {
+			return badResp
+		}
+		badResp = policy.AuthorizeMemberChange(membership, member)
+		if badResp != nil {
+			return badResp
+		}
+		var memberInput m.GroupMemberPut
+		err := json.NewDecoder(r.Body).Decode(&memberInput)
+		if err != nil {
+			return c.NewBadResponse(http.StatusBadRequest, "invalid request", c.WrapError("JSON decoding error", err))
+		}
+		if err = a.validate.Struct(memberInput); err != nil {
+			return &c.InvalidRequestResponse
+		}
+		err = crud.SetGroupMemberRole(a.db, group.ID, member.UserID, memberInput.Role)
+		if errors.Is(err, crud.ErrLastOwner) {
+			return &lastOwnerResponse
+		}
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to update group member role", err))
+		}
+		return a.groupResponse(group)
+	}
+}
+
+func (a *API) handleGroupOwnerPost() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		group, membership, badResp := a.groupFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		badResp = policy.AuthorizeGroupOwner(membership)
+		if badResp != nil {
+			return badResp
+		}
+		var ownerInput m.GroupOwnerPost
+		err := json.NewDecoder(r.Body).Decode(&ownerInput)
+		if err != nil {
+			return c.NewBadResponse(http.StatusBadRequest, "invalid request", c.WrapError("JSON decoding error", err))
+		}
+		if err = a.validate.Struct(ownerInput); err != nil {
+			return &c.InvalidRequestResponse
+		}
+		member, badResp := a.findMember(group, ownerInput.Username)
+		if badResp != nil {
+			return badResp
+		}
+		if member.UserID == membership.UserID {
+			return c.NewBadResponse(http.StatusConflict, "ownership can only be transferred to another member", nil)
+		}
+		err = crud.TransferGroupOwnership(a.db, group.ID, membership.UserID, member.UserID)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to transfer group ownership", err))
+		}
+		return a.groupResponse(group)
+	}
+}
+
+func (a *API) handleGroupLeavePost() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		_, membership, badResp := a.groupFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		return a.removeGroupMember(membership)
+	}
+}
@@ -15,6 +15,6 @@ func (a *API) handleHealth() HandlerFunc {
 			err := errors.New("Health check failed, could not reach database")
 			return c.NewBadResponse(http.StatusServiceUnavailable, "Unavailable Ressource", err)
 		}
-		return &c.APIResponse{http.StatusOK, nil, "", nil}
+		return c.NewGoodResponse(http.StatusOK, nil)
 	}
 }
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+	m "github.com/aorticweb/msg-app/app/model"
+	"github.com/aorticweb/msg-app/app/policy"
+	"gorm.io/gorm"
+)
+
+// incomingWebhookRateWindow ... period over which IncomingWebhookRate messages can be posted with a token
+const incomingWebhookRateWindow = time.Minute
+
+// incomingWebhookToken ... the Authorization header holds user tokens, incoming webhooks send theirs
+// in the X-Msg-Token header or, for systems that can only be given a url, the token query parameter
+func incomingWebhookToken(r *http.Request) string {
+	if token := r.Header.Get("X-Msg-Token"); token != "" {
+		return token
+	}
+	return r.URL.Query().Get("token")
+}
+
+// managedGroupFromRequest ... group named in the route, incoming webhooks are managed by its managers
+func (a *API) managedGroupFromRequest(r *http.Request) (*crud.Group, *c.APIResponse) {
+	group, membership, badResp := a.groupFromRequest(r)
+	if badResp != nil {
+		return nil, badResp
+	}
+	if badResp = policy.AuthorizeGroupManage(membership); badResp != nil {
+		return nil, badResp
+	}
+	return group, nil
+}
+
+func (a *API) handleIncomingWebhookPost() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		var webhookInput m.IncomingWebhookPost
+		err := json.NewDecoder(r.Body).Decode(&webhookInput)
+		if err != nil {
+			return c.NewBadResponse(http.StatusBadRequest, "invalid request", c.WrapError("JSON decoding error", err))
+		}
+		if err = a.validate.Struct(webhookInput); err != nil {
+			return &c.InvalidRequestResponse
+		}
+		if badResp := webhookInput.Validate(); badResp != nil {
+			return badResp
+		}
+		group, badResp := a.managedGroupFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		exist, err := crud.UserExist(a.db, webhookInput.Name+crud.BotSuffix)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query users", err))
+		}
+		if exist {
+			return c.NewBadResponse(http.StatusConflict, "an incoming webhook with the same name already exists", nil)
+		}
+		user := authenticatedUser(r)
+		webhook := crud.IncomingWebhook{GroupID: group.ID, Name: webhookInput.Name, CreatedBy: &user.ID, CreatedAt: time.Now().UTC()}
+		token, err := crud.CreateIncomingWebhook(a.db, &webhook)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to create incoming webhook", err))
+		}
+		resp := m.ResponseIncomingWebhookFromDBWebhook(&webhook, group)
+		resp.Token = token
+		return c.NewGoodResponse(http.StatusCreated, resp)
+	}
+}
+
+func (a *API) handleIncomingWebhooksGet() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		group, badResp := a.managedGroupFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		webhooks, err := crud.GetGroupIncomingWebhooks(a.db, group.ID)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query incoming webhooks", err))
+		}
+		return c.NewGoodResponse(http.StatusOK, m.ResponseIncomingWebhooksFromDBWebhooks(webhooks, group))
+	}
+}
+
+func (a *API) handleIncomingWebhookDelete() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		group, badResp := a.managedGroupFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		webhookID, err := c.GetIDFromRequest(r)
+		if err != nil {
+			return &c.InvalidRequestResponse
+		}
+		webhook, exist, err := crud.GetIncomingWebhook(a.db, group.ID, webhookID)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query incoming webhook", err))
+		}
+		if !exist {
+			return c.NewBadResponse(http.StatusNotFound, "incoming webhook not found", nil)
+		}
+		if err = crud.RevokeIncomingWebhook(a.db, webhook); err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to revoke incoming webhook", err))
+		}
+		return c.NewGoodResponse(http.StatusNoContent, nil)
+	}
+}
+
+// handleIncomingMessagePost ... post a message to the group of the incoming webhook token as its bot
+func (a *API) handleIncomingMessagePost() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		token := incomingWebhookToken(r)
+		if token == "" {
+			return &unauthorizedResponse
+		}
+		webhook, exist, err := crud.FindIncomingWebhookByToken(a.db, token)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query incoming webhook", err))
+		}
+		if !exist {
+			return &unauthorizedResponse
+		}
+		var messageInput m.IncomingMessage
+		err = json.NewDecoder(r.Body).Decode(&messageInput)
+		if err != nil {
+			return c.NewBadResponse(http.StatusBadRequest, "invalid request", c.WrapError("JSON decoding error", err))
+		}
+		if err = a.validate.Struct(messageInput); err != nil {
+			return &c.InvalidRequestResponse
+		}
+		message := messageInput.Message(webhook)
+		since := message.SentAt.Add(-incomingWebhookRateWindow)
+		dbMessage, created, err := crud.CreateBotMessage(a.db, webhook, message, since, a.config.IncomingWebhookRate)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// revoked in the meantime
+			return &unauthorizedResponse
+		}
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to create message", err))
+		}
+		if !created {
+			w.Header().Set("Retry-After", strconv.Itoa(int(incomingWebhookRateWindow.Seconds())))
+			return c.NewBadResponse(http.StatusTooManyRequests, "rate limit exceeded", nil)
+		}
+		a.publishMessage(dbMessage)
+		return c.NewGoodResponse(http.StatusAccepted, m.ResponseMessageFromDBMessage(dbMessage, webhook.BotID))
+	}
+}
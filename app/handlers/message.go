@@ -6,36 +6,56 @@ import (
 
 	c "github.com/aorticweb/msg-app/app/common"
 	"github.com/aorticweb/msg-app/app/crud"
-	"github.com/aorticweb/msg-app/app/model"
 	m "github.com/aorticweb/msg-app/app/model"
+	"github.com/aorticweb/msg-app/app/policy"
 )
 
+// handleMessagePost ... a multipart/form-data request composes the message with its attachments, they are
+// stored before the message is created so that its readers never see it without them
 func (a *API) handleMessagePost() HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
 		var messageInput m.ComposedMessage
-		err := json.NewDecoder(r.Body).Decode(&messageInput)
-		if err != nil {
+		uploads := []*m.AttachmentUpload{}
+		if m.IsMultipart(r) {
+			input, files, badResp := m.MessageUploadFromRequest(w, r, a.config.AttachmentMaxSize, a.config.AttachmentTypes)
+			if badResp != nil {
+				return badResp
+			}
+			defer m.CloseUploads(files)
+			messageInput, uploads = *input, files
+		} else if err := json.NewDecoder(r.Body).Decode(&messageInput); err != nil {
 			return c.NewBadResponse(http.StatusBadRequest, "invalid request", c.WrapError("JSON decoding error", err))
 		}
-		if err = a.validate.Struct(messageInput); err != nil {
+		if err := a.validate.Struct(messageInput); err != nil {
 			return c.NewBadResponse(http.StatusBadRequest, "invalid request", nil)
 		}
-		message, badResp := messageInput.Validate(a.db)
+		message, badResp := messageInput.Validate(a.db, authenticatedUser(r))
 		if badResp != nil {
 			return badResp
 		}
+		if len(uploads) > 0 {
+			var err error
+			if message.ID, err = crud.ReserveMessageID(a.db); err != nil {
+				return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to reserve message id", err))
+			}
+			if message.Attachments, err = a.storeUploads(r.Context(), message.ID, uploads, message.SentAt); err != nil {
+				return c.NewBadResponse(http.StatusInternalServerError, "", err)
+			}
+		}
 		dbMessage, err := crud.CreateMessage(a.db, message)
 		if err != nil {
+			a.deleteBlobs(r.Context(), message.Attachments)
 			return c.NewBadResponse(http.StatusNotFound, "", c.WrapError("failed to create message", err))
 		}
-		respMessage := m.ResponseMessageFromDBMessage(dbMessage)
+		a.publishMessage(dbMessage)
+		respMessage := m.ResponseMessageFromDBMessage(dbMessage, authenticatedUser(r).ID)
 		return c.NewGoodResponse(http.StatusAccepted, respMessage) // This is 201 in the docs
 	}
 }
 
 func (a *API) handleMessageReplyPost() HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
-		var messageInput m.ReplyMessage
+		var messageInput m.ReplyPost
 		err := json.NewDecoder(r.Body).Decode(&messageInput)
 		if err != nil {
 			return c.NewBadResponse(http.StatusBadRequest, "invalid request", c.WrapError("JSON decoding error", err))
@@ -47,7 +67,7 @@ func (a *API) handleMessageReplyPost() HandlerFunc {
 		if err != nil {
 			return &c.InvalidRequestResponse
 		}
-		message, badResp := messageInput.Validate(a.db, reID)
+		message, badResp := messageInput.Validate(a.db, authenticatedUser(r), reID, messageInput.Mode)
 		if badResp != nil {
 			return badResp
 		}
@@ -55,71 +75,162 @@ func (a *API) handleMessageReplyPost() HandlerFunc {
 		if err != nil {
 			return c.NewBadResponse(http.StatusNotFound, "", c.WrapError("failed to create message", err))
 		}
-		respMessage := m.ResponseMessageFromDBMessage(dbMessage)
+		a.publishMessage(dbMessage)
+		respMessage := m.ResponseMessageFromDBMessage(dbMessage, authenticatedUser(r).ID)
 		return c.NewGoodResponse(http.StatusAccepted, respMessage) // This is 201 in the docs
 	}
 }
 
+// messageFromRequest ... message identified in the route, with the read state of the
+// caller, the caller must be allowed to read it
+func (a *API) messageFromRequest(r *http.Request) (*crud.Message, *c.APIResponse) {
+	messageID, err := c.GetIDFromRequest(r)
+	if err != nil {
+		return nil, &c.InvalidRequestResponse
+	}
+	user := authenticatedUser(r)
+	dbMessage, exist, err := crud.GetMessage(a.db, messageID, crud.WithReadState(user.ID))
+	if err != nil {
+		return nil, c.NewBadResponse(http.StatusInternalServerError, "", err)
+	}
+	if !exist {
+		return nil, c.NewBadResponse(http.StatusNotFound, "message not found", nil)
+	}
+	badResp := policy.AuthorizeMessageRead(a.db, user, dbMessage)
+	if badResp != nil {
+		return nil, badResp
+	}
+	return dbMessage, nil
+}
+
+// mailboxOwnerFromRequest ... the caller when the route names their own mailbox
+func (a *API) mailboxOwnerFromRequest(r *http.Request) (*crud.User, *c.APIResponse) {
+	username, err := c.GetUsernameFromRequest(r)
+	if err != nil {
+		return nil, &c.InvalidRequestResponse
+	}
+	user := authenticatedUser(r)
+	badResp := policy.AuthorizeMailboxRead(user, username)
+	if badResp != nil {
+		return nil, badResp
+	}
+	return user, nil
+}
+
 func (a *API) handleMessageGet() HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
-		messageID, err := c.GetIDFromRequest(r)
-		if err != nil {
-			return &c.InvalidRequestResponse
-		}
-		dbMessage, exist, err := crud.GetMessage(a.db, messageID)
-		if err != nil {
-			return c.NewBadResponse(http.StatusInternalServerError, "", err)
-		}
-		if !exist {
-			return c.NewBadResponse(http.StatusNotFound, "message not found", nil)
+		dbMessage, badResp := a.messageFromRequest(r)
+		if badResp != nil {
+			return badResp
 		}
-		respMessage := m.ResponseMessageFromDBMessage(dbMessage)
+		respMessage := m.ResponseMessageFromDBMessage(dbMessage, authenticatedUser(r).ID)
 		return c.NewGoodResponse(http.StatusOK, respMessage)
 	}
 }
 
 func (a *API) handleMessageRepliesGet() HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
-		messageID, err := c.GetIDFromRequest(r)
-		if err != nil {
-			return &c.InvalidRequestResponse
-		}
-		_, exist, err := crud.GetMessage(a.db, messageID)
-		if err != nil {
-			return c.NewBadResponse(http.StatusInternalServerError, "", err)
+		dbMessage, badResp := a.messageFromRequest(r)
+		if badResp != nil {
+			return badResp
 		}
-		if !exist {
-			return c.NewBadResponse(http.StatusNotFound, "message not found", nil)
+		page, badResp := m.PageFromRequest(r)
+		if badResp != nil {
+			return badResp
 		}
-		dbMessages, err := crud.GetMessageReplies(a.db, messageID)
-		var data []model.Message
-
-		for _, msg := range dbMessages {
-			data = append(data, *m.ResponseMessageFromDBMessage(&msg))
+		dbMessages, next, err := crud.GetMessageReplies(a.db, dbMessage.ID, authenticatedUser(r).ID, *page)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query replies", err))
 		}
-		return c.NewGoodResponse(http.StatusOK, data)
+		return c.NewGoodResponse(http.StatusOK, m.ResponseMessagePageFromDBMessages(dbMessages, next, authenticatedUser(r).ID))
 	}
 }
 
 func (a *API) handleInboxGet() HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
-		username, err := c.GetUsernameFromRequest(r)
-		if err != nil {
-			return &c.InvalidRequestResponse
+		user, badResp := a.mailboxOwnerFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		filter, badResp := m.MailboxFilterFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		page, badResp := m.PageFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		view, badResp := m.MailboxViewFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		if view == m.MailboxViewConversations {
+			conversations, next, err := crud.GetUserConversations(a.db, user.ID, *filter, *page)
+			if err != nil {
+				return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query conversations", err))
+			}
+			return c.NewGoodResponse(http.StatusOK, m.ResponseConversationPageFromDBConversations(conversations, next, authenticatedUser(r).ID))
 		}
-		user, exist, err := crud.FindUser(a.db, username)
+		dbMessages, next, err := crud.GetUserMailbox(a.db, user.ID, *filter, *page)
 		if err != nil {
-			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query user", err))
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query mailbox", err))
 		}
-		if !exist {
-			return c.NewBadResponse(http.StatusNotFound, "user with given username does not exist", nil)
+		return c.NewGoodResponse(http.StatusOK, m.ResponseMessagePageFromDBMessages(dbMessages, next, authenticatedUser(r).ID))
+	}
+}
+
+func (a *API) handleSentGet() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		user, badResp := a.mailboxOwnerFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		page, badResp := m.PageFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		dbMessages, next, err := crud.GetUserSent(a.db, user.ID, *page)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query sent messages", err))
 		}
-		dbMessages, err := crud.GetUserMailbox(a.db, user.ID)
-		var data []model.Message
+		return c.NewGoodResponse(http.StatusOK, m.ResponseMessagePageFromDBMessages(dbMessages, next, authenticatedUser(r).ID))
+	}
+}
 
-		for _, msg := range dbMessages {
-			data = append(data, *m.ResponseMessageFromDBMessage(&msg))
+// threadRoot ... message the thread of dbMessage starts from, the walk starts from dbMessage
+// itself when user cannot read it
+func (a *API) threadRoot(user *crud.User, dbMessage *crud.Message) (int64, *c.APIResponse) {
+	if dbMessage.ThreadID == nil || *dbMessage.ThreadID == dbMessage.ID {
+		return dbMessage.ID, nil
+	}
+	root, exist, err := crud.GetMessage(a.db, *dbMessage.ThreadID)
+	if err != nil {
+		return 0, c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query thread root", err))
+	}
+	if !exist || policy.AuthorizeMessageRead(a.db, user, root) != nil {
+		return dbMessage.ID, nil
+	}
+	return root.ID, nil
+}
+
+func (a *API) handleMessageThreadGet() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		dbMessage, badResp := a.messageFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		threadQuery, badResp := m.ThreadQueryFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		rootID, badResp := a.threadRoot(authenticatedUser(r), dbMessage)
+		if badResp != nil {
+			return badResp
+		}
+		nodes, err := crud.GetThread(a.db, rootID, authenticatedUser(r).ID, threadQuery.MaxDepth)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query thread", err))
 		}
-		return c.NewGoodResponse(http.StatusOK, data)
+		return c.NewGoodResponse(http.StatusOK, m.ResponseThreadFromDBNodes(nodes, threadQuery.Format, authenticatedUser(r).ID))
 	}
 }
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+	m "github.com/aorticweb/msg-app/app/model"
+	"github.com/aorticweb/msg-app/app/policy"
+)
+
+func (a *API) handleMessagePatch() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		dbMessage, badResp := a.messageFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		badResp = policy.AuthorizeMessageEdit(authenticatedUser(r), dbMessage, a.config.EditWindow)
+		if badResp != nil {
+			return badResp
+		}
+		var patchInput m.MessagePatch
+		err := json.NewDecoder(r.Body).Decode(&patchInput)
+		if err != nil {
+			return c.NewBadResponse(http.StatusBadRequest, "invalid request", c.WrapError("JSON decoding error", err))
+		}
+		if err = a.validate.Struct(patchInput); err != nil {
+			return &c.InvalidRequestResponse
+		}
+		badResp = patchInput.Validate()
+		if badResp != nil {
+			return badResp
+		}
+		err = crud.EditMessage(a.db, dbMessage, patchInput.Subject, patchInput.Body)
+		if errors.Is(err, crud.ErrMessageDeleted) {
+			return c.NewBadResponse(http.StatusGone, "cannot edit a deleted message", nil)
+		}
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to edit message", err))
+		}
+		return c.NewGoodResponse(http.StatusOK, m.ResponseMessageFromDBMessage(dbMessage, authenticatedUser(r).ID))
+	}
+}
+
+func (a *API) handleMessageRevisionsGet() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		dbMessage, badResp := a.messageFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		if dbMessage.DeletedAt != nil {
+			return c.NewBadResponse(http.StatusGone, "message was deleted", nil)
+		}
+		revisions, err := crud.GetMessageRevisions(a.db, dbMessage.ID)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query revisions", err))
+		}
+		return c.NewGoodResponse(http.StatusOK, m.ResponseRevisionsFromDBRevisions(revisions))
+	}
+}
@@ -1,17 +1,74 @@
 package api
 
 func (a *API) routes() {
-	a.router.HandleFunc("/groups", a.middleware(a.handleGroupPost())).Methods("POST")
+	a.router.HandleFunc("/auth/login", a.middleware(a.handleLoginPost())).Methods("POST")
+	a.router.HandleFunc("/auth/logout", a.middleware(a.auth(a.handleLogoutPost()))).Methods("POST")
+
+	a.router.HandleFunc("/drafts", a.middleware(a.auth(a.handleDraftPost()))).Methods("POST")
+	a.router.HandleFunc("/drafts", a.middleware(a.auth(a.handleDraftsGet()))).Methods("GET")
+	a.router.HandleFunc("/drafts/{id}", a.middleware(a.auth(a.handleDraftGet()))).Methods("GET")
+	a.router.HandleFunc("/drafts/{id}", a.middleware(a.auth(a.handleDraftPatch()))).Methods("PATCH")
+	a.router.HandleFunc("/drafts/{id}", a.middleware(a.auth(a.handleDraftDelete()))).Methods("DELETE")
+	a.router.HandleFunc("/drafts/{id}/send", a.middleware(a.auth(a.handleDraftSendPost()))).Methods("POST")
+
+	a.router.HandleFunc("/groups", a.middleware(a.auth(a.handleGroupPost()))).Methods("POST")
+	a.router.HandleFunc("/groups/{groupname}", a.middleware(a.auth(a.handleGroupGet()))).Methods("GET")
+	a.router.HandleFunc("/groups/{groupname}", a.middleware(a.auth(a.handleGroupPatch()))).Methods("PATCH")
+	a.router.HandleFunc("/groups/{groupname}", a.middleware(a.auth(a.handleGroupDelete()))).Methods("DELETE")
+	a.router.HandleFunc("/groups/{groupname}/incoming-webhooks", a.middleware(a.auth(a.handleIncomingWebhookPost()))).Methods("POST")
+	a.router.HandleFunc("/groups/{groupname}/incoming-webhooks", a.middleware(a.auth(a.handleIncomingWebhooksGet()))).Methods("GET")
+	a.router.HandleFunc("/groups/{groupname}/incoming-webhooks/{id}", a.middleware(a.auth(a.handleIncomingWebhookDelete()))).Methods("DELETE")
+	a.router.HandleFunc("/groups/{groupname}/leave", a.middleware(a.auth(a.handleGroupLeavePost()))).Methods("POST")
+	a.router.HandleFunc("/groups/{groupname}/members", a.middleware(a.auth(a.handleGroupMembersPost()))).Methods("POST")
+	a.router.HandleFunc("/groups/{groupname}/members/{username}", a.middleware(a.auth(a.handleGroupMemberPut()))).Methods("PUT")
+	a.router.HandleFunc("/groups/{groupname}/members/{username}", a.middleware(a.auth(a.handleGroupMemberDelete()))).Methods("DELETE")
+	a.router.HandleFunc("/groups/{groupname}/owner", a.middleware(a.auth(a.handleGroupOwnerPost()))).Methods("POST")
 
 	a.router.HandleFunc("/health", a.middleware(a.handleHealth())).Methods("GET")
 
-	a.router.HandleFunc("/messages/{id}", a.middleware(a.handleMessageGet())).Methods("GET")
-	a.router.HandleFunc("/messages", a.middleware(a.handleMessagePost())).Methods("POST")
+	a.router.HandleFunc("/incoming-webhooks/messages", a.middleware(a.handleIncomingMessagePost())).Methods("POST")
+
+	a.router.HandleFunc("/messages/{id}", a.middleware(a.auth(a.handleMessageGet()))).Methods("GET")
+	a.router.HandleFunc("/messages/{id}", a.middleware(a.auth(a.handleMessagePatch()))).Methods("PATCH")
+	a.router.HandleFunc("/messages/{id}", a.middleware(a.auth(a.handleMessageDelete()))).Methods("DELETE")
+	a.router.HandleFunc("/messages", a.middleware(a.auth(a.handleMessagePost()))).Methods("POST")
+
+	a.router.HandleFunc("/messages/{id}/revisions", a.middleware(a.auth(a.handleMessageRevisionsGet()))).Methods("GET")
+	a.router.HandleFunc("/messages/{id}/restore", a.middleware(a.auth(a.handleMessageRestorePost()))).Methods("POST")
+
+	a.router.HandleFunc("/messages/{id}/attachments", a.middleware(a.auth(a.handleAttachmentPost()))).Methods("POST")
+	a.router.HandleFunc("/messages/{id}/attachments/{attachment}", a.middleware(a.auth(a.handleAttachmentGet()))).Methods("GET")
+
+	a.router.HandleFunc("/messages/{id}/forward", a.middleware(a.auth(a.handleMessageForwardPost()))).Methods("POST")
 
-	a.router.HandleFunc("/messages/{id}/replies", a.middleware(a.handleMessageRepliesGet())).Methods("GET")
-	a.router.HandleFunc("/messages/{id}/replies", a.middleware(a.handleMessageReplyPost())).Methods("POST")
+	a.router.HandleFunc("/messages/{id}/read", a.middleware(a.auth(a.handleMessageReadPut()))).Methods("PUT")
+	a.router.HandleFunc("/messages/{id}/read", a.middleware(a.auth(a.handleMessageReadDelete()))).Methods("DELETE")
+
+	a.router.HandleFunc("/messages/{id}/replies", a.middleware(a.auth(a.handleMessageRepliesGet()))).Methods("GET")
+	a.router.HandleFunc("/messages/{id}/replies", a.middleware(a.auth(a.handleMessageReplyPost()))).Methods("POST")
+
+	a.router.HandleFunc("/messages/{id}/schedule", a.middleware(a.auth(a.handleSchedulePut()))).Methods("PUT")
+	a.router.HandleFunc("/messages/{id}/schedule", a.middleware(a.auth(a.handleScheduleDelete()))).Methods("DELETE")
+
+	a.router.HandleFunc("/messages/{id}/thread", a.middleware(a.auth(a.handleMessageThreadGet()))).Methods("GET")
+
+	a.router.HandleFunc("/search/messages", a.middleware(a.auth(a.handleMessageSearchGet()))).Methods("GET")
 
 	a.router.HandleFunc("/users", a.middleware(a.handleUserPost())).Methods("POST")
 
-	a.router.HandleFunc("/users/{username}/mailbox", a.middleware(a.handleInboxGet())).Methods("GET")
+	a.router.HandleFunc("/users/{username}/mailbox", a.middleware(a.auth(a.handleInboxGet()))).Methods("GET")
+	a.router.HandleFunc("/users/{username}/mailbox/read", a.middleware(a.auth(a.handleMailboxReadPost()))).Methods("POST")
+	a.router.HandleFunc("/users/{username}/mailbox/unread", a.middleware(a.auth(a.handleMailboxUnreadPost()))).Methods("POST")
+	a.router.HandleFunc("/users/{username}/mailbox/stream", a.middleware(a.streamAuth(a.auth(a.handleMailboxStream())))).Methods("GET")
+	a.router.HandleFunc("/users/{username}/mailbox/ws", a.middleware(a.streamAuth(a.auth(a.handleMailboxWebSocket())))).Methods("GET")
+	a.router.HandleFunc("/users/{username}/mailbox/unread-count", a.middleware(a.auth(a.handleUnreadCountGet()))).Methods("GET")
+	a.router.HandleFunc("/users/{username}/scheduled", a.middleware(a.auth(a.handleScheduledGet()))).Methods("GET")
+	a.router.HandleFunc("/users/{username}/sent", a.middleware(a.auth(a.handleSentGet()))).Methods("GET")
+	a.router.HandleFunc("/users/{username}/trash", a.middleware(a.auth(a.handleTrashGet()))).Methods("GET")
+
+	a.router.HandleFunc("/webhooks", a.middleware(a.auth(a.handleWebhookPost()))).Methods("POST")
+	a.router.HandleFunc("/webhooks", a.middleware(a.auth(a.handleWebhooksGet()))).Methods("GET")
+	a.router.HandleFunc("/webhooks/{id}", a.middleware(a.auth(a.handleWebhookDelete()))).Methods("DELETE")
+	a.router.HandleFunc("/webhooks/{id}/deliveries", a.middleware(a.auth(a.handleWebhookDeliveriesGet()))).Methods("GET")
+	a.router.HandleFunc("/webhooks/{id}/enable", a.middleware(a.auth(a.handleWebhookEnablePost()))).Methods("POST")
 }
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+	m "github.com/aorticweb/msg-app/app/model"
+	"github.com/aorticweb/msg-app/app/policy"
+)
+
+func (a *API) handleScheduledGet() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		user, badResp := a.mailboxOwnerFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		page, badResp := m.PageFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		if r.URL.Query().Get("sort") == "" {
+			// next to go first
+			page.Ascending = true
+		}
+		dbMessages, next, err := crud.GetUserScheduled(a.db, user.ID, *page)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query scheduled messages", err))
+		}
+		return c.NewGoodResponse(http.StatusOK, m.ResponseMessagePageFromDBMessages(dbMessages, next, user.ID))
+	}
+}
+
+// scheduledFromRequest ... pending message identified in the route, the caller must be its sender
+func (a *API) scheduledFromRequest(r *http.Request) (*crud.Message, *c.APIResponse) {
+	dbMessage, badResp := a.messageFromRequest(r)
+	if badResp != nil {
+		return nil, badResp
+	}
+	badResp = policy.AuthorizeScheduleChange(authenticatedUser(r), dbMessage)
+	if badResp != nil {
+		return nil, badResp
+	}
+	return dbMessage, nil
+}
+
+func (a *API) handleSchedulePut() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		dbMessage, badResp := a.scheduledFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		var scheduleInput m.SchedulePut
+		err := json.NewDecoder(r.Body).Decode(&scheduleInput)
+		if err != nil {
+			return c.NewBadResponse(http.StatusBadRequest, "invalid request", c.WrapError("JSON decoding error", err))
+		}
+		if err = a.validate.Struct(scheduleInput); err != nil {
+			return &c.InvalidRequestResponse
+		}
+		sendAt, badResp := scheduleInput.Validate()
+		if badResp != nil {
+			return badResp
+		}
+		user := authenticatedUser(r)
+		err = crud.RescheduleMessage(a.db, dbMessage.ID, user.ID, sendAt)
+		if errors.Is(err, crud.ErrNotScheduled) {
+			return c.NewBadResponse(http.StatusConflict, "message was already sent", nil)
+		}
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to reschedule message", err))
+		}
+		dbMessage.SendAt, dbMessage.SentAt = &sendAt, sendAt
+		return c.NewGoodResponse(http.StatusOK, m.ResponseMessageFromDBMessage(dbMessage, user.ID))
+	}
+}
+
+func (a *API) handleScheduleDelete() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		dbMessage, badResp := a.scheduledFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		attachments, err := crud.CancelScheduledMessage(a.db, dbMessage.ID, authenticatedUser(r).ID)
+		if errors.Is(err, crud.ErrNotScheduled) {
+			return c.NewBadResponse(http.StatusConflict, "message was already sent", nil)
+		}
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to cancel message", err))
+		}
+		for _, attachment := range attachments {
+			if err = a.blobs.Delete(r.Context(), attachment.StorageKey); err != nil {
+				a.logger.Println(c.WrapError("failed to delete orphan attachment", err))
+			}
+		}
+		return c.NewGoodResponse(http.StatusNoContent, nil)
+	}
+}
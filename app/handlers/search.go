@@ -0,0 +1,23 @@
+package api
+
+import (
+	"net/http"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+	m "github.com/aorticweb/msg-app/app/model"
+)
+
+func (a *API) handleMessageSearchGet() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		search, badResp := m.SearchQueryFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		results, next, err := crud.SearchMessages(a.db, authenticatedUser(r).ID, search.Q, search.Limit, search.Offset)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to search messages", err))
+		}
+		return c.NewGoodResponse(http.StatusOK, m.ResponseSearchPageFromDBResults(results, next, authenticatedUser(r).ID))
+	}
+}
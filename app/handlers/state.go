@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/events"
+	m "github.com/aorticweb/msg-app/app/model"
+)
+
+func (a *API) handleMessageReadPut() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		dbMessage, badResp := a.messageFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		user := authenticatedUser(r)
+		err := crud.MarkMessagesRead(a.db, user.ID, []int64{dbMessage.ID})
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to mark message read", err))
+		}
+		a.publishState(user.ID, events.KindRead, []int64{dbMessage.ID})
+		return c.NewGoodResponse(http.StatusNoContent, nil)
+	}
+}
+
+func (a *API) handleMessageReadDelete() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		dbMessage, badResp := a.messageFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		user := authenticatedUser(r)
+		err := crud.MarkMessagesUnread(a.db, user.ID, []int64{dbMessage.ID})
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to mark message unread", err))
+		}
+		a.publishState(user.ID, events.KindUnread, []int64{dbMessage.ID})
+		return c.NewGoodResponse(http.StatusNoContent, nil)
+	}
+}
+
+func decodeMessageState(r *http.Request) (*m.MessageStatePost, *c.APIResponse) {
+	var stateInput m.MessageStatePost
+	err := json.NewDecoder(r.Body).Decode(&stateInput)
+	if err != nil {
+		return nil, c.NewBadResponse(http.StatusBadRequest, "invalid request", c.WrapError("JSON decoding error", err))
+	}
+	badResp := stateInput.Validate()
+	if badResp != nil {
+		return nil, badResp
+	}
+	return &stateInput, nil
+}
+
+func (a *API) handleMailboxReadPost() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		user, badResp := a.mailboxOwnerFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		stateInput, badResp := decodeMessageState(r)
+		if badResp != nil {
+			return badResp
+		}
+		var err error
+		if stateInput.All {
+			err = crud.MarkMailboxRead(a.db, user.ID)
+		} else {
+			err = crud.MarkMessagesRead(a.db, user.ID, stateInput.IDs)
+		}
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to mark messages read", err))
+		}
+		a.publishState(user.ID, events.KindRead, stateInput.IDs)
+		return c.NewGoodResponse(http.StatusNoContent, nil)
+	}
+}
+
+func (a *API) handleMailboxUnreadPost() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		user, badResp := a.mailboxOwnerFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		stateInput, badResp := decodeMessageState(r)
+		if badResp != nil {
+			return badResp
+		}
+		var err error
+		if stateInput.All {
+			err = crud.MarkMailboxUnread(a.db, user.ID)
+		} else {
+			err = crud.MarkMessagesUnread(a.db, user.ID, stateInput.IDs)
+		}
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to mark messages unread", err))
+		}
+		a.publishState(user.ID, events.KindUnread, stateInput.IDs)
+		return c.NewGoodResponse(http.StatusNoContent, nil)
+	}
+}
+
+func (a *API) handleUnreadCountGet() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		user, badResp := a.mailboxOwnerFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		count, err := crud.CountUnread(a.db, user.ID)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to count unread messages", err))
+		}
+		return c.NewGoodResponse(http.StatusOK, m.UnreadCount{Unread: count})
+	}
+}
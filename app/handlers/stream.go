@@ -0,0 +1,202 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/events"
+)
+
+const (
+	sseWriteWait = 10 * time.Second
+	// sseHeartbeat ... keeps proxies from closing an idle stream, the token is checked again at the same pace
+	sseHeartbeat = 30 * time.Second
+	// sseSendBuffer ... events queued for a slow client before it is disconnected
+	sseSendBuffer = 64
+	// sseReplayBatch ... stored events loaded at once when a client resumes
+	sseReplayBatch = 100
+	// sseRetry ... milliseconds EventSource waits before reconnecting
+	sseRetry = 3000
+)
+
+// lastEventID ... id of the last event the client saw, 0 when it is not resuming.
+// EventSource sends the header when reconnecting, last_event_id lets a client resume a new one
+func lastEventID(r *http.Request) (int64, *c.APIResponse) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0, c.NewBadResponse(http.StatusBadRequest, "invalid Last-Event-ID", nil)
+	}
+	return id, nil
+}
+
+// handleMailboxStream ... the connection is hijacked so that the stream escapes the write timeout
+// of the server, deadlines are then set for every write instead
+func (a *API) handleMailboxStream() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		user, badResp := a.mailboxOwnerFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		lastID, badResp := lastEventID(r)
+		if badResp != nil {
+			return badResp
+		}
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("event stream", fmt.Errorf("%T cannot be hijacked", w)))
+		}
+		// subscribe before replaying so that nothing is missed in between
+		subscription := a.bus.Subscribe(user.ID, sseSendBuffer)
+		defer subscription.Close()
+		conn, rw, err := hijacker.Hijack()
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to hijack connection", err))
+		}
+		a.streams.Add(1)
+		defer a.streams.Done()
+		err = a.serveEventStream(conn, rw, user, streamToken(r), lastID, subscription)
+		return c.NewWrittenResponse(http.StatusOK, err)
+	}
+}
+
+// sseWriter ... writes server-sent events to a hijacked connection
+type sseWriter struct {
+	conn net.Conn
+	buf  *bufio.Writer
+}
+
+func (s *sseWriter) event(id int64, kind string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != 0 {
+		fmt.Fprintf(s.buf, "id: %d\n", id)
+	}
+	_, err = fmt.Fprintf(s.buf, "event: %s\ndata: %s\n\n", kind, payload)
+	return err
+}
+
+func (s *sseWriter) comment(text string) error {
+	_, err := fmt.Fprintf(s.buf, ": %s\n\n", text)
+	return err
+}
+
+func (s *sseWriter) flush() error {
+	s.conn.SetWriteDeadline(time.Now().Add(sseWriteWait))
+	return s.buf.Flush()
+}
+
+// sendEvent ... write event as seen by user, events that have nothing left to show are skipped
+func (a *API) sendEvent(out *sseWriter, user *crud.User, event events.Event) error {
+	rendered, ok, err := a.renderEvent(user, event)
+	if err != nil {
+		a.logger.Println(c.WrapError("failed to render event", err))
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	return out.event(event.ID, event.Kind, rendered)
+}
+
+// replayEvents ... write the stored events of user following lastID, returns the highest id it wrote
+func (a *API) replayEvents(out *sseWriter, user *crud.User, lastID int64) (int64, error) {
+	maxReplayed := int64(0)
+	for {
+		dbEvents, err := crud.GetMailboxEvents(a.db, user.ID, lastID, sseReplayBatch)
+		if err != nil {
+			return maxReplayed, c.WrapError("failed to query mailbox events", err)
+		}
+		for _, dbEvent := range dbEvents {
+			if err = a.sendEvent(out, user, eventFromDBEvent(&dbEvent)); err != nil {
+				return maxReplayed, err
+			}
+			maxReplayed = dbEvent.ID
+			lastID = dbEvent.ID
+		}
+		if len(dbEvents) < sseReplayBatch {
+			return maxReplayed, nil
+		}
+	}
+}
+
+// serveEventStream ... replay what the client missed then push the events of subscription until
+// the client leaves, its token stops being valid, it cannot keep up or the api shuts down
+func (a *API) serveEventStream(conn net.Conn, rw *bufio.ReadWriter, user *crud.User, token string, lastID int64, subscription *events.Subscription) error {
+	defer conn.Close()
+	// drop the deadlines the server set for the request
+	conn.SetDeadline(time.Time{})
+	out := &sseWriter{conn: conn, buf: rw.Writer}
+	fmt.Fprint(out.buf, "HTTP/1.1 200 OK\r\n")
+	fmt.Fprint(out.buf, "Content-Type: text/event-stream\r\n")
+	fmt.Fprint(out.buf, "Cache-Control: no-cache\r\n")
+	fmt.Fprint(out.buf, "Connection: close\r\n")
+	fmt.Fprint(out.buf, "X-Accel-Buffering: no\r\n\r\n")
+	fmt.Fprintf(out.buf, "retry: %d\n\n", sseRetry)
+	// events published while replaying are received live as well, they are skipped up to the last
+	// one replayed. Events stored before it are replayed as they are read after subscribing
+	maxReplayed := int64(0)
+	if lastID != 0 {
+		var err error
+		if maxReplayed, err = a.replayEvents(out, user, lastID); err != nil {
+			return err
+		}
+	}
+	if err := out.flush(); err != nil {
+		return err
+	}
+
+	clientGone := make(chan struct{})
+	go func() {
+		defer close(clientGone)
+		io.Copy(ioutil.Discard, rw.Reader)
+	}()
+	ticker := time.NewTicker(sseHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-clientGone:
+			return nil
+		case event, ok := <-subscription.Events():
+			if !ok {
+				// slow clients and clients of a stopping replica reconnect after retry and
+				// resume from their last event
+				return nil
+			}
+			if event.ID <= maxReplayed {
+				continue
+			}
+			if err := a.sendEvent(out, user, event); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if !a.streamTokenValid(token) {
+				// the reconnection is refused with 401, which stops EventSource
+				return nil
+			}
+			if err := out.comment("ping"); err != nil {
+				return err
+			}
+		}
+		if err := out.flush(); err != nil {
+			return err
+		}
+	}
+}
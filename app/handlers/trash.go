@@ -0,0 +1,82 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/events"
+	m "github.com/aorticweb/msg-app/app/model"
+	"github.com/aorticweb/msg-app/app/policy"
+)
+
+func (a *API) handleMessageDelete() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		dbMessage, badResp := a.messageFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		scope, badResp := m.DeleteScopeFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		user := authenticatedUser(r)
+		if scope == m.DeleteScopeEveryone {
+			badResp = policy.AuthorizeDeleteForEveryone(user, dbMessage, a.config.DeleteWindow)
+			if badResp != nil {
+				return badResp
+			}
+			err := crud.DeleteMessageForEveryone(a.db, dbMessage.ID)
+			if errors.Is(err, crud.ErrMessageDeleted) {
+				return c.NewBadResponse(http.StatusGone, "message was deleted", nil)
+			}
+			if err != nil {
+				return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to delete message", err))
+			}
+			a.publishDeleteForEveryone(dbMessage)
+			return c.NewGoodResponse(http.StatusNoContent, nil)
+		}
+		err := crud.TrashMessage(a.db, dbMessage.ID, user.ID)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to move message to trash", err))
+		}
+		a.publishState(user.ID, events.KindDelete, []int64{dbMessage.ID})
+		return c.NewGoodResponse(http.StatusNoContent, nil)
+	}
+}
+
+func (a *API) handleMessageRestorePost() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		dbMessage, badResp := a.messageFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		restored, err := crud.RestoreMessage(a.db, dbMessage.ID, authenticatedUser(r).ID)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to restore message", err))
+		}
+		if !restored {
+			return c.NewBadResponse(http.StatusNotFound, "message is not in the trash", nil)
+		}
+		return c.NewGoodResponse(http.StatusNoContent, nil)
+	}
+}
+
+func (a *API) handleTrashGet() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		user, badResp := a.mailboxOwnerFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		page, badResp := m.PageFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		dbMessages, next, err := crud.GetUserTrash(a.db, user.ID, *page)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query trash", err))
+		}
+		return c.NewGoodResponse(http.StatusOK, m.ResponseMessagePageFromDBMessages(dbMessages, next, authenticatedUser(r).ID))
+	}
+}
@@ -6,11 +6,12 @@ import (
 
 	c "github.com/aorticweb/msg-app/app/common"
 	"github.com/aorticweb/msg-app/app/crud"
+	m "github.com/aorticweb/msg-app/app/model"
 )
 
 func (a *API) handleUserPost() HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
-		var userInput crud.User
+		var userInput m.UserPost
 		err := json.NewDecoder(r.Body).Decode(&userInput)
 		if err != nil {
 			return c.NewBadResponse(http.StatusBadRequest, "invalid request", c.WrapError("JSON decoding error", err))
@@ -18,6 +19,9 @@ func (a *API) handleUserPost() HandlerFunc {
 		if err = a.validate.Struct(userInput); err != nil {
 			return &c.InvalidRequestResponse
 		}
+		if crud.IsBotUsername(userInput.Username) {
+			return c.NewBadResponse(http.StatusBadRequest, "usernames ending with "+crud.BotSuffix+" are reserved to bots", nil)
+		}
 		exist, err := crud.UserExist(a.db, userInput.Username)
 		if err != nil {
 			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query users", err))
@@ -25,10 +29,15 @@ func (a *API) handleUserPost() HandlerFunc {
 		if exist {
 			return c.NewBadResponse(http.StatusConflict, "user with the same username already registered", nil)
 		}
-		err = crud.CreateUser(a.db, userInput)
+		passwordHash, err := crud.HashPassword(userInput.Password)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to hash password", err))
+		}
+		user := crud.User{Username: userInput.Username, PasswordHash: passwordHash}
+		err = crud.CreateUser(a.db, user)
 		if err != nil {
 			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to create user", err))
 		}
-		return c.NewGoodResponse(http.StatusCreated, userInput)
+		return c.NewGoodResponse(http.StatusCreated, user)
 	}
 }
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+	m "github.com/aorticweb/msg-app/app/model"
+	"github.com/aorticweb/msg-app/app/policy"
+	"github.com/aorticweb/msg-app/app/webhooks"
+)
+
+// webhookDeliveryLogLimit ... deliveries listed by the delivery log of a webhook
+const webhookDeliveryLogLimit = 100
+
+// webhookFromRequest ... webhook identified in the route, only its owner can see it
+func (a *API) webhookFromRequest(r *http.Request) (*crud.Webhook, *c.APIResponse) {
+	webhookID, err := c.GetIDFromRequest(r)
+	if err != nil {
+		return nil, &c.InvalidRequestResponse
+	}
+	webhook, exist, err := crud.GetWebhook(a.db, authenticatedUser(r).ID, webhookID)
+	if err != nil {
+		return nil, c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query webhook", err))
+	}
+	if !exist {
+		return nil, c.NewBadResponse(http.StatusNotFound, "webhook not found", nil)
+	}
+	return webhook, nil
+}
+
+// authorizeWebhookScope ... group webhooks are set up by the group managers, global ones by admins
+func (a *API) authorizeWebhookScope(user *crud.User, webhookInput *m.WebhookPost, webhook *crud.Webhook) *c.APIResponse {
+	switch webhookInput.Scope {
+	case crud.WebhookScopeGlobal:
+		return policy.AuthorizeAdmin(user, a.config.Admins)
+	case crud.WebhookScopeGroup:
+		group, exist, err := crud.FindGroup(a.db, webhookInput.Groupname)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query group", err))
+		}
+		if !exist {
+			return c.NewBadResponse(http.StatusNotFound, "group with given groupname does not exist", nil)
+		}
+		membership, badResp := policy.AuthorizeGroupMember(a.db, user, group)
+		if badResp != nil {
+			return badResp
+		}
+		if badResp = policy.AuthorizeGroupManage(membership); badResp != nil {
+			return badResp
+		}
+		webhook.GroupID = &group.ID
+		webhook.Group = group
+	}
+	return nil
+}
+
+func (a *API) handleWebhookPost() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		var webhookInput m.WebhookPost
+		err := json.NewDecoder(r.Body).Decode(&webhookInput)
+		if err != nil {
+			return c.NewBadResponse(http.StatusBadRequest, "invalid request", c.WrapError("JSON decoding error", err))
+		}
+		if err = a.validate.Struct(webhookInput); err != nil {
+			return &c.InvalidRequestResponse
+		}
+		if badResp := webhookInput.Validate(); badResp != nil {
+			return badResp
+		}
+		if !a.config.WebhookAllowPrivate {
+			if err = webhooks.CheckURL(r.Context(), webhookInput.URL); err != nil {
+				return c.NewBadResponse(http.StatusBadRequest, "webhook url must resolve to public addresses", c.WrapError("invalid webhook url", err))
+			}
+		}
+		user := authenticatedUser(r)
+		webhook := crud.Webhook{OwnerID: user.ID, Scope: webhookInput.Scope, URL: webhookInput.URL, CreatedAt: time.Now().UTC()}
+		if badResp := a.authorizeWebhookScope(user, &webhookInput, &webhook); badResp != nil {
+			return badResp
+		}
+		if err = crud.CreateWebhook(a.db, &webhook); err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to create webhook", err))
+		}
+		resp := m.ResponseWebhookFromDBWebhook(&webhook)
+		resp.Secret = webhook.Secret
+		return c.NewGoodResponse(http.StatusCreated, resp)
+	}
+}
+
+func (a *API) handleWebhooksGet() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		webhooks, err := crud.GetUserWebhooks(a.db, authenticatedUser(r).ID)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query webhooks", err))
+		}
+		return c.NewGoodResponse(http.StatusOK, m.ResponseWebhooksFromDBWebhooks(webhooks))
+	}
+}
+
+func (a *API) handleWebhookDelete() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		webhook, badResp := a.webhookFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		if err := crud.DeleteWebhook(a.db, webhook); err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to delete webhook", err))
+		}
+		return c.NewGoodResponse(http.StatusNoContent, nil)
+	}
+}
+
+func (a *API) handleWebhookEnablePost() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		webhook, badResp := a.webhookFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		if err := crud.EnableWebhook(a.db, webhook); err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to enable webhook", err))
+		}
+		return c.NewGoodResponse(http.StatusOK, m.ResponseWebhookFromDBWebhook(webhook))
+	}
+}
+
+func (a *API) handleWebhookDeliveriesGet() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		webhook, badResp := a.webhookFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		deliveries, err := crud.GetWebhookDeliveries(a.db, webhook.ID, webhookDeliveryLogLimit)
+		if err != nil {
+			return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query webhook deliveries", err))
+		}
+		return c.NewGoodResponse(http.StatusOK, m.ResponseWebhookDeliveriesFromDBDeliveries(deliveries))
+	}
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/events"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteWait = 10 * time.Second
+	// wsPongWait ... a client that does not answer pings for that long is gone
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = wsPongWait * 9 / 10
+	// wsSendBuffer ... events queued for a slow client before it is disconnected
+	wsSendBuffer = 64
+	// wsReadLimit ... clients have nothing to say beyond control frames
+	wsReadLimit = 512
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// the bearer token is never sent implicitly by browsers so another origin
+	// cannot open a connection on behalf of a user
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+func (a *API) handleMailboxWebSocket() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) *c.APIResponse {
+		user, badResp := a.mailboxOwnerFromRequest(r)
+		if badResp != nil {
+			return badResp
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// the upgrader already answered the client
+			return c.NewWrittenResponse(http.StatusBadRequest, c.WrapError("websocket upgrade failed", err))
+		}
+		a.streams.Add(1)
+		defer a.streams.Done()
+		subscription := a.bus.Subscribe(user.ID, wsSendBuffer)
+		defer subscription.Close()
+		err = a.serveWebSocket(conn, user, streamToken(r), subscription)
+		return c.NewWrittenResponse(http.StatusSwitchingProtocols, err)
+	}
+}
+
+// wsReadLoop ... handle pongs and the close handshake, done is closed once the client is gone
+func wsReadLoop(conn *websocket.Conn, done chan<- struct{}) {
+	defer close(done)
+	conn.SetReadLimit(wsReadLimit)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func wsClose(conn *websocket.Conn, code int, reason string) error {
+	return conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsWriteWait))
+}
+
+// serveWebSocket ... push the events of subscription to conn until the client leaves, its
+// token stops being valid, it cannot keep up or the api shuts down
+func (a *API) serveWebSocket(conn *websocket.Conn, user *crud.User, token string, subscription *events.Subscription) error {
+	defer conn.Close()
+	clientGone := make(chan struct{})
+	go wsReadLoop(conn, clientGone)
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-clientGone:
+			return nil
+		case event, ok := <-subscription.Events():
+			if !ok {
+				if errors.Is(subscription.Err(), events.ErrSlowConsumer) {
+					return wsClose(conn, websocket.CloseTryAgainLater, "too many pending events")
+				}
+				if errors.Is(subscription.Err(), events.ErrEventsLost) {
+					return wsClose(conn, websocket.CloseTryAgainLater, "events were lost")
+				}
+				return wsClose(conn, websocket.CloseGoingAway, "server is shutting down")
+			}
+			rendered, ok, err := a.renderEvent(user, event)
+			if err != nil {
+				a.logger.Println(c.WrapError("failed to render event", err))
+				continue
+			}
+			if !ok {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err = conn.WriteJSON(rendered); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if !a.streamTokenValid(token) {
+				return wsClose(conn, websocket.ClosePolicyViolation, "authentication expired")
+			}
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/storage"
+	"gorm.io/gorm"
+)
+
+const sweepBatchSize = 100
+
+// ExpirySweep ... hard delete expired messages with everything attached to them. Blobs are deleted
+// before the rows so a failure is retried on the next run
+func ExpirySweep(db *gorm.DB, blobs storage.BlobStore) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		db := db.WithContext(ctx)
+		now := time.Now().UTC()
+		for {
+			expired, err := crud.GetExpiredMessages(db, now, sweepBatchSize)
+			if err != nil {
+				return err
+			}
+			if len(expired) == 0 {
+				return nil
+			}
+			attachments, err := crud.GetMessagesAttachments(db, expired)
+			if err != nil {
+				return err
+			}
+			for _, attachment := range attachments {
+				if err = blobs.Delete(ctx, attachment.StorageKey); err != nil {
+					return err
+				}
+			}
+			if err = crud.DeleteMessages(db, expired); err != nil {
+				return err
+			}
+			if len(expired) < sweepBatchSize {
+				return nil
+			}
+		}
+	}
+}
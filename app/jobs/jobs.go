@@ -0,0 +1,58 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Runner ... runs periodic jobs in the background until Stop is called
+type Runner struct {
+	logger *log.Logger
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewRunner(logger *log.Logger) *Runner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Runner{logger: logger, ctx: ctx, cancel: cancel}
+}
+
+// Every ... run job every interval, the first run happens after one interval
+// errors are logged and do not stop the job
+func (r *Runner) Every(name string, interval time.Duration, job func(ctx context.Context) error) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-ticker.C:
+				if err := job(r.ctx); err != nil {
+					r.logger.Printf("job %s failed: %v", name, err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop ... cancel the running jobs and wait for them to return or ctx to be done
+func (r *Runner) Stop(ctx context.Context) error {
+	r.cancel()
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
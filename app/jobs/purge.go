@@ -0,0 +1,57 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/storage"
+	"gorm.io/gorm"
+)
+
+const purgeBatchSize = 100
+
+// EventPurge ... forget the mailbox events older than retention, streams cannot resume from them anymore
+func EventPurge(db *gorm.DB, retention time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := crud.PurgeMailboxEvents(db.WithContext(ctx), time.Now().UTC().Add(-retention))
+		return err
+	}
+}
+
+// WebhookLogPurge ... delete the webhook deliveries done more than retention ago
+func WebhookLogPurge(db *gorm.DB, retention time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := crud.PurgeWebhookDeliveries(db.WithContext(ctx), time.Now().UTC().Add(-retention))
+		return err
+	}
+}
+
+// TrashPurge ... purge what stayed in the trash longer than retention, then the attachments of
+// purged messages. A blob is deleted before its row so a failure is retried on the next run
+func TrashPurge(db *gorm.DB, blobs storage.BlobStore, retention time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		db := db.WithContext(ctx)
+		_, err := crud.PurgeTrash(db, time.Now().UTC().Add(-retention))
+		if err != nil {
+			return err
+		}
+		for {
+			attachments, err := crud.GetPurgedAttachments(db, purgeBatchSize)
+			if err != nil {
+				return err
+			}
+			for _, attachment := range attachments {
+				if err = blobs.Delete(ctx, attachment.StorageKey); err != nil {
+					return err
+				}
+				if err = crud.DeleteAttachment(db, &attachment); err != nil {
+					return err
+				}
+			}
+			if len(attachments) < purgeBatchSize {
+				return nil
+			}
+		}
+	}
+}
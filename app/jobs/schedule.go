@@ -0,0 +1,36 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/events"
+	"gorm.io/gorm"
+)
+
+const deliveryBatchSize = 100
+
+// ScheduledDelivery ... deliver the messages whose send_at has passed, queued for the webhooks along the
+// way, and tell their readers. Several replicas can run it at the same time without delivering a message twice
+func ScheduledDelivery(db *gorm.DB, bus events.Bus) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		db := db.WithContext(ctx)
+		for {
+			delivered, err := crud.DeliverScheduledMessages(db, time.Now().UTC(), deliveryBatchSize)
+			if err != nil {
+				return err
+			}
+			published, err := crud.DeliveredEvents(db, delivered)
+			if err != nil {
+				return err
+			}
+			if err = crud.PublishEvents(ctx, db, bus, published); err != nil {
+				return err
+			}
+			if len(delivered) < deliveryBatchSize {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/aorticweb/msg-app/app/webhooks"
+	"gorm.io/gorm"
+)
+
+// WebhookDelivery ... send the queued webhook deliveries that are due, receivers get timeout to answer
+// and must be on public addresses unless allowPrivate. Global webhooks are only sent while owned by admins. Replicas claim the deliveries they send so that
+// a payload is not posted twice at the same time
+func WebhookDelivery(db *gorm.DB, admins []string, timeout time.Duration, allowPrivate bool) func(ctx context.Context) error {
+	client := webhooks.NewClient(timeout, allowPrivate)
+	return func(ctx context.Context) error {
+		return webhooks.DeliverDue(ctx, db.WithContext(ctx), client, admins, time.Now().UTC())
+	}
+}
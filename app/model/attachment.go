@@ -0,0 +1,266 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+)
+
+// AttachmentUpload ... file part of a multipart upload, its type is detected from its content. The content
+// is spooled to a temporary file rather than memory as the blob store needs its size up front, Close removes it
+type AttachmentUpload struct {
+	Filename    string
+	ContentType string
+	Size        int64
+	SHA256      string
+	file        *os.File
+}
+
+// Content ... the uploaded content from its start
+func (u *AttachmentUpload) Content() (io.Reader, error) {
+	_, err := u.file.Seek(0, io.SeekStart)
+	return u.file, err
+}
+
+func (u *AttachmentUpload) Close() error {
+	u.file.Close()
+	return os.Remove(u.file.Name())
+}
+
+// CloseUploads ... remove the content of every upload
+func CloseUploads(uploads []*AttachmentUpload) {
+	for _, upload := range uploads {
+		upload.Close()
+	}
+}
+
+type Attachment struct {
+	ID          int64     `json:"id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func allowedType(contentType string, types []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range types {
+		if strings.EqualFold(strings.TrimSpace(allowed), mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadFilename ... keep the base name only, clients send whatever path they like
+func uploadFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "." || name == "/" || name == "" {
+		return "attachment"
+	}
+	return name
+}
+
+// multipartOverhead ... room for the boundaries, part headers and sha256 part around the file
+const multipartOverhead = 64 << 10
+
+// MaxMessageAttachments ... files a message can be composed with
+const MaxMessageAttachments = 10
+
+// maxMessagePart ... of the message part of a message composed with attachments
+const maxMessagePart = 64 << 10
+
+// bodyTooLarge ... error of http.MaxBytesReader once the limit is reached, which is not exported
+func bodyTooLarge(err error) bool {
+	return strings.Contains(err.Error(), "http: request body too large")
+}
+
+func invalidMultipart(err error) *c.APIResponse {
+	return c.NewBadResponse(http.StatusBadRequest, "invalid multipart request", c.WrapError("multipart decoding error", err))
+}
+
+// IsMultipart ... whether r is a multipart/form-data request
+func IsMultipart(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// readFilePart ... spool the content of part, which must not be empty nor larger than maxSize and be
+// one of types
+func readFilePart(part *multipart.Part, maxSize int64, types []string, tooLarge *c.APIResponse) (*AttachmentUpload, *c.APIResponse) {
+	file, err := os.CreateTemp("", "msg-upload-*")
+	if err != nil {
+		return nil, c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to spool attachment", err))
+	}
+	upload := &AttachmentUpload{Filename: uploadFilename(part.FileName()), file: file}
+	hash := sha256.New()
+	upload.Size, err = io.Copy(io.MultiWriter(file, hash), io.LimitReader(part, maxSize+1))
+	if err != nil {
+		upload.Close()
+		if bodyTooLarge(err) {
+			return nil, tooLarge
+		}
+		return nil, invalidMultipart(err)
+	}
+	if upload.Size > maxSize {
+		upload.Close()
+		return nil, tooLarge
+	}
+	if upload.Size == 0 {
+		upload.Close()
+		return nil, c.NewBadResponse(http.StatusBadRequest, "attachment is empty", nil)
+	}
+	// the type is detected from the first 512 bytes at most
+	head := make([]byte, 512)
+	n, err := file.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		upload.Close()
+		return nil, c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to read spooled attachment", err))
+	}
+	upload.ContentType = http.DetectContentType(head[:n])
+	upload.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	if !allowedType(upload.ContentType, types) {
+		upload.Close()
+		return nil, c.NewBadResponse(http.StatusUnsupportedMediaType, fmt.Sprintf("attachments of type %s are not allowed", upload.ContentType), nil)
+	}
+	return upload, nil
+}
+
+// AttachmentUploadFromRequest ... read the single part named file of a multipart/form-data request,
+// an optional sha256 part must match the checksum of the file
+func AttachmentUploadFromRequest(w http.ResponseWriter, r *http.Request, maxSize int64, types []string) (*AttachmentUpload, *c.APIResponse) {
+	tooLarge := c.NewBadResponse(http.StatusRequestEntityTooLarge, fmt.Sprintf("attachments are limited to %d bytes", maxSize), nil)
+	// the parts that are not read are still consumed, the whole body is limited
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+multipartOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, c.NewBadResponse(http.StatusBadRequest, "expected a multipart/form-data request", nil)
+	}
+	var upload *AttachmentUpload
+	fail := func(badResp *c.APIResponse) (*AttachmentUpload, *c.APIResponse) {
+		if upload != nil {
+			upload.Close()
+		}
+		return nil, badResp
+	}
+	checksum := ""
+	seen := map[string]bool{}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if bodyTooLarge(err) {
+				return fail(tooLarge)
+			}
+			return fail(invalidMultipart(err))
+		}
+		name := part.FormName()
+		if (name == "file" || name == "sha256") && seen[name] {
+			return fail(c.NewBadResponse(http.StatusBadRequest, fmt.Sprintf("only one %s part is accepted", name), nil))
+		}
+		seen[name] = true
+		switch name {
+		case "sha256":
+			value, err := io.ReadAll(io.LimitReader(part, 128))
+			if err != nil {
+				return fail(invalidMultipart(err))
+			}
+			checksum = strings.ToLower(strings.TrimSpace(string(value)))
+		case "file":
+			var badResp *c.APIResponse
+			if upload, badResp = readFilePart(part, maxSize, types, tooLarge); badResp != nil {
+				return fail(badResp)
+			}
+		}
+	}
+	if upload == nil {
+		return nil, c.NewBadResponse(http.StatusBadRequest, "missing file part", nil)
+	}
+	if checksum != "" && checksum != upload.SHA256 {
+		return fail(c.NewBadResponse(http.StatusBadRequest, "sha256 does not match the uploaded file", nil))
+	}
+	return upload, nil
+}
+
+// MessageUploadFromRequest ... read a message composed with attachments from a multipart/form-data request,
+// its part named message holds the message as json along with up to MaxMessageAttachments parts named file
+func MessageUploadFromRequest(w http.ResponseWriter, r *http.Request, maxSize int64, types []string) (*ComposedMessage, []*AttachmentUpload, *c.APIResponse) {
+	tooLarge := c.NewBadResponse(http.StatusRequestEntityTooLarge, fmt.Sprintf("attachments are limited to %d bytes", maxSize), nil)
+	r.Body = http.MaxBytesReader(w, r.Body, MaxMessageAttachments*maxSize+maxMessagePart+multipartOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, nil, c.NewBadResponse(http.StatusBadRequest, "expected a multipart/form-data request", nil)
+	}
+	var message *ComposedMessage
+	uploads := []*AttachmentUpload{}
+	fail := func(badResp *c.APIResponse) (*ComposedMessage, []*AttachmentUpload, *c.APIResponse) {
+		CloseUploads(uploads)
+		return nil, nil, badResp
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if bodyTooLarge(err) {
+				return fail(tooLarge)
+			}
+			return fail(invalidMultipart(err))
+		}
+		switch part.FormName() {
+		case "message":
+			if message != nil {
+				return fail(c.NewBadResponse(http.StatusBadRequest, "only one message part is accepted", nil))
+			}
+			message = &ComposedMessage{}
+			err = json.NewDecoder(io.LimitReader(part, maxMessagePart)).Decode(message)
+			if err != nil {
+				return fail(c.NewBadResponse(http.StatusBadRequest, "invalid request", c.WrapError("JSON decoding error", err)))
+			}
+		case "file":
+			if len(uploads) == MaxMessageAttachments {
+				return fail(c.NewBadResponse(http.StatusBadRequest, fmt.Sprintf("messages are limited to %d attachments", MaxMessageAttachments), nil))
+			}
+			upload, badResp := readFilePart(part, maxSize, types, tooLarge)
+			if badResp != nil {
+				return fail(badResp)
+			}
+			uploads = append(uploads, upload)
+		}
+	}
+	if message == nil {
+		return fail(c.NewBadResponse(http.StatusBadRequest, "missing message part", nil))
+	}
+	return message, uploads, nil
+}
+
+func ResponseAttachmentFromDBAttachment(a *crud.Attachment) *Attachment {
+	return &Attachment{
+		ID:          a.ID,
+		Filename:    a.Filename,
+		ContentType: a.ContentType,
+		Size:        a.Size,
+		SHA256:      a.SHA256,
+		CreatedAt:   a.CreatedAt,
+	}
+}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"net/http"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+)
+
+const (
+	MailboxViewMessages      = "messages"
+	MailboxViewConversations = "conversations"
+)
+
+type Conversation struct {
+	Thread       int64    `json:"thread"`
+	Latest       Message  `json:"latest"`
+	Participants []string `json:"participants"`
+	MessageCount int64    `json:"message_count"`
+	UnreadCount  int64    `json:"unread_count"`
+}
+
+type ConversationPage struct {
+	Conversations []Conversation `json:"conversations"`
+	NextCursor    string         `json:"next_cursor,omitempty"`
+}
+
+// MailboxViewFromRequest ... read the view query parameter, messages or conversations
+func MailboxViewFromRequest(r *http.Request) (string, *c.APIResponse) {
+	switch view := r.URL.Query().Get("view"); view {
+	case "", MailboxViewMessages:
+		return MailboxViewMessages, nil
+	case MailboxViewConversations:
+		return view, nil
+	default:
+		return "", c.NewBadResponse(http.StatusBadRequest, "view must be messages or conversations", nil)
+	}
+}
+
+func ResponseConversationPageFromDBConversations(conversations []crud.Conversation, next *crud.Cursor, viewerID int64) *ConversationPage {
+	page := ConversationPage{Conversations: []Conversation{}}
+	for _, conversation := range conversations {
+		page.Conversations = append(page.Conversations, Conversation{
+			Thread:       conversation.ThreadID,
+			Latest:       *ResponseMessageFromDBMessage(&conversation.Latest, viewerID),
+			Participants: conversation.Participants,
+			MessageCount: conversation.MessageCount,
+			UnreadCount:  conversation.UnreadCount,
+		})
+	}
+	if next != nil {
+		page.NextCursor = next.Encode()
+	}
+	return &page
+}
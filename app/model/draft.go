@@ -0,0 +1,120 @@
+package model
+
+import (
+	"time"
+
+	"github.com/aorticweb/msg-app/app/crud"
+)
+
+// DraftPost ... body of POST /drafts, every field is optional until the draft is sent
+type DraftPost struct {
+	Subject   string              `json:"subject"`
+	Body      string              `json:"body"`
+	Recipient map[string]string   `json:"recipient"`
+	To        []map[string]string `json:"to,omitempty"`
+	Cc        []map[string]string `json:"cc,omitempty"`
+	Bcc       []map[string]string `json:"bcc,omitempty"`
+}
+
+func (d *DraftPost) ToDBDraft(owner *crud.User) *crud.Draft {
+	now := time.Now().UTC()
+	return &crud.Draft{
+		OwnerID: owner.ID,
+		Subject: d.Subject,
+		Body:    d.Body,
+		Recipients: crud.DraftRecipients{
+			Recipient: d.Recipient,
+			To:        d.To,
+			Cc:        d.Cc,
+			Bcc:       d.Bcc,
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// DraftPatch ... omitted fields are left unchanged, a recipient list that is
+// provided replaces the previous one
+type DraftPatch struct {
+	Subject   *string              `json:"subject"`
+	Body      *string              `json:"body"`
+	Recipient *map[string]string   `json:"recipient"`
+	To        *[]map[string]string `json:"to"`
+	Cc        *[]map[string]string `json:"cc"`
+	Bcc       *[]map[string]string `json:"bcc"`
+}
+
+func (p *DraftPatch) Apply(draft *crud.Draft) {
+	if p.Subject != nil {
+		draft.Subject = *p.Subject
+	}
+	if p.Body != nil {
+		draft.Body = *p.Body
+	}
+	if p.Recipient != nil {
+		draft.Recipients.Recipient = *p.Recipient
+	}
+	if p.To != nil {
+		draft.Recipients.To = *p.To
+	}
+	if p.Cc != nil {
+		draft.Recipients.Cc = *p.Cc
+	}
+	if p.Bcc != nil {
+		draft.Recipients.Bcc = *p.Bcc
+	}
+	draft.UpdatedAt = time.Now().UTC()
+}
+
+// ComposedMessageFromDBDraft ... the message a draft turns into once sent
+func ComposedMessageFromDBDraft(draft *crud.Draft) *ComposedMessage {
+	return &ComposedMessage{
+		ReplyMessage: ReplyMessage{
+			Subject: draft.Subject,
+			Body:    draft.Body,
+		},
+		Recipient: draft.Recipients.Recipient,
+		To:        draft.Recipients.To,
+		Cc:        draft.Recipients.Cc,
+		Bcc:       draft.Recipients.Bcc,
+	}
+}
+
+type Draft struct {
+	DraftPost
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type Drafts struct {
+	Drafts     []Draft `json:"drafts"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+func ResponseDraftFromDBDraft(d *crud.Draft) *Draft {
+	return &Draft{
+		DraftPost: DraftPost{
+			Subject:   d.Subject,
+			Body:      d.Body,
+			Recipient: d.Recipients.Recipient,
+			To:        d.Recipients.To,
+			Cc:        d.Recipients.Cc,
+			Bcc:       d.Recipients.Bcc,
+		},
+		ID:        d.ID,
+		CreatedAt: d.CreatedAt,
+		UpdatedAt: d.UpdatedAt,
+	}
+}
+
+func ResponseDraftsFromDBDrafts(drafts []crud.Draft, next *crud.Cursor) *Drafts {
+	resp := Drafts{Drafts: []Draft{}}
+	for _, draft := range drafts {
+		resp.Drafts = append(resp.Drafts, *ResponseDraftFromDBDraft(&draft))
+	}
+	if next != nil {
+		resp.NextCursor = next.Encode()
+	}
+	return &resp
+}
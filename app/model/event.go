@@ -0,0 +1,10 @@
+package model
+
+// MailboxEvent ... pushed to the clients streaming a mailbox
+type MailboxEvent struct {
+	// ID ... resume a stream after this event with Last-Event-ID
+	ID        int64    `json:"id,omitempty"`
+	Kind      string   `json:"kind"`
+	MessageID int64    `json:"message_id,omitempty"`
+	Message   *Message `json:"message,omitempty"`
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+)
+
+func timeParam(value string, name string) (*time.Time, *c.APIResponse) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, c.NewBadResponse(http.StatusBadRequest, name+" must be an RFC3339 timestamp", nil)
+	}
+	t = t.UTC()
+	return &t, nil
+}
+
+func boolParam(value string, name string) (*bool, *c.APIResponse) {
+	if value == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, c.NewBadResponse(http.StatusBadRequest, name+" must be true or false", nil)
+	}
+	return &b, nil
+}
+
+// MailboxFilterFromRequest ... read the sender, kind (group or direct), since, until,
+// unread, has_replies and subject query parameters
+func MailboxFilterFromRequest(r *http.Request) (*crud.MailboxFilter, *c.APIResponse) {
+	query := r.URL.Query()
+	filter := crud.MailboxFilter{
+		Sender:  query.Get("sender"),
+		Kind:    query.Get("kind"),
+		Subject: query.Get("subject"),
+	}
+	if filter.Kind != "" && filter.Kind != crud.MailboxKindGroup && filter.Kind != crud.MailboxKindDirect {
+		return nil, c.NewBadResponse(http.StatusBadRequest, "kind must be group or direct", nil)
+	}
+	var badResp *c.APIResponse
+	if filter.Since, badResp = timeParam(query.Get("since"), "since"); badResp != nil {
+		return nil, badResp
+	}
+	if filter.Until, badResp = timeParam(query.Get("until"), "until"); badResp != nil {
+		return nil, badResp
+	}
+	unread, badResp := boolParam(query.Get("unread"), "unread")
+	if badResp != nil {
+		return nil, badResp
+	}
+	filter.UnreadOnly = unread != nil && *unread
+	if filter.HasReplies, badResp = boolParam(query.Get("has_replies"), "has_replies"); badResp != nil {
+		return nil, badResp
+	}
+	return &filter, nil
+}
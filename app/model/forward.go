@@ -0,0 +1,71 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+	"gorm.io/gorm"
+)
+
+const forwardPrefix = "Fwd: "
+
+// ForwardPost ... body of POST /messages/{id}/forward, recipients work as in ComposedMessage
+type ForwardPost struct {
+	// Body ... optional note written above the forwarded message
+	Body      string              `json:"body"`
+	Recipient map[string]string   `json:"recipient"`
+	To        []map[string]string `json:"to,omitempty"`
+	Cc        []map[string]string `json:"cc,omitempty"`
+	Bcc       []map[string]string `json:"bcc,omitempty"`
+}
+
+// forwardSubject ... subject prefixed once, forwarding a forward does not stack prefixes
+func forwardSubject(subject string) string {
+	if strings.HasPrefix(strings.ToLower(subject), strings.ToLower(forwardPrefix)) {
+		return subject
+	}
+	return forwardPrefix + subject
+}
+
+// forwardBody ... note followed by the original message quoted with its sender and time
+func forwardBody(note string, original *crud.Message) string {
+	var b strings.Builder
+	if note != "" {
+		b.WriteString(note)
+		b.WriteString("\n\n")
+	}
+	b.WriteString("---------- Forwarded message ----------\n")
+	fmt.Fprintf(&b, "From: %s\n", original.Sender.Username)
+	fmt.Fprintf(&b, "Date: %s\n", original.SentAt.UTC().Format(time.RFC1123))
+	fmt.Fprintf(&b, "Subject: %s\n\n", original.Subject)
+	b.WriteString(original.Body)
+	return b.String()
+}
+
+// Validate ... message forwarding original to the requested recipients, the caller is
+// expected to have checked that sender can read original
+func (f *ForwardPost) Validate(db *gorm.DB, sender *crud.User, original *crud.Message) (*crud.Message, *c.APIResponse) {
+	composed := ComposedMessage{
+		ReplyMessage: ReplyMessage{
+			Subject: forwardSubject(original.Subject),
+			Body:    forwardBody(f.Body, original),
+		},
+		Recipient: f.Recipient,
+		To:        f.To,
+		Cc:        f.Cc,
+		Bcc:       f.Bcc,
+	}
+	msg, badResp := composed.Validate(db, sender)
+	if badResp != nil {
+		return nil, badResp
+	}
+	msg.ForwardedFromID = &original.ID
+	// a forward does not outlive the message it quotes
+	if original.ExpiresAt != nil && (msg.ExpiresAt == nil || msg.ExpiresAt.After(*original.ExpiresAt)) {
+		msg.ExpiresAt = original.ExpiresAt
+	}
+	return msg, nil
+}
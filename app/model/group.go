@@ -1,6 +1,60 @@
 package model
 
+import (
+	"net/http"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+)
+
 type GroupPost struct {
 	Groupname string   `json:"groupname" validate:"required"`
 	Usernames []string `json:"usernames" validate:"required"`
 }
+
+// GroupPatch ... omitted fields are left unchanged, a default_ttl of 0 stops messages
+// to the group from expiring by default
+type GroupPatch struct {
+	Groupname  string `json:"groupname"`
+	DefaultTTL *int64 `json:"default_ttl" validate:"omitempty,min=0,max=315360000"`
+}
+
+func (p *GroupPatch) Validate() *c.APIResponse {
+	if p.Groupname == "" && p.DefaultTTL == nil {
+		return c.NewBadResponse(http.StatusBadRequest, "provide groupname or default_ttl", nil)
+	}
+	return nil
+}
+
+type GroupMember struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+type Group struct {
+	Groupname  string        `json:"groupname"`
+	Usernames  []string      `json:"usernames"`
+	Members    []GroupMember `json:"members"`
+	DefaultTTL *int64        `json:"default_ttl,omitempty"`
+}
+
+type GroupMembersPost struct {
+	Usernames []string `json:"usernames" validate:"required,min=1"`
+}
+
+type GroupMemberPut struct {
+	Role string `json:"role" validate:"required,oneof=admin member"`
+}
+
+type GroupOwnerPost struct {
+	Username string `json:"username" validate:"required"`
+}
+
+func ResponseGroupFromDBGroup(g *crud.Group, members []crud.UserGroup) *Group {
+	group := Group{Groupname: g.Groupname, Usernames: []string{}, Members: []GroupMember{}, DefaultTTL: g.DefaultTTL}
+	for _, member := range members {
+		group.Usernames = append(group.Usernames, member.User.Username)
+		group.Members = append(group.Members, GroupMember{Username: member.User.Username, Role: member.Role})
+	}
+	return &group
+}
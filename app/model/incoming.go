@@ -0,0 +1,79 @@
+package model
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+)
+
+// IncomingWebhookPost ... body of POST /groups/{groupname}/incoming-webhooks, name followed by
+// [bot] is the username of the bot posting the messages
+type IncomingWebhookPost struct {
+	Name string `json:"name" validate:"required,max=64"`
+}
+
+func (p *IncomingWebhookPost) Validate() *c.APIResponse {
+	if strings.ContainsAny(p.Name, "/?#% ") || crud.IsBotUsername(p.Name) {
+		return c.NewBadResponse(http.StatusBadRequest, "name cannot contain spaces, /, ?, #, % nor end with "+crud.BotSuffix, nil)
+	}
+	return nil
+}
+
+type IncomingWebhook struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Username  string `json:"username"`
+	Groupname string `json:"groupname"`
+	// Token ... only returned on creation, to post with in the X-Msg-Token header
+	Token     string     `json:"token,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type IncomingWebhooks struct {
+	IncomingWebhooks []IncomingWebhook `json:"incoming_webhooks"`
+}
+
+func ResponseIncomingWebhookFromDBWebhook(w *crud.IncomingWebhook, group *crud.Group) *IncomingWebhook {
+	return &IncomingWebhook{
+		ID:        w.ID,
+		Name:      w.Name,
+		Username:  w.Bot.Username,
+		Groupname: group.Groupname,
+		CreatedAt: w.CreatedAt,
+		RevokedAt: w.RevokedAt,
+	}
+}
+
+func ResponseIncomingWebhooksFromDBWebhooks(webhooks []crud.IncomingWebhook, group *crud.Group) *IncomingWebhooks {
+	resp := IncomingWebhooks{IncomingWebhooks: []IncomingWebhook{}}
+	for _, webhook := range webhooks {
+		resp.IncomingWebhooks = append(resp.IncomingWebhooks, *ResponseIncomingWebhookFromDBWebhook(&webhook, group))
+	}
+	return &resp
+}
+
+// IncomingMessage ... body of POST /incoming-webhooks/messages, subject defaults to the name of the webhook
+type IncomingMessage struct {
+	Subject string `json:"subject" validate:"max=240"`
+	Body    string `json:"body" validate:"required"`
+}
+
+// Message ... message from the bot of webhook to its group, expiring with the default ttl of the group
+func (m *IncomingMessage) Message(webhook *crud.IncomingWebhook) *crud.Message {
+	msg := crud.Message{
+		Sender:  webhook.Bot,
+		Subject: m.Subject,
+		Body:    m.Body,
+		SentAt:  time.Now().UTC(),
+	}
+	if msg.Subject == "" {
+		msg.Subject = webhook.Name
+	}
+	setRecipients(&msg, []crud.MessageRecipient{{GroupID: &webhook.GroupID, Group: webhook.Group, Role: crud.RecipientTo}})
+	setExpiry(&msg, nil)
+	return &msg
+}
@@ -6,33 +6,134 @@ import (
 
 	c "github.com/aorticweb/msg-app/app/common"
 	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/policy"
 	"gorm.io/gorm"
 )
 
 type ReplyMessage struct {
-	Sender  string `json:"sender" validate:"required"`
+	// Deprecated: the sender is the authenticated caller, when provided
+	// the field must match the authenticated username
+	Sender  string `json:"sender"`
 	Subject string `json:"subject" validate:"required"`
 	Body    string `json:"body" validate:"required"`
+	// TTL ... seconds after which the message expires, defaults to the shortest
+	// default ttl of its group recipients
+	TTL *int64 `json:"ttl,omitempty" validate:"omitempty,min=1,max=315360000"`
 }
 
-func (rm *ReplyMessage) ValidateSender(db *gorm.DB) (*crud.User, *c.APIResponse) {
-	sender, exist, err := crud.FindUser(db, rm.Sender)
-	if err != nil {
-		return nil, c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query users", err))
+func (rm *ReplyMessage) ValidateSender(sender *crud.User) *c.APIResponse {
+	if rm.Sender != "" && rm.Sender != sender.Username {
+		return c.NewBadResponse(http.StatusForbidden, "sender does not match authenticated user", nil)
 	}
-	if !exist {
-		return nil, c.NewBadResponse(http.StatusNotFound, "user with given username does not exist", nil)
+	return nil
+}
+
+const (
+	ReplyModeSender = "sender"
+	ReplyModeAll    = "all"
+)
+
+// ReplyPost ... body of POST /messages/{id}/replies
+type ReplyPost struct {
+	ReplyMessage
+	// Mode ... sender replies privately to the sender of the message, all (default)
+	// also replies to its to and cc recipients
+	Mode string `json:"mode" validate:"omitempty,oneof=sender all"`
+}
+
+// setRecipients ... a user or group listed twice keeps its first role, the first
+// to recipient becomes the message Recipient or Group
+func setRecipients(msg *crud.Message, recipients []crud.MessageRecipient) {
+	seenUsers, seenGroups := map[int64]bool{}, map[int64]bool{}
+	for _, recipient := range recipients {
+		if recipient.UserID != nil {
+			if seenUsers[*recipient.UserID] {
+				continue
+			}
+			seenUsers[*recipient.UserID] = true
+		} else {
+			if seenGroups[*recipient.GroupID] {
+				continue
+			}
+			seenGroups[*recipient.GroupID] = true
+		}
+		msg.Recipients = append(msg.Recipients, recipient)
+	}
+	if len(msg.Recipients) > 0 && msg.Recipients[0].Role == crud.RecipientTo {
+		msg.Recipient, msg.Group = msg.Recipients[0].User, msg.Recipients[0].Group
+	}
+}
+
+// setExpiry ... expiry of msg from ttl or, when there is none, from its group recipients
+func setExpiry(msg *crud.Message, ttl *int64) {
+	if ttl == nil {
+		for _, recipient := range msg.Recipients {
+			if recipient.Group == nil || recipient.Group.DefaultTTL == nil {
+				continue
+			}
+			if ttl == nil || *recipient.Group.DefaultTTL < *ttl {
+				ttl = recipient.Group.DefaultTTL
+			}
+		}
+	}
+	if ttl != nil {
+		expiresAt := msg.SentAt.Add(time.Duration(*ttl) * time.Second)
+		msg.ExpiresAt = &expiresAt
+	}
+}
+
+// carryOver ... recipients of reMessage in role, except sender and deleted groups, copied in role as
+func carryOver(reMessage *crud.Message, sender *crud.User, role string, as string) []crud.MessageRecipient {
+	recipients := []crud.MessageRecipient{}
+	for _, original := range reMessage.Recipients {
+		if original.Role != role || (original.UserID != nil && *original.UserID == sender.ID) {
+			continue
+		}
+		if original.Group != nil && original.Group.DeletedAt != nil {
+			continue
+		}
+		recipients = append(recipients, crud.MessageRecipient{
+			UserID: original.UserID, User: original.User, GroupID: original.GroupID, Group: original.Group, Role: as,
+		})
+	}
+	return recipients
+}
+
+// replyRecipients ... who a reply of sender to reMessage goes to, bcc recipients are never
+// disclosed by a reply all
+func replyRecipients(reMessage *crud.Message, sender *crud.User, mode string) []crud.MessageRecipient {
+	selfReply := reMessage.SenderID != nil && *reMessage.SenderID == sender.ID
+	recipients := []crud.MessageRecipient{}
+	if !selfReply {
+		recipients = append(recipients, crud.MessageRecipient{UserID: reMessage.SenderID, User: reMessage.Sender, Role: crud.RecipientTo})
+	}
+	switch {
+	case mode != ReplyModeSender:
+		recipients = append(recipients, carryOver(reMessage, sender, crud.RecipientTo, crud.RecipientTo)...)
+		recipients = append(recipients, carryOver(reMessage, sender, crud.RecipientCc, crud.RecipientCc)...)
+	case selfReply:
+		// the sender of your own message is you, reply to who you sent it to instead. Bcc recipients
+		// would all be disclosed to each other, a bcc only message gets a note to self
+		for _, role := range []string{crud.RecipientTo, crud.RecipientCc} {
+			if recipients = carryOver(reMessage, sender, role, crud.RecipientTo); len(recipients) > 0 {
+				break
+			}
+		}
+	}
+	if len(recipients) == 0 {
+		// a note to self stays a note to self
+		recipients = append(recipients, crud.MessageRecipient{UserID: &sender.ID, User: sender, Role: crud.RecipientTo})
 	}
-	return sender, nil
+	return recipients
 }
 
-func (rm *ReplyMessage) Validate(db *gorm.DB, reID int64) (*crud.Message, *c.APIResponse) {
+func (rm *ReplyMessage) Validate(db *gorm.DB, sender *crud.User, reID int64, mode string) (*crud.Message, *c.APIResponse) {
 	msg := crud.Message{
 		Subject: rm.Subject,
 		Body:    rm.Body,
 		SentAt:  time.Now().UTC(),
 	}
-	sender, badResp := rm.ValidateSender(db)
+	badResp := rm.ValidateSender(sender)
 	if badResp != nil {
 		return nil, badResp
 	}
@@ -44,36 +145,40 @@ func (rm *ReplyMessage) Validate(db *gorm.DB, reID int64) (*crud.Message, *c.API
 	if !exist {
 		return nil, c.NewBadResponse(http.StatusNotFound, "message with given id does not exist", nil)
 	}
-	msg.REID = &reMessage.ID
-	if reMessage.Group != nil {
-		msg.Group = reMessage.Group
-		return &msg, nil
+	badResp = policy.AuthorizeMessageRead(db, sender, reMessage)
+	if badResp != nil {
+		return nil, badResp
+	}
+	if reMessage.DeletedAt != nil {
+		return nil, c.NewBadResponse(http.StatusGone, "cannot reply to a deleted message", nil)
+	}
+	if reMessage.SendAt != nil {
+		return nil, c.NewBadResponse(http.StatusConflict, "cannot reply to a message that is not sent yet", nil)
 	}
-	msg.Recipient = reMessage.Sender
+	msg.REID = &reMessage.ID
+	setRecipients(&msg, replyRecipients(reMessage, sender, mode))
+	setExpiry(&msg, rm.TTL)
 	return &msg, nil
 }
 
 type ComposedMessage struct {
 	ReplyMessage
-	Recipient map[string]string `json:"recipient" validate:"required"` // Either crud.User or crud.Group
+	// Recipient ... a single to recipient, either {"username": ...} or {"groupname": ...}
+	Recipient map[string]string   `json:"recipient"`
+	To        []map[string]string `json:"to,omitempty"`
+	Cc        []map[string]string `json:"cc,omitempty"`
+	Bcc       []map[string]string `json:"bcc,omitempty"`
+	// SendAt ... deliver the message at this time instead of right away
+	SendAt *time.Time `json:"send_at,omitempty"`
 }
 
-func (m *ComposedMessage) Validate(db *gorm.DB) (*crud.Message, *c.APIResponse) {
-	msg := crud.Message{
-		Subject: m.Subject,
-		Body:    m.Body,
-		SentAt:  time.Now().UTC(),
-	}
-	username, usernameFound := m.Recipient["username"]
-	groupname, groupnameFound := m.Recipient["groupname"]
-	if usernameFound && groupnameFound {
+// resolveRecipient ... user or group named by recipient, which must hold exactly one of username or groupname
+func resolveRecipient(db *gorm.DB, recipient map[string]string, role string) (*crud.MessageRecipient, *c.APIResponse) {
+	username, usernameFound := recipient["username"]
+	groupname, groupnameFound := recipient["groupname"]
+	if usernameFound == groupnameFound {
 		return nil, c.NewBadResponse(http.StatusBadRequest, "invalid request", nil)
 	}
-	sender, badResp := m.ValidateSender(db)
-	if badResp != nil {
-		return nil, badResp
-	}
-	msg.Sender = sender
 	if usernameFound {
 		user, exist, err := crud.FindUser(db, username)
 		if err != nil {
@@ -82,31 +187,98 @@ func (m *ComposedMessage) Validate(db *gorm.DB) (*crud.Message, *c.APIResponse)
 		if !exist {
 			return nil, c.NewBadResponse(http.StatusNotFound, "recipient user with given username does not exist", nil)
 		}
-		msg.Recipient = user
-		return &msg, nil
+		return &crud.MessageRecipient{UserID: &user.ID, User: user, Role: role}, nil
 	}
-	if groupnameFound {
-		group, exist, err := crud.FindGroup(db, groupname)
-		if err != nil {
-			return nil, c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query group", err))
+	group, exist, err := crud.FindGroup(db, groupname)
+	if err != nil {
+		return nil, c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query group", err))
+	}
+	if !exist {
+		return nil, c.NewBadResponse(http.StatusNotFound, "recipient group with given groupname does not exist", nil)
+	}
+	return &crud.MessageRecipient{GroupID: &group.ID, Group: group, Role: role}, nil
+}
+
+// Validate ... recipient is merged into to, a user or group listed in several roles keeps
+// the most visible one (to, then cc, then bcc). The first to recipient is the message
+// Recipient or Group
+func (m *ComposedMessage) Validate(db *gorm.DB, sender *crud.User) (*crud.Message, *c.APIResponse) {
+	msg := crud.Message{
+		Subject: m.Subject,
+		Body:    m.Body,
+		SentAt:  time.Now().UTC(),
+	}
+	badResp := m.ValidateSender(sender)
+	if badResp != nil {
+		return nil, badResp
+	}
+	msg.Sender = sender
+	if m.SendAt != nil {
+		if !m.SendAt.After(msg.SentAt) {
+			return nil, c.NewBadResponse(http.StatusBadRequest, "send_at must be in the future", nil)
 		}
-		if !exist {
-			return nil, c.NewBadResponse(http.StatusNotFound, "recipient group with given groupname does not exist", nil)
+		sendAt := m.SendAt.UTC()
+		msg.SendAt, msg.SentAt = &sendAt, sendAt
+	}
+	recipients := []crud.MessageRecipient{}
+	to := m.To
+	if len(m.Recipient) > 0 {
+		to = append([]map[string]string{m.Recipient}, to...)
+	}
+	roles := []struct {
+		role       string
+		recipients []map[string]string
+	}{{crud.RecipientTo, to}, {crud.RecipientCc, m.Cc}, {crud.RecipientBcc, m.Bcc}}
+	for _, role := range roles {
+		for _, recipient := range role.recipients {
+			resolved, badResp := resolveRecipient(db, recipient, role.role)
+			if badResp != nil {
+				return nil, badResp
+			}
+			recipients = append(recipients, *resolved)
 		}
-		msg.Group = group
-		return &msg, nil
 	}
-	return nil, c.NewBadResponse(http.StatusBadRequest, "invalid request", nil)
+	if len(recipients) == 0 {
+		return nil, c.NewBadResponse(http.StatusBadRequest, "invalid request", nil)
+	}
+	setRecipients(&msg, recipients)
+	setExpiry(&msg, m.TTL)
+	return &msg, nil
 }
 
 type Message struct {
 	ComposedMessage
 	ID     int64     `json:"id" validate:"required"`
 	RE     *int64    `json:"re"`
+	Thread *int64    `json:"thread,omitempty"`
 	SentAt time.Time `json:"sent_at" validate:"required"`
+	Unread *bool     `json:"unread,omitempty"`
+	// ExpiresAt ... the message is deleted for everyone at this time
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// ForwardedFrom ... id of the message this one forwards
+	ForwardedFrom *int64 `json:"forwarded_from,omitempty"`
+	// EditedAt ... time of the last edit, previous contents are listed by the revisions endpoint
+	EditedAt *time.Time `json:"edited_at,omitempty"`
+	// Attachments ... only listed when fetching a single message
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// Deleted ... deleted for everyone, subject and body are left empty
+	Deleted   bool       `json:"deleted,omitempty"`
+	TrashedAt *time.Time `json:"trashed_at,omitempty"`
+}
+
+func recipientMap(r *crud.MessageRecipient) map[string]string {
+	if r.Group != nil {
+		return map[string]string{"groupname": r.Group.Groupname}
+	}
+	if r.User != nil {
+		return map[string]string{"username": r.User.Username}
+	}
+	return map[string]string{}
 }
 
-func ResponseMessageFromDBMessage(m *crud.Message) *Message {
+// ResponseMessageFromDBMessage ... as seen by viewer, bcc recipients are only listed
+// to the sender and a bcc recipient only sees themself
+func ResponseMessageFromDBMessage(m *crud.Message, viewerID int64) *Message {
 	msg := Message{
 		ID: m.ID,
 		ComposedMessage: ComposedMessage{
@@ -116,16 +288,43 @@ func ResponseMessageFromDBMessage(m *crud.Message) *Message {
 				Sender:  m.Sender.Username,
 			},
 			Recipient: make(map[string]string),
+			SendAt:    m.SendAt,
 		},
-		SentAt: m.SentAt,
+		Thread:        m.ThreadID,
+		ForwardedFrom: m.ForwardedFromID,
+		ExpiresAt:     m.ExpiresAt,
+		SentAt:        m.SentAt,
+		Unread:        m.Unread,
+		EditedAt:      m.EditedAt,
+		TrashedAt:     m.TrashedAt,
 	}
-	// Purposefully not raising an error here if
-	// both user and group are missing because of db constraint
+	for _, attachment := range m.Attachments {
+		msg.Attachments = append(msg.Attachments, *ResponseAttachmentFromDBAttachment(&attachment))
+	}
+	if m.DeletedAt != nil {
+		msg.Deleted = true
+		msg.Subject, msg.Body, msg.Attachments = "", "", nil
+	}
+	// Purposefully not raising an error here if both user and group
+	// are missing, messages with cc or bcc recipients only have none
 	if m.Group != nil {
 		msg.Recipient["groupname"] = m.Group.Groupname
 	} else if m.Recipient != nil {
 		msg.Recipient["username"] = m.Recipient.Username
 	}
+	isSender := m.SenderID != nil && *m.SenderID == viewerID
+	for _, recipient := range m.Recipients {
+		switch recipient.Role {
+		case crud.RecipientTo:
+			msg.To = append(msg.To, recipientMap(&recipient))
+		case crud.RecipientCc:
+			msg.Cc = append(msg.Cc, recipientMap(&recipient))
+		case crud.RecipientBcc:
+			if isSender || (recipient.UserID != nil && *recipient.UserID == viewerID) {
+				msg.Bcc = append(msg.Bcc, recipientMap(&recipient))
+			}
+		}
+	}
 	if m.REID != nil {
 		msg.RE = m.REID
 	}
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"net/http"
+	"strconv"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+)
+
+type MessagePage struct {
+	Messages   []Message `json:"messages"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// PageFromRequest ... read the limit, cursor and sort (asc or desc) query parameters,
+// limit defaults to crud.DefaultPageLimit and is capped to crud.MaxPageLimit
+func PageFromRequest(r *http.Request) (*crud.Page, *c.APIResponse) {
+	page := crud.Page{Limit: crud.DefaultPageLimit}
+	query := r.URL.Query()
+	if limit := query.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 {
+			return nil, c.NewBadResponse(http.StatusBadRequest, "limit must be a positive integer", nil)
+		}
+		page.Limit = value
+	}
+	if page.Limit > crud.MaxPageLimit {
+		page.Limit = crud.MaxPageLimit
+	}
+	switch query.Get("sort") {
+	case "", "desc":
+	case "asc":
+		page.Ascending = true
+	default:
+		return nil, c.NewBadResponse(http.StatusBadRequest, "sort must be asc or desc", nil)
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		after, err := crud.DecodeCursor(cursor)
+		if err != nil {
+			return nil, c.NewBadResponse(http.StatusBadRequest, "invalid cursor", nil)
+		}
+		page.After = after
+	}
+	return &page, nil
+}
+
+func ResponseMessagePageFromDBMessages(msgs []crud.Message, next *crud.Cursor, viewerID int64) *MessagePage {
+	page := MessagePage{Messages: []Message{}}
+	for _, msg := range msgs {
+		page.Messages = append(page.Messages, *ResponseMessageFromDBMessage(&msg, viewerID))
+	}
+	if next != nil {
+		page.NextCursor = next.Encode()
+	}
+	return &page
+}
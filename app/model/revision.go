@@ -0,0 +1,46 @@
+package model
+
+import (
+	"net/http"
+	"time"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+)
+
+// MessagePatch ... omitted fields are left unchanged
+type MessagePatch struct {
+	Subject *string `json:"subject" validate:"omitempty,min=1"`
+	Body    *string `json:"body" validate:"omitempty,min=1"`
+}
+
+func (p *MessagePatch) Validate() *c.APIResponse {
+	if p.Subject == nil && p.Body == nil {
+		return c.NewBadResponse(http.StatusBadRequest, "provide subject or body", nil)
+	}
+	return nil
+}
+
+type Revision struct {
+	Subject    string    `json:"subject"`
+	Body       string    `json:"body"`
+	WrittenAt  time.Time `json:"written_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+type Revisions struct {
+	Revisions []Revision `json:"revisions"`
+}
+
+func ResponseRevisionsFromDBRevisions(revisions []crud.MessageRevision) *Revisions {
+	resp := Revisions{Revisions: []Revision{}}
+	for _, revision := range revisions {
+		resp.Revisions = append(resp.Revisions, Revision{
+			Subject:    revision.Subject,
+			Body:       revision.Body,
+			WrittenAt:  revision.WrittenAt,
+			ReplacedAt: revision.ReplacedAt,
+		})
+	}
+	return &resp
+}
@@ -0,0 +1,20 @@
+package model
+
+import (
+	"net/http"
+	"time"
+
+	c "github.com/aorticweb/msg-app/app/common"
+)
+
+// SchedulePut ... body of PUT /messages/{id}/schedule
+type SchedulePut struct {
+	SendAt time.Time `json:"send_at" validate:"required"`
+}
+
+func (s *SchedulePut) Validate() (time.Time, *c.APIResponse) {
+	if !s.SendAt.After(time.Now()) {
+		return time.Time{}, c.NewBadResponse(http.StatusBadRequest, "send_at must be in the future", nil)
+	}
+	return s.SendAt.UTC(), nil
+}
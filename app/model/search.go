@@ -0,0 +1,66 @@
+package model
+
+import (
+	"net/http"
+	"strconv"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+)
+
+type SearchQuery struct {
+	Q      string
+	Limit  int
+	Offset int
+}
+
+type SearchResult struct {
+	Message Message `json:"message"`
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+type SearchPage struct {
+	Results    []SearchResult `json:"results"`
+	NextOffset *int           `json:"next_offset,omitempty"`
+}
+
+// SearchQueryFromRequest ... read the q, limit and offset query parameters
+func SearchQueryFromRequest(r *http.Request) (*SearchQuery, *c.APIResponse) {
+	query := r.URL.Query()
+	search := SearchQuery{Q: query.Get("q"), Limit: crud.DefaultPageLimit}
+	if search.Q == "" {
+		return nil, c.NewBadResponse(http.StatusBadRequest, "q is required", nil)
+	}
+	if limit := query.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 {
+			return nil, c.NewBadResponse(http.StatusBadRequest, "limit must be a positive integer", nil)
+		}
+		search.Limit = value
+	}
+	if search.Limit > crud.MaxPageLimit {
+		search.Limit = crud.MaxPageLimit
+	}
+	if offset := query.Get("offset"); offset != "" {
+		value, err := strconv.Atoi(offset)
+		if err != nil || value < 0 {
+			return nil, c.NewBadResponse(http.StatusBadRequest, "offset must be a positive integer", nil)
+		}
+		search.Offset = value
+	}
+	return &search, nil
+}
+
+// ResponseSearchPageFromDBResults ... next is the offset of the following page, nil on the last one
+func ResponseSearchPageFromDBResults(results []crud.SearchResult, next *int, viewerID int64) *SearchPage {
+	page := SearchPage{Results: []SearchResult{}, NextOffset: next}
+	for _, result := range results {
+		page.Results = append(page.Results, SearchResult{
+			Message: *ResponseMessageFromDBMessage(&result.Message, viewerID),
+			Rank:    result.Rank,
+			Snippet: result.Snippet,
+		})
+	}
+	return &page
+}
@@ -0,0 +1,24 @@
+package model
+
+import (
+	"net/http"
+
+	c "github.com/aorticweb/msg-app/app/common"
+)
+
+// MessageStatePost ... either a list of message ids or all the mailbox
+type MessageStatePost struct {
+	IDs []int64 `json:"ids"`
+	All bool    `json:"all"`
+}
+
+func (s *MessageStatePost) Validate() *c.APIResponse {
+	if s.All == (len(s.IDs) > 0) {
+		return c.NewBadResponse(http.StatusBadRequest, "provide either ids or all", nil)
+	}
+	return nil
+}
+
+type UnreadCount struct {
+	Unread int64 `json:"unread"`
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"net/http"
+	"strconv"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+)
+
+const (
+	ThreadFormatTree = "tree"
+	ThreadFormatFlat = "flat"
+)
+
+type ThreadQuery struct {
+	MaxDepth int
+	Format   string
+}
+
+type ThreadMessage struct {
+	Message
+	Depth   int              `json:"depth"`
+	Replies []*ThreadMessage `json:"replies,omitempty"`
+}
+
+// Thread ... in the tree format Messages only holds the root, replies are nested below it
+type Thread struct {
+	Messages []*ThreadMessage `json:"messages"`
+}
+
+// ThreadQueryFromRequest ... read the max_depth and format (tree or flat) query parameters
+func ThreadQueryFromRequest(r *http.Request) (*ThreadQuery, *c.APIResponse) {
+	query := r.URL.Query()
+	thread := ThreadQuery{MaxDepth: crud.MaxThreadDepth, Format: ThreadFormatTree}
+	if maxDepth := query.Get("max_depth"); maxDepth != "" {
+		value, err := strconv.Atoi(maxDepth)
+		if err != nil || value < 0 {
+			return nil, c.NewBadResponse(http.StatusBadRequest, "max_depth must be a positive integer", nil)
+		}
+		thread.MaxDepth = value
+	}
+	if thread.MaxDepth > crud.MaxThreadDepth {
+		thread.MaxDepth = crud.MaxThreadDepth
+	}
+	if format := query.Get("format"); format != "" {
+		if format != ThreadFormatTree && format != ThreadFormatFlat {
+			return nil, c.NewBadResponse(http.StatusBadRequest, "format must be tree or flat", nil)
+		}
+		thread.Format = format
+	}
+	return &thread, nil
+}
+
+// ResponseThreadFromDBNodes ... nodes are ordered oldest first, the root has depth 0
+func ResponseThreadFromDBNodes(nodes []crud.ThreadNode, format string, viewerID int64) *Thread {
+	thread := Thread{Messages: []*ThreadMessage{}}
+	byID := map[int64]*ThreadMessage{}
+	for _, node := range nodes {
+		msg := &ThreadMessage{Message: *ResponseMessageFromDBMessage(&node.Message, viewerID), Depth: node.Depth}
+		byID[msg.ID] = msg
+		if format == ThreadFormatFlat || node.Depth == 0 {
+			thread.Messages = append(thread.Messages, msg)
+		}
+	}
+	if format == ThreadFormatFlat {
+		return &thread
+	}
+	for _, node := range nodes {
+		if node.Depth == 0 || node.Message.REID == nil {
+			continue
+		}
+		if parent, ok := byID[*node.Message.REID]; ok {
+			parent.Replies = append(parent.Replies, byID[node.Message.ID])
+		}
+	}
+	return &thread
+}
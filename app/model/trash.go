@@ -0,0 +1,25 @@
+package model
+
+import (
+	"net/http"
+
+	c "github.com/aorticweb/msg-app/app/common"
+)
+
+const (
+	DeleteScopeMe       = "me"
+	DeleteScopeEveryone = "everyone"
+)
+
+// DeleteScopeFromRequest ... read the scope query parameter, me (default) moves the message
+// to the trash of the caller, everyone deletes it for all its readers
+func DeleteScopeFromRequest(r *http.Request) (string, *c.APIResponse) {
+	switch scope := r.URL.Query().Get("scope"); scope {
+	case "", DeleteScopeMe:
+		return DeleteScopeMe, nil
+	case DeleteScopeEveryone:
+		return scope, nil
+	default:
+		return "", c.NewBadResponse(http.StatusBadRequest, "scope must be me or everyone", nil)
+	}
+}
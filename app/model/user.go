@@ -0,0 +1,37 @@
+package model
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type UserPost struct {
+	Username string `json:"username" validate:"required"`
+	// Password ... bcrypt ignores what follows the first 72 bytes, max would count runes
+	Password string `json:"password" validate:"required,min=8,maxbytes=72"`
+}
+
+type Credentials struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required,maxbytes=72"`
+}
+
+// maxBytes ... string field of at most param bytes
+func maxBytes(fl validator.FieldLevel) bool {
+	limit, err := strconv.Atoi(fl.Param())
+	return err == nil && len(fl.Field().String()) <= limit
+}
+
+// NewValidator ... validator of the api inputs along with the validations of the models
+func NewValidator() *validator.Validate {
+	validate := validator.New()
+	validate.RegisterValidation("maxbytes", maxBytes)
+	return validate
+}
+
+type AuthToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,116 @@
+package model
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+)
+
+// WebhookEventMessage ... a message was delivered
+const WebhookEventMessage = crud.WebhookEventMessage
+
+// WebhookPost ... body of POST /webhooks, groupname is required for group webhooks only
+type WebhookPost struct {
+	URL       string `json:"url" validate:"required,url,max=2048"`
+	Scope     string `json:"scope" validate:"required,oneof=user group global"`
+	Groupname string `json:"groupname"`
+}
+
+func (p *WebhookPost) Validate() *c.APIResponse {
+	parsed, err := url.Parse(p.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return c.NewBadResponse(http.StatusBadRequest, "webhook url must be http or https", nil)
+	}
+	if (p.Scope == crud.WebhookScopeGroup) != (p.Groupname != "") {
+		return c.NewBadResponse(http.StatusBadRequest, "groupname is required for group webhooks and only for them", nil)
+	}
+	return nil
+}
+
+type Webhook struct {
+	ID        int64  `json:"id"`
+	URL       string `json:"url"`
+	Scope     string `json:"scope"`
+	Groupname string `json:"groupname,omitempty"`
+	// Secret ... only returned on creation, key of the X-Msg-Signature of the payloads
+	Secret       string     `json:"secret,omitempty"`
+	Enabled      bool       `json:"enabled"`
+	FailureCount int        `json:"failure_count"`
+	DisabledAt   *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+type Webhooks struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+func ResponseWebhookFromDBWebhook(w *crud.Webhook) *Webhook {
+	webhook := Webhook{
+		ID:           w.ID,
+		URL:          w.URL,
+		Scope:        w.Scope,
+		Enabled:      w.DisabledAt == nil,
+		FailureCount: w.FailureCount,
+		DisabledAt:   w.DisabledAt,
+		CreatedAt:    w.CreatedAt,
+	}
+	if w.Group != nil {
+		webhook.Groupname = w.Group.Groupname
+	}
+	return &webhook
+}
+
+func ResponseWebhooksFromDBWebhooks(webhooks []crud.Webhook) *Webhooks {
+	resp := Webhooks{Webhooks: []Webhook{}}
+	for _, webhook := range webhooks {
+		resp.Webhooks = append(resp.Webhooks, *ResponseWebhookFromDBWebhook(&webhook))
+	}
+	return &resp
+}
+
+// WebhookPayload ... JSON body posted to webhooks
+type WebhookPayload struct {
+	Event     string    `json:"event"`
+	WebhookID int64     `json:"webhook_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Message   *Message  `json:"message"`
+}
+
+type WebhookDelivery struct {
+	ID             int64      `json:"id"`
+	Event          string     `json:"event"`
+	MessageID      *int64     `json:"message_id,omitempty"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at,omitempty"`
+	LastStatusCode *int       `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+type WebhookDeliveries struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+}
+
+func ResponseWebhookDeliveriesFromDBDeliveries(deliveries []crud.WebhookDelivery) *WebhookDeliveries {
+	resp := WebhookDeliveries{Deliveries: []WebhookDelivery{}}
+	for _, d := range deliveries {
+		resp.Deliveries = append(resp.Deliveries, WebhookDelivery{
+			ID:             d.ID,
+			Event:          d.Event,
+			MessageID:      d.MessageID,
+			Status:         d.Status,
+			Attempts:       d.Attempts,
+			NextAttemptAt:  d.NextAttemptAt,
+			LastAttemptAt:  d.LastAttemptAt,
+			LastStatusCode: d.LastStatusCode,
+			LastError:      d.LastError,
+			CreatedAt:      d.CreatedAt,
+		})
+	}
+	return &resp
+}
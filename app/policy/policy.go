@@ -0,0 +1,136 @@
+package policy
+
+import (
+	"net/http"
+	"time"
+
+	c "github.com/aorticweb/msg-app/app/common"
+	"github.com/aorticweb/msg-app/app/crud"
+	"gorm.io/gorm"
+)
+
+// Denials on a message are reported as 404 so that callers cannot probe which
+// message ids exist, denials on a resource identified by a public name
+// (username) are reported as 403.
+
+var MessageNotFoundResponse c.APIResponse = *c.NewBadResponse(http.StatusNotFound, "message not found", nil)
+
+// AuthorizeMessageRead ... a message can be read by its sender, its direct recipient
+// or a member of its group
+func AuthorizeMessageRead(db *gorm.DB, user *crud.User, msg *crud.Message) *c.APIResponse {
+	visible, err := crud.IsMessageVisible(db, msg.ID, user.ID)
+	if err != nil {
+		return c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query message visibility", err))
+	}
+	if !visible {
+		return &MessageNotFoundResponse
+	}
+	return nil
+}
+
+// AuthorizeDeleteForEveryone ... only the sender can delete a message for everyone,
+// and only within window of sending it
+func AuthorizeDeleteForEveryone(user *crud.User, msg *crud.Message, window time.Duration) *c.APIResponse {
+	if msg.SenderID == nil || *msg.SenderID != user.ID {
+		return c.NewBadResponse(http.StatusForbidden, "only the sender can delete a message for everyone", nil)
+	}
+	if msg.SendAt != nil {
+		return c.NewBadResponse(http.StatusConflict, "message is not sent yet, cancel its scheduled send instead", nil)
+	}
+	if time.Since(msg.SentAt) > window {
+		return c.NewBadResponse(http.StatusForbidden, "message can no longer be deleted for everyone", nil)
+	}
+	return nil
+}
+
+// AuthorizeMessageEdit ... only the sender can edit a message, within window of sending it
+func AuthorizeMessageEdit(user *crud.User, msg *crud.Message, window time.Duration) *c.APIResponse {
+	if msg.SenderID == nil || *msg.SenderID != user.ID {
+		return c.NewBadResponse(http.StatusForbidden, "only the sender can edit a message", nil)
+	}
+	if msg.DeletedAt != nil {
+		return c.NewBadResponse(http.StatusGone, "cannot edit a deleted message", nil)
+	}
+	if time.Since(msg.SentAt) > window {
+		return c.NewBadResponse(http.StatusForbidden, "message can no longer be edited", nil)
+	}
+	return nil
+}
+
+// AuthorizeScheduleChange ... only the sender can reschedule or cancel a message, as long as it was not delivered
+func AuthorizeScheduleChange(user *crud.User, msg *crud.Message) *c.APIResponse {
+	if msg.SenderID == nil || *msg.SenderID != user.ID {
+		return c.NewBadResponse(http.StatusForbidden, "only the sender can change when a message is sent", nil)
+	}
+	if msg.SendAt == nil {
+		return c.NewBadResponse(http.StatusConflict, "message was already sent", nil)
+	}
+	return nil
+}
+
+// AuthorizeMailboxRead ... users can only read their own mailbox
+func AuthorizeMailboxRead(user *crud.User, username string) *c.APIResponse {
+	if user.Username != username {
+		return c.NewBadResponse(http.StatusForbidden, "cannot access another user's mailbox", nil)
+	}
+	return nil
+}
+
+// AuthorizeGroupMember ... group details and membership are only available to members
+func AuthorizeGroupMember(db *gorm.DB, user *crud.User, group *crud.Group) (*crud.UserGroup, *c.APIResponse) {
+	membership, member, err := crud.GetGroupMembership(db, group.ID, user.ID)
+	if err != nil {
+		return nil, c.NewBadResponse(http.StatusInternalServerError, "", c.WrapError("failed to query group membership", err))
+	}
+	if !member {
+		return nil, c.NewBadResponse(http.StatusForbidden, "not a member of the group", nil)
+	}
+	return membership, nil
+}
+
+// AuthorizeGroupManage ... membership, name and deletion of a group are restricted to owners and admins
+func AuthorizeGroupManage(membership *crud.UserGroup) *c.APIResponse {
+	if !membership.IsManager() {
+		return c.NewBadResponse(http.StatusForbidden, "only group owners and admins can manage the group", nil)
+	}
+	return nil
+}
+
+// AuthorizeGroupOwner ... ownership transfer is restricted to owners
+func AuthorizeGroupOwner(membership *crud.UserGroup) *c.APIResponse {
+	if membership.Role != crud.RoleOwner {
+		return c.NewBadResponse(http.StatusForbidden, "only group owners can perform this action", nil)
+	}
+	return nil
+}
+
+// AuthorizeMemberChange ... managers can remove or change the role of plain members,
+// only owners can do so for admins and other owners
+func AuthorizeMemberChange(caller *crud.UserGroup, target *crud.UserGroup) *c.APIResponse {
+	badResp := AuthorizeGroupManage(caller)
+	if badResp != nil {
+		return badResp
+	}
+	if target.Role != crud.RoleMember {
+		return AuthorizeGroupOwner(caller)
+	}
+	return nil
+}
+
+// IsAdmin ... user is one of the configured admins
+func IsAdmin(user *crud.User, admins []string) bool {
+	for _, admin := range admins {
+		if admin == user.Username {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthorizeAdmin ... actions on the whole api, e.g. global webhooks, are restricted to the configured admins
+func AuthorizeAdmin(user *crud.User, admins []string) *c.APIResponse {
+	if IsAdmin(user, admins) {
+		return nil
+	}
+	return c.NewBadResponse(http.StatusForbidden, "only admins can perform this action", nil)
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// unsignedPayload ... S3 accepts requests whose body is not part of the signature,
+// uploads can then be streamed without being hashed first
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3Config ... any S3 compatible service (AWS, MinIO, ...) reached with path style urls
+type S3Config struct {
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
+// S3Store ... blobs stored as objects of a bucket, requests are signed with AWS signature v4
+type S3Store struct {
+	config S3Config
+	client *http.Client
+	now    func() time.Time
+}
+
+func NewS3Store(config S3Config, client *http.Client) (*S3Store, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, fmt.Errorf("s3 store needs an endpoint and a bucket")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &S3Store{config: config, client: client, now: time.Now}, nil
+}
+
+// uriEncode ... percent encode everything but the unreserved characters as S3 expects
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		unreserved := 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~", c) >= 0
+		if unreserved || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func (s *S3Store) newRequest(ctx context.Context, method string, key string, body io.Reader) (*http.Request, error) {
+	path := "/" + uriEncode(s.config.Bucket, true) + "/" + uriEncode(strings.TrimPrefix(key, "/"), false)
+	endpoint, err := url.Parse(strings.TrimSuffix(s.config.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint.String()+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawPath = endpoint.Path + path
+	s.sign(req, endpoint.Path+path)
+	return req, nil
+}
+
+// sign ... add the headers of an AWS signature v4 to req
+func (s *S3Store) sign(req *http.Request, canonicalURI string) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + unsignedPayload + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	canonicalRequest := strings.Join([]string{req.Method, canonicalURI, "", canonicalHeaders, signedHeaders, unsignedPayload}, "\n")
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := date + "/" + s.config.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretKey), date)
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKey, scope, signedHeaders, signature,
+	))
+}
+
+// unexpectedStatus ... error carrying the start of the S3 error document
+func unexpectedStatus(resp *http.Response, method string, key string) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("s3 %s %q: unexpected status %d: %s", method, key, resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	req, err := s.newRequest(ctx, http.MethodPut, key, r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return unexpectedStatus(resp, req.Method, key)
+	}
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrBlobNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, unexpectedStatus(resp, req.Method, key)
+	}
+	return resp.Body, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	req, err := s.newRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// S3 answers 204 whether the object existed or not
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return unexpectedStatus(resp, req.Method, key)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore ... keeps the content of attachments out of the database, blobs are
+// identified by a key chosen by the caller
+type BlobStore interface {
+	// Put ... store size bytes read from r under key, overwriting any previous blob
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get ... content of the blob stored under key, ErrBlobNotFound when there is none
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete ... remove the blob stored under key, deleting a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// Copy ... duplicate the blob stored under src to dst, both keys then have independent lifetimes
+func Copy(ctx context.Context, store BlobStore, src string, dst string, size int64, contentType string) error {
+	blob, err := store.Get(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+	return store.Put(ctx, dst, blob, size, contentType)
+}
@@ -0,0 +1,80 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress ... webhooks cannot reach the network of the api, e.g. cloud metadata services
+var ErrForbiddenAddress = errors.New("webhook address is loopback, private or link-local")
+
+// forbiddenIP ... addresses of the host and of its private networks
+func forbiddenIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
+
+// CheckURL ... every address the host of rawURL resolves to must be public, the addresses are checked
+// again when sending since they can change in between
+func CheckURL(ctx context.Context, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := parsed.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if forbiddenIP(ip) {
+			return ErrForbiddenAddress
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if forbiddenIP(addr.IP) {
+			return ErrForbiddenAddress
+		}
+	}
+	return nil
+}
+
+// dialControl ... refuse connections to forbidden addresses once resolved, so that a host cannot be
+// rebound to one after CheckURL
+func dialControl(network string, address string, conn syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || forbiddenIP(ip) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// NewClient ... client posting to webhooks with timeout, it only connects to public addresses unless
+// allowPrivate, e.g. for local development, and never follows redirects
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = dialControl
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// a proxy would be dialed instead of the webhook address
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,195 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aorticweb/msg-app/app/crud"
+	m "github.com/aorticweb/msg-app/app/model"
+	"github.com/aorticweb/msg-app/app/policy"
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxAttempts ... a delivery still failing after that many attempts is given up
+	MaxAttempts = 10
+	// DisableAfter ... failed attempts in a row after which a webhook is disabled
+	DisableAfter = 20
+	retryBase    = 30 * time.Second
+	retryMax     = 6 * time.Hour
+	// claimBatch ... deliveries claimed at once, they are sent one after the other
+	claimBatch = 10
+	// claimMargin ... added to the time it takes to send a whole batch to hide it from the other replicas,
+	// covers recording the attempts
+	claimMargin = time.Minute
+	// maxErrorLength ... of the error kept in the delivery log
+	maxErrorLength = 512
+	// maxDrainLength ... of the response read to reuse the connection
+	maxDrainLength = 4 << 10
+
+	HeaderEvent     = "X-Msg-Event"
+	HeaderDelivery  = "X-Msg-Delivery"
+	HeaderTimestamp = "X-Msg-Timestamp"
+	HeaderSignature = "X-Msg-Signature"
+)
+
+// Sign ... hex HMAC-SHA256 of "timestamp.body" keyed with secret, receivers compute it again to
+// check the payload and reject old timestamps to prevent replays
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// RetryDelay ... wait before the next attempt of a delivery that failed attempts times
+func RetryDelay(attempts int) time.Duration {
+	delay := retryBase
+	for i := 1; i < attempts && delay < retryMax; i++ {
+		delay *= 2
+	}
+	if delay > retryMax {
+		return retryMax
+	}
+	return delay
+}
+
+// viewerOf ... user whose view of messages webhook gets, group and global webhooks do not see bcc recipients
+func viewerOf(webhook *crud.Webhook) int64 {
+	if webhook.Scope == crud.WebhookScopeUser {
+		return webhook.OwnerID
+	}
+	return 0
+}
+
+// render ... payload of delivery from its message as it is now, found is false when the message
+// expired or was deleted since it was queued
+func render(db *gorm.DB, delivery *crud.WebhookDelivery) ([]byte, bool, error) {
+	if delivery.MessageID == nil {
+		return nil, false, nil
+	}
+	dbMessage, exist, err := crud.GetMessage(db, *delivery.MessageID)
+	if err != nil || !exist || dbMessage.DeletedAt != nil {
+		return nil, false, err
+	}
+	payload, err := json.Marshal(m.WebhookPayload{
+		Event:     delivery.Event,
+		WebhookID: delivery.WebhookID,
+		CreatedAt: delivery.CreatedAt,
+		Message:   m.ResponseMessageFromDBMessage(dbMessage, viewerOf(delivery.Webhook)),
+	})
+	return payload, true, err
+}
+
+// send ... post delivery to its webhook, a non 2xx response is an error. Redirects are not followed
+// by the client and are errors as well
+func send(ctx context.Context, client *http.Client, delivery *crud.WebhookDelivery, body []byte, now time.Time) (*int, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", delivery.Webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "msg-app-webhooks")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, "sha256="+Sign(delivery.Webhook.Secret, timestamp, body))
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	// the response is never stored, it could be the content of an internal page
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxDrainLength))
+	if 200 <= resp.StatusCode && resp.StatusCode < 300 {
+		return &resp.StatusCode, nil
+	}
+	return &resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+}
+
+// attempt ... send delivery once and record the outcome, scheduling a retry when it failed. Deliveries
+// of messages that expired or were deleted, or of global webhooks whose owner is no longer one of
+// admins, are canceled instead. The attempt is stamped with the time it is sent, receivers reject old timestamps
+func attempt(ctx context.Context, db *gorm.DB, client *http.Client, admins []string, delivery *crud.WebhookDelivery) error {
+	webhook := delivery.Webhook
+	if webhook.Scope == crud.WebhookScopeGlobal && (webhook.Owner == nil || !policy.IsAdmin(webhook.Owner, admins)) {
+		return crud.CancelWebhookDelivery(db, delivery, "webhook owner is no longer an admin")
+	}
+	body, found, err := render(db, delivery)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return crud.CancelWebhookDelivery(db, delivery, "message is no longer available")
+	}
+	now := time.Now().UTC()
+	statusCode, err := send(ctx, client, delivery, body, now)
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.LastStatusCode = statusCode
+	delivery.LastError = ""
+	delivery.NextAttemptAt = nil
+	switch {
+	case err == nil:
+		delivery.Status = crud.WebhookDeliverySucceeded
+	case delivery.Attempts >= MaxAttempts:
+		delivery.Status = crud.WebhookDeliveryFailed
+	default:
+		next := now.Add(RetryDelay(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+	}
+	if err != nil {
+		delivery.LastError = err.Error()
+		if len(delivery.LastError) > maxErrorLength {
+			delivery.LastError = delivery.LastError[:maxErrorLength]
+		}
+	}
+	return crud.RecordWebhookAttempt(db, delivery, err != nil, DisableAfter)
+}
+
+// DeliverDue ... attempt the deliveries due at now one after the other, client should come from NewClient
+// and admins are the usernames allowed to own global webhooks.
+// Claimed deliveries are hidden from the other replicas for longer than it can take to send them all so
+// that a receiver never gets the same delivery from two replicas at once
+func DeliverDue(ctx context.Context, db *gorm.DB, client *http.Client, admins []string, now time.Time) error {
+	if client.Timeout <= 0 {
+		return errors.New("webhook client must have a timeout")
+	}
+	lease := claimBatch*client.Timeout + claimMargin
+	for {
+		// the lease runs from when the batch is claimed, never before now so that it hides the batch
+		leaseStart := time.Now().UTC()
+		if leaseStart.Before(now) {
+			leaseStart = now
+		}
+		deliveries, err := crud.ClaimWebhookDeliveries(db, now, leaseStart.Add(lease), claimBatch)
+		if err != nil {
+			return err
+		}
+		for i := range deliveries {
+			if err = ctx.Err(); err != nil {
+				// the claimed deliveries are retried once their lease is over
+				return err
+			}
+			if err = attempt(ctx, db, client, admins, &deliveries[i]); err != nil {
+				return err
+			}
+		}
+		if len(deliveries) < claimBatch {
+			return nil
+		}
+	}
+}
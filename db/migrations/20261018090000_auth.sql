@@ -0,0 +1,14 @@
+-- migrate:up
+alter table public.user add column if not exists password_hash VARCHAR(60);
+create table if not exists auth_token (
+    id SERIAL primary key,
+    token_hash CHAR(64) unique not null,
+    user_id int references public.user(id) on delete cascade not null,
+    created_at timestamp with time zone not null default now(),
+    expires_at timestamp with time zone not null
+);
+create index if not exists auth_token_user_id on auth_token(user_id);
+
+-- migrate:down
+drop table if exists auth_token;
+alter table public.user drop column if exists password_hash;
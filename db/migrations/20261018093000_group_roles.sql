@@ -0,0 +1,23 @@
+-- migrate:up
+alter table user_group add column if not exists role VARCHAR(16) not null default 'member';
+alter table user_group add constraint user_group_role_check CHECK (role in ('owner', 'admin', 'member'));
+-- every existing group gets its oldest member as owner
+update user_group set role = 'owner' where id in (select min(id) from user_group group by group_id);
+
+-- deleting a group removes its memberships and messages, replies lose their parent
+alter table user_group drop constraint if exists user_group_group_id_fkey;
+alter table user_group add constraint user_group_group_id_fkey foreign key (group_id) references public.group(id) on delete cascade;
+alter table message drop constraint if exists message_group_id_fkey;
+alter table message add constraint message_group_id_fkey foreign key (group_id) references public.group(id) on delete cascade;
+alter table message drop constraint if exists message_re_id_fkey;
+alter table message add constraint message_re_id_fkey foreign key (re_id) references message(id) on delete set null;
+
+-- migrate:down
+alter table message drop constraint if exists message_re_id_fkey;
+alter table message add constraint message_re_id_fkey foreign key (re_id) references message(id);
+alter table message drop constraint if exists message_group_id_fkey;
+alter table message add constraint message_group_id_fkey foreign key (group_id) references public.group(id);
+alter table user_group drop constraint if exists user_group_group_id_fkey;
+alter table user_group add constraint user_group_group_id_fkey foreign key (group_id) references public.group(id);
+alter table user_group drop constraint if exists user_group_role_check;
+alter table user_group drop column if exists role;
@@ -0,0 +1,11 @@
+-- migrate:up
+create table if not exists message_state (
+    id SERIAL primary key,
+    message_id int references message(id) on delete cascade not null,
+    user_id int references public.user(id) on delete cascade not null,
+    read_at timestamp with time zone null,
+    CONSTRAINT message_state_unique_user_message UNIQUE (user_id, message_id)
+);
+
+-- migrate:down
+drop table if exists message_state;
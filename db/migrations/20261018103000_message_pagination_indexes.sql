@@ -0,0 +1,9 @@
+-- migrate:up
+create index if not exists message_recipient_id_sent_at on message(recipient_id, sent_at desc, id desc);
+create index if not exists message_group_id_sent_at on message(group_id, sent_at desc, id desc);
+create index if not exists message_re_id_sent_at on message(re_id, sent_at desc, id desc);
+
+-- migrate:down
+drop index if exists message_re_id_sent_at;
+drop index if exists message_group_id_sent_at;
+drop index if exists message_recipient_id_sent_at;
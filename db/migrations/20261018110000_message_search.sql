@@ -0,0 +1,10 @@
+-- migrate:up
+alter table message add column if not exists search tsvector generated always as (
+    setweight(to_tsvector('english', coalesce(subject, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(body, '')), 'B')
+) stored;
+create index if not exists message_search on message using gin(search);
+
+-- migrate:down
+drop index if exists message_search;
+alter table message drop column if exists search;
@@ -0,0 +1,5 @@
+-- migrate:up
+create index if not exists message_sender_id_sent_at on message(sender_id, sent_at desc, id desc);
+
+-- migrate:down
+drop index if exists message_sender_id_sent_at;
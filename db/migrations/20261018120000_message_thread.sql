@@ -0,0 +1,13 @@
+-- migrate:up
+alter table message add column if not exists thread_id int references message(id) on delete set null;
+with recursive threads as (
+    select id, id as thread_id from message where re_id is null
+    union all
+    select message.id, threads.thread_id from message join threads on message.re_id = threads.id
+)
+update message set thread_id = threads.thread_id from threads where message.id = threads.id;
+create index if not exists message_thread_id_sent_at on message(thread_id, sent_at desc, id desc);
+
+-- migrate:down
+drop index if exists message_thread_id_sent_at;
+alter table message drop column if exists thread_id;
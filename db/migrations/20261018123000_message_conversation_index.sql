@@ -0,0 +1,5 @@
+-- migrate:up
+create index if not exists message_thread_key_sent_at on message((coalesce(thread_id, id)), sent_at desc, id desc);
+
+-- migrate:down
+drop index if exists message_thread_key_sent_at;
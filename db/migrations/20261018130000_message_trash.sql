@@ -0,0 +1,15 @@
+-- migrate:up
+alter table message add column if not exists deleted_at timestamp with time zone null;
+alter table message add column if not exists purged_at timestamp with time zone null;
+alter table message_state add column if not exists deleted_at timestamp with time zone null;
+alter table message_state add column if not exists purged_at timestamp with time zone null;
+create index if not exists message_deleted_at on message(deleted_at) where deleted_at is not null and purged_at is null;
+create index if not exists message_state_deleted_at on message_state(deleted_at) where deleted_at is not null and purged_at is null;
+
+-- migrate:down
+drop index if exists message_state_deleted_at;
+drop index if exists message_deleted_at;
+alter table message_state drop column if exists purged_at;
+alter table message_state drop column if exists deleted_at;
+alter table message drop column if exists purged_at;
+alter table message drop column if exists deleted_at;
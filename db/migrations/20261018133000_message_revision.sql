@@ -0,0 +1,15 @@
+-- migrate:up
+alter table message add column if not exists edited_at timestamp with time zone null;
+create table if not exists message_revision (
+    id SERIAL primary key,
+    message_id int references message(id) on delete cascade not null,
+    subject text,
+    body text,
+    written_at timestamp with time zone not null,
+    replaced_at timestamp with time zone not null
+);
+create index if not exists message_revision_message_id on message_revision(message_id, replaced_at);
+
+-- migrate:down
+drop table if exists message_revision;
+alter table message drop column if exists edited_at;
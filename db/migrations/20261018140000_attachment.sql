@@ -0,0 +1,15 @@
+-- migrate:up
+create table if not exists attachment (
+    id SERIAL primary key,
+    message_id int references message(id) on delete cascade not null,
+    filename text not null,
+    content_type text not null,
+    size bigint not null,
+    sha256 char(64) not null,
+    storage_key text unique not null,
+    created_at timestamp with time zone not null
+);
+create index if not exists attachment_message_id on attachment(message_id);
+
+-- migrate:down
+drop table if exists attachment;
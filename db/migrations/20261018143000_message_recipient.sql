@@ -0,0 +1,23 @@
+-- migrate:up
+create table if not exists message_recipient (
+    id SERIAL primary key,
+    message_id int references message(id) on delete cascade not null,
+    user_id int references public.user(id) on delete cascade null,
+    group_id int references public.group(id) on delete cascade null,
+    role varchar(3) not null default 'to',
+    CONSTRAINT message_recipient_role CHECK (role in ('to', 'cc', 'bcc')),
+    CONSTRAINT message_recipient_user_or_group CHECK ((user_id is null) <> (group_id is null))
+);
+create unique index if not exists message_recipient_unique_user on message_recipient(message_id, user_id) where user_id is not null;
+create unique index if not exists message_recipient_unique_group on message_recipient(message_id, group_id) where group_id is not null;
+create index if not exists message_recipient_user_id on message_recipient(user_id) where user_id is not null;
+create index if not exists message_recipient_group_id on message_recipient(group_id) where group_id is not null;
+insert into message_recipient (message_id, user_id, role) select id, recipient_id, 'to' from message where recipient_id is not null;
+insert into message_recipient (message_id, group_id, role) select id, group_id, 'to' from message where group_id is not null;
+-- recipient_id and group_id only hold the first to recipient, a message can have cc or bcc recipients only
+alter table message drop constraint if exists message_check;
+
+-- migrate:down
+delete from message where recipient_id is null and group_id is null;
+alter table message add constraint message_check CHECK (recipient_id is not null OR group_id is not null);
+drop table if exists message_recipient;
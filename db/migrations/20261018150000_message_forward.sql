@@ -0,0 +1,7 @@
+-- migrate:up
+alter table message add column if not exists forwarded_from_id int references message(id) on delete set null;
+create index if not exists message_forwarded_from_id on message(forwarded_from_id);
+
+-- migrate:down
+drop index if exists message_forwarded_from_id;
+alter table message drop column if exists forwarded_from_id;
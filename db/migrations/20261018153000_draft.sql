@@ -0,0 +1,14 @@
+-- migrate:up
+create table if not exists draft (
+    id SERIAL primary key,
+    owner_id int references public.user(id) on delete cascade not null,
+    subject text not null default '',
+    body text not null default '',
+    recipients jsonb not null default '{}',
+    created_at timestamp with time zone not null,
+    updated_at timestamp with time zone not null
+);
+create index if not exists draft_owner_id_updated_at on draft(owner_id, updated_at desc, id desc);
+
+-- migrate:down
+drop table if exists draft;
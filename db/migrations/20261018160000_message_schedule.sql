@@ -0,0 +1,7 @@
+-- migrate:up
+alter table message add column if not exists send_at timestamp with time zone null;
+create index if not exists message_send_at on message(send_at) where send_at is not null;
+
+-- migrate:down
+drop index if exists message_send_at;
+alter table message drop column if exists send_at;
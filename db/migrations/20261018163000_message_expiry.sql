@@ -0,0 +1,9 @@
+-- migrate:up
+alter table message add column if not exists expires_at timestamp with time zone null;
+create index if not exists message_expires_at on message(expires_at) where expires_at is not null;
+alter table public.group add column if not exists default_ttl int null check (default_ttl > 0);
+
+-- migrate:down
+alter table public.group drop column if exists default_ttl;
+drop index if exists message_expires_at;
+alter table message drop column if exists expires_at;
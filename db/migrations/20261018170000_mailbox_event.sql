@@ -0,0 +1,13 @@
+-- migrate:up
+create table if not exists mailbox_event (
+    id BIGSERIAL primary key,
+    user_id int references public.user(id) on delete cascade not null,
+    kind text not null,
+    message_id bigint null,
+    created_at timestamp with time zone not null
+);
+create index if not exists mailbox_event_user_id_id on mailbox_event(user_id, id);
+create index if not exists mailbox_event_created_at on mailbox_event(created_at);
+
+-- migrate:down
+drop table if exists mailbox_event;
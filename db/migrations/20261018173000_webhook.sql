@@ -0,0 +1,36 @@
+-- migrate:up
+create table if not exists webhook (
+    id SERIAL primary key,
+    owner_id int references public.user(id) on delete cascade not null,
+    scope text not null check (scope in ('user', 'group', 'global')),
+    group_id int null references public.group(id) on delete cascade,
+    url text not null,
+    secret text not null,
+    failure_count int not null default 0,
+    disabled_at timestamp with time zone null,
+    created_at timestamp with time zone not null,
+    check ((scope = 'group') = (group_id is not null))
+);
+create index if not exists webhook_owner_id on webhook(owner_id);
+create index if not exists webhook_group_id on webhook(group_id) where group_id is not null;
+
+create table if not exists webhook_delivery (
+    id BIGSERIAL primary key,
+    webhook_id int references webhook(id) on delete cascade not null,
+    message_id bigint null references message(id) on delete set null,
+    event text not null,
+    payload text not null,
+    status text not null check (status in ('pending', 'succeeded', 'failed')),
+    attempts int not null default 0,
+    next_attempt_at timestamp with time zone null,
+    last_attempt_at timestamp with time zone null,
+    last_status_code int null,
+    last_error text not null default '',
+    created_at timestamp with time zone not null
+);
+create index if not exists webhook_delivery_due on webhook_delivery(next_attempt_at) where status = 'pending';
+create index if not exists webhook_delivery_webhook_id on webhook_delivery(webhook_id, id desc);
+
+-- migrate:down
+drop table if exists webhook_delivery;
+drop table if exists webhook;
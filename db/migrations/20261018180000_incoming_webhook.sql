@@ -0,0 +1,15 @@
+-- migrate:up
+create table if not exists incoming_webhook (
+    id SERIAL primary key,
+    group_id int references public.group(id) on delete cascade not null,
+    bot_id int references public.user(id) not null,
+    name varchar(64) not null,
+    token_hash CHAR(64) unique not null,
+    created_by int null references public.user(id) on delete set null,
+    created_at timestamp with time zone not null,
+    revoked_at timestamp with time zone null
+);
+create index if not exists incoming_webhook_group_id on incoming_webhook(group_id);
+
+-- migrate:down
+drop table if exists incoming_webhook;
@@ -0,0 +1,12 @@
+-- migrate:up
+alter table webhook_delivery drop column if exists payload;
+alter table webhook_delivery drop constraint if exists webhook_delivery_status_check;
+alter table webhook_delivery add constraint webhook_delivery_status_check check (status in ('pending', 'succeeded', 'failed', 'canceled'));
+create index if not exists webhook_delivery_done on webhook_delivery(created_at) where status <> 'pending';
+
+-- migrate:down
+drop index if exists webhook_delivery_done;
+delete from webhook_delivery where status = 'canceled';
+alter table webhook_delivery drop constraint if exists webhook_delivery_status_check;
+alter table webhook_delivery add constraint webhook_delivery_status_check check (status in ('pending', 'succeeded', 'failed'));
+alter table webhook_delivery add column if not exists payload text not null default '';
@@ -0,0 +1,20 @@
+-- migrate:up
+-- deleted groups are kept so that the history of their members survives them
+alter table public.group add column if not exists deleted_at timestamp with time zone null;
+
+alter table message drop constraint if exists message_group_id_fkey;
+alter table message add constraint message_group_id_fkey foreign key (group_id) references public.group(id);
+alter table message_recipient drop constraint if exists message_recipient_group_id_fkey;
+alter table message_recipient add constraint message_recipient_group_id_fkey foreign key (group_id) references public.group(id);
+alter table user_group drop constraint if exists user_group_group_id_fkey;
+alter table user_group add constraint user_group_group_id_fkey foreign key (group_id) references public.group(id);
+
+-- migrate:down
+alter table user_group drop constraint if exists user_group_group_id_fkey;
+alter table user_group add constraint user_group_group_id_fkey foreign key (group_id) references public.group(id) on delete cascade;
+alter table message_recipient drop constraint if exists message_recipient_group_id_fkey;
+alter table message_recipient add constraint message_recipient_group_id_fkey foreign key (group_id) references public.group(id) on delete cascade;
+alter table message drop constraint if exists message_group_id_fkey;
+alter table message add constraint message_group_id_fkey foreign key (group_id) references public.group(id) on delete cascade;
+delete from public.group where deleted_at is not null;
+alter table public.group drop column if exists deleted_at;
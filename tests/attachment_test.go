@@ -0,0 +1,218 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aorticweb/msg-app/app/config"
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/model"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var pngContent = append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 64)...)
+
+// postMultipart ... post body, as built by write, to route
+func postMultipart(t *testing.T, route string, token string, write func(*multipart.Writer)) *http.Response {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	write(writer)
+	require.NoError(t, writer.Close())
+	req, err := http.NewRequest("POST", route, &body)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func writeFile(t *testing.T, writer *multipart.Writer, filename string, content []byte) {
+	part, err := writer.CreateFormFile("file", filename)
+	require.NoError(t, err)
+	_, err = part.Write(content)
+	require.NoError(t, err)
+}
+
+func uploadAttachment(t *testing.T, srvURL string, token string, msg *crud.Message, filename string, content []byte, checksum string) *http.Response {
+	return postMultipart(t, url(srvURL, fmt.Sprintf("/messages/%d/attachments", msg.ID)), token, func(writer *multipart.Writer) {
+		if checksum != "" {
+			require.NoError(t, writer.WriteField("sha256", checksum))
+		}
+		writeFile(t, writer, filename, content)
+	})
+}
+
+// postMessageWithFiles ... compose msg with an attachment for each of filenames, all holding content
+func postMessageWithFiles(t *testing.T, srvURL string, token string, msg model.ComposedMessage, content []byte, filenames ...string) *http.Response {
+	return postMultipart(t, url(srvURL, "/messages"), token, func(writer *multipart.Writer) {
+		part, err := writer.CreateFormField("message")
+		require.NoError(t, err)
+		require.NoError(t, json.NewEncoder(part).Encode(msg))
+		for _, filename := range filenames {
+			writeFile(t, writer, filename, content)
+		}
+	})
+}
+
+// createScheduledMessage ... message from sender to recipient delivered in an hour
+func createScheduledMessage(t *testing.T, db *gorm.DB, sender *crud.User, recipient *crud.User) *crud.Message {
+	sendAt := time.Now().UTC().Add(time.Hour)
+	msg := crud.Message{Sender: sender, Recipient: recipient, Subject: "Later", Body: "Not yet", SentAt: sendAt, SendAt: &sendAt}
+	_, err := crud.CreateMessage(db, &msg)
+	require.NoError(t, err)
+	return &msg
+}
+
+func TestAttachmentUploadDownload(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+
+	resp := postMessageWithFiles(t, srv.URL, authToken(t, db, &users[0]), messageUserSuccess(t, &users[0], &users[1]), pngContent, "../../photo.png")
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var msg model.Message
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&msg))
+	require.Len(t, msg.Attachments, 1)
+	attachment := msg.Attachments[0]
+	sum := sha256.Sum256(pngContent)
+	require.Equal(t, "photo.png", attachment.Filename)
+	require.Equal(t, "image/png", attachment.ContentType)
+	require.Equal(t, int64(len(pngContent)), attachment.Size)
+	require.Equal(t, hex.EncodeToString(sum[:]), attachment.SHA256)
+
+	recipientToken := authToken(t, db, &users[1])
+	data := getMessage(t, srv.URL, recipientToken, msg.ID)
+	require.Len(t, data.Attachments, 1)
+	require.Equal(t, attachment.ID, data.Attachments[0].ID)
+
+	route := url(srv.URL, fmt.Sprintf("/messages/%d/attachments/%d", msg.ID, attachment.ID))
+	resp, err := authRequest(t, "GET", route, recipientToken, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+	require.Equal(t, `attachment; filename=photo.png`, resp.Header.Get("Content-Disposition"))
+	downloaded, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, pngContent, downloaded)
+
+	resp, err = authRequest(t, "GET", route, authToken(t, db, &users[2]), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestAttachmentComposeLimits(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[0])
+	msg := messageUserSuccess(t, &users[0], &users[1])
+
+	filenames := []string{}
+	for i := 0; i <= model.MaxMessageAttachments; i++ {
+		filenames = append(filenames, fmt.Sprintf("photo%d.png", i))
+	}
+	resp := postMessageWithFiles(t, srv.URL, token, msg, pngContent, filenames...)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = postMessageWithFiles(t, srv.URL, token, msg, []byte("<html><body>hi</body></html>"), "page.html")
+	require.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+	resp = postMultipart(t, url(srv.URL, "/messages"), token, func(writer *multipart.Writer) {
+		writeFile(t, writer, "photo.png", pngContent)
+	})
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// nothing is sent when the attachments are rejected
+	var count int64
+	require.NoError(t, db.Model(&crud.Message{}).Where("sender_id = ?", users[0].ID).Count(&count).Error)
+	require.Zero(t, count)
+}
+
+func TestAttachmentUploadForbidden(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	msg := createScheduledMessage(t, db, &users[0], &users[1])
+	sum := sha256.Sum256(pngContent)
+	checksum := hex.EncodeToString(sum[:])
+
+	// the recipient does not see the message before it is delivered
+	resp := uploadAttachment(t, srv.URL, authToken(t, db, &users[1]), msg, "photo.png", pngContent, "")
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp = uploadAttachment(t, srv.URL, authToken(t, db, &users[2]), msg, "photo.png", pngContent, "")
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp = uploadAttachment(t, srv.URL, authToken(t, db, &users[0]), msg, "photo.png", pngContent, checksum)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var attachment model.Attachment
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&attachment))
+	require.Equal(t, checksum, attachment.SHA256)
+
+	// readers of a sent message were told about it, it gets no more attachments
+	sent := createDirectMessage(t, db, &users[0], &users[1], nil)
+	resp = uploadAttachment(t, srv.URL, authToken(t, db, &users[0]), sent, "photo.png", pngContent, "")
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp = uploadAttachment(t, srv.URL, authToken(t, db, &users[1]), sent, "photo.png", pngContent, "")
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestAttachmentUploadLimits(t *testing.T) {
+	db := testDB(t)
+	cfg := config.Default()
+	cfg.AttachmentMaxSize = 32
+	srv := testServerWithConfig(t, db, cfg)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	msg := createScheduledMessage(t, db, &users[0], &users[1])
+	token := authToken(t, db, &users[0])
+
+	resp := uploadAttachment(t, srv.URL, token, msg, "photo.png", pngContent, "")
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	resp = uploadAttachment(t, srv.URL, token, msg, "page.html", []byte("<html><body>hi</body></html>"), "")
+	require.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+	resp = uploadAttachment(t, srv.URL, token, msg, "notes.txt", []byte("plain notes"), "0000")
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = uploadAttachment(t, srv.URL, token, msg, "notes.txt", []byte("plain notes"), "")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+}
+
+func TestAttachmentUploadMalformed(t *testing.T) {
+	db := testDB(t)
+	cfg := config.Default()
+	cfg.AttachmentMaxSize = 32
+	srv := testServerWithConfig(t, db, cfg)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	msg := createScheduledMessage(t, db, &users[0], &users[1])
+	token := authToken(t, db, &users[0])
+
+	// a second file does not silently replace the first one
+	route := url(srv.URL, fmt.Sprintf("/messages/%d/attachments", msg.ID))
+	resp := postMultipart(t, route, token, func(writer *multipart.Writer) {
+		for _, name := range []string{"first.txt", "second.txt"} {
+			writeFile(t, writer, name, []byte("plain notes"))
+		}
+	})
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// parts other than the file count towards the size of the request
+	resp = postMultipart(t, route, token, func(writer *multipart.Writer) {
+		require.NoError(t, writer.WriteField("padding", string(bytes.Repeat([]byte("a"), 65<<10))))
+		writeFile(t, writer, "notes.txt", []byte("plain notes"))
+	})
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	var attachments []crud.Attachment
+	require.NoError(t, db.Where("message_id = ?", msg.ID).Find(&attachments).Error)
+	require.Empty(t, attachments)
+}
@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aorticweb/msg-app/app/model"
+	"github.com/stretchr/testify/require"
+)
+
+func credentialsPayload(t *testing.T, password string) io.Reader {
+	return toPayload(t, model.Credentials{Username: user.Username, Password: password})
+}
+
+func registerUser(t *testing.T, srvURL string) {
+	resp, err := http.Post(url(srvURL, "/users"), "application/json", userSuccessPayload(t))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+}
+
+func TestLoginSuccess(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	registerUser(t, srv.URL)
+
+	resp, err := http.Post(url(srv.URL, "/auth/login"), "application/json", credentialsPayload(t, password))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	checkContentType(t, resp)
+	var data model.AuthToken
+	err = json.NewDecoder(resp.Body).Decode(&data)
+
+	require.NoError(t, err)
+	require.NotEmpty(t, data.Token)
+	require.True(t, data.ExpiresAt.After(time.Now()))
+}
+
+func TestLoginWrongPassword(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	registerUser(t, srv.URL)
+
+	resp, err := http.Post(url(srv.URL, "/auth/login"), "application/json", credentialsPayload(t, "not the password"))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestLoginUserWithoutCredentials(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	createUsers(t, db)
+
+	payload := toPayload(t, model.Credentials{Username: usernames[0], Password: ""})
+	resp, err := http.Post(url(srv.URL, "/auth/login"), "application/json", payload)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestAnonymousRequestRejected(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+
+	msg := messageUserSuccess(t, &users[0], &users[1])
+	resp, err := http.Post(url(srv.URL, "/messages"), "application/json", toPayload(t, msg))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	require.Equal(t, "Bearer", resp.Header.Get("WWW-Authenticate"))
+}
+
+func TestInvalidTokenRejected(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+
+	msg := messageUserSuccess(t, &users[0], &users[1])
+	resp, err := authRequest(t, "POST", url(srv.URL, "/messages"), "not-a-token", toPayload(t, msg))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestOtherAuthorizationSchemeIsAnonymous(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	registerUser(t, srv.URL)
+	users := createUsers(t, db)
+
+	// a proxy authenticating with basic auth does not get in the way of the api
+	req, err := http.NewRequest("POST", url(srv.URL, "/auth/login"), credentialsPayload(t, password))
+	require.NoError(t, err)
+	req.SetBasicAuth("proxy", "secret")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	msg := messageUserSuccess(t, &users[0], &users[1])
+	req, err = http.NewRequest("POST", url(srv.URL, "/messages"), toPayload(t, msg))
+	require.NoError(t, err)
+	req.SetBasicAuth("proxy", "secret")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestLogoutRevokesToken(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[0])
+
+	resp, err := authRequest(t, "POST", url(srv.URL, "/auth/logout"), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, err = authRequest(t, "POST", url(srv.URL, "/auth/logout"), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
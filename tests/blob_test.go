@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aorticweb/msg-app/app/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 ... local stand-in for an S3 compatible service, keeps objects in memory
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=test-access/") || !strings.Contains(auth, "Signature=") || r.Header.Get("X-Amz-Date") == "" {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.objects[r.URL.Path] = body
+	case http.MethodGet:
+		body, exist := f.objects[r.URL.Path]
+		if !exist {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Write(body)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func checkBlobStore(t *testing.T, store storage.BlobStore) {
+	ctx := context.Background()
+	content := []byte("attached content")
+	err := store.Put(ctx, "attachments/1/blob", bytes.NewReader(content), int64(len(content)), "text/plain")
+	require.NoError(t, err)
+
+	blob, err := store.Get(ctx, "attachments/1/blob")
+	require.NoError(t, err)
+	stored, err := io.ReadAll(blob)
+	require.NoError(t, err)
+	require.NoError(t, blob.Close())
+	require.Equal(t, content, stored)
+
+	require.NoError(t, store.Delete(ctx, "attachments/1/blob"))
+	_, err = store.Get(ctx, "attachments/1/blob")
+	require.ErrorIs(t, err, storage.ErrBlobNotFound)
+	require.NoError(t, store.Delete(ctx, "attachments/1/blob"))
+}
+
+func TestLocalBlobStore(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	checkBlobStore(t, store)
+}
+
+func TestS3BlobStore(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	store, err := storage.NewS3Store(storage.S3Config{
+		Endpoint:  srv.URL,
+		Bucket:    "msg-app",
+		AccessKey: "test-access",
+		SecretKey: "test-secret",
+	}, srv.Client())
+	require.NoError(t, err)
+	checkBlobStore(t, store)
+	require.Empty(t, fake.objects)
+}
+
+func TestS3BlobStoreAccessDenied(t *testing.T) {
+	srv := httptest.NewServer(&fakeS3{objects: map[string][]byte{}})
+	defer srv.Close()
+	store, err := storage.NewS3Store(storage.S3Config{Endpoint: srv.URL, Bucket: "msg-app", AccessKey: "other"}, srv.Client())
+	require.NoError(t, err)
+	err = store.Put(context.Background(), "key", strings.NewReader("x"), 1, "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "AccessDenied")
+}
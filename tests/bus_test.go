@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/events"
+	"github.com/stretchr/testify/require"
+)
+
+func nextEvent(t *testing.T, subscription *events.Subscription) events.Event {
+	select {
+	case event, ok := <-subscription.Events():
+		require.True(t, ok, "subscription ended: %v", subscription.Err())
+		return event
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no event received")
+	}
+	return events.Event{}
+}
+
+func TestMemoryBus(t *testing.T) {
+	bus := events.NewMemoryBus()
+	subscription := bus.Subscribe(1, 4)
+
+	event := events.Event{ID: 3, UserID: 1, Kind: events.KindRead, MessageID: 10}
+	require.NoError(t, bus.Publish(context.Background(), event))
+	require.Equal(t, event, nextEvent(t, subscription))
+
+	require.NoError(t, bus.Close())
+	_, ok := <-subscription.Events()
+	require.False(t, ok)
+	require.ErrorIs(t, subscription.Err(), events.ErrHubClosed)
+}
+
+// TestPostgresBus ... notifications are only delivered on commit, the test runs outside of the test transaction
+func TestPostgresBus(t *testing.T) {
+	db, err := crud.WaitForDB(time.Second)
+	require.NoError(t, err)
+	logger := log.New(os.Stdout, "msg-app: ", log.LstdFlags)
+	ctx := context.Background()
+
+	// one bus per replica, each hears what the other publishes
+	first, err := events.NewPostgresBus(ctx, db, logger)
+	require.NoError(t, err)
+	defer first.Close()
+	second, err := events.NewPostgresBus(ctx, db, logger)
+	require.NoError(t, err)
+	defer second.Close()
+	userID := time.Now().UnixNano()
+	subscription := second.Subscribe(userID, 64)
+	own := first.Subscribe(userID, 64)
+
+	published := make([]events.Event, 0, 60)
+	for i := int64(1); i <= 60; i++ {
+		published = append(published, events.Event{ID: i, UserID: userID, Kind: events.KindMessage, MessageID: i})
+	}
+	require.NoError(t, first.Publish(ctx, published...))
+	for _, event := range published {
+		require.Equal(t, event, nextEvent(t, subscription))
+		require.Equal(t, event, nextEvent(t, own))
+	}
+
+	// events of other users are not received
+	require.NoError(t, first.Publish(ctx, events.Event{UserID: userID + 1, Kind: events.KindRead}))
+	require.NoError(t, first.Publish(ctx, events.Event{UserID: userID, Kind: events.KindUnread}))
+	require.Equal(t, events.KindUnread, nextEvent(t, subscription).Kind)
+
+	require.NoError(t, second.Close())
+	_, ok := <-subscription.Events()
+	require.False(t, ok)
+	require.ErrorIs(t, subscription.Err(), events.ErrHubClosed)
+}
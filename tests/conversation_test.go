@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/model"
+	"github.com/stretchr/testify/require"
+)
+
+func getConversations(t *testing.T, srvURL string, token string, user *crud.User, query string) *model.ConversationPage {
+	route := url(srvURL, fmt.Sprintf("/users/%s/mailbox?view=conversations%s", user.Username, query))
+	resp, err := authRequest(t, "GET", route, token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var data model.ConversationPage
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	require.NoError(t, err)
+	return &data
+}
+
+func TestMailboxConversations(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	other := createDirectMessage(t, db, &users[2], &users[0], nil)
+	root := createDirectMessage(t, db, &users[1], &users[0], nil)
+	reply := createDirectMessage(t, db, &users[0], &users[1], &root.ID)
+	latest := createDirectMessage(t, db, &users[1], &users[0], &reply.ID)
+
+	data := getConversations(t, srv.URL, authToken(t, db, &users[0]), &users[0], "")
+	require.Len(t, data.Conversations, 2)
+
+	require.Equal(t, root.ID, data.Conversations[0].Thread)
+	require.Equal(t, latest.ID, data.Conversations[0].Latest.ID)
+	require.Equal(t, int64(3), data.Conversations[0].MessageCount)
+	require.Equal(t, int64(2), data.Conversations[0].UnreadCount)
+	require.ElementsMatch(t, []string{users[0].Username, users[1].Username}, data.Conversations[0].Participants)
+
+	require.Equal(t, other.ID, data.Conversations[1].Thread)
+	require.Equal(t, int64(1), data.Conversations[1].MessageCount)
+}
+
+func TestMailboxConversationsUnreadCount(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	root := createDirectMessage(t, db, &users[1], &users[0], nil)
+	createDirectMessage(t, db, &users[1], &users[0], &root.ID)
+	require.NoError(t, crud.MarkMessagesRead(db, users[0].ID, []int64{root.ID}))
+
+	data := getConversations(t, srv.URL, authToken(t, db, &users[0]), &users[0], "")
+	require.Len(t, data.Conversations, 1)
+	require.Equal(t, int64(2), data.Conversations[0].MessageCount)
+	require.Equal(t, int64(1), data.Conversations[0].UnreadCount)
+}
+
+func TestMailboxConversationsHidesPrivateReplies(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	root := createGroupMessage(t, db, &users[0], group, nil)
+	createDirectMessage(t, db, &users[1], &users[0], &root.ID)
+
+	data := getConversations(t, srv.URL, authToken(t, db, &users[2]), &users[2], "")
+	require.Len(t, data.Conversations, 1)
+	require.Equal(t, root.ID, data.Conversations[0].Latest.ID)
+	require.Equal(t, int64(1), data.Conversations[0].MessageCount)
+	// the members of the group the message was sent to take part in the conversation
+	require.Equal(t, usernames, data.Conversations[0].Participants)
+}
+
+func TestMailboxConversationsPagination(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	msgs := createMailbox(t, db, &users[1], &users[0], nil, 3)
+	// a reply on the oldest conversation moves it to the top
+	reply := createDirectMessage(t, db, &users[1], &users[0], &msgs[0].ID)
+
+	token := authToken(t, db, &users[0])
+	data := getConversations(t, srv.URL, token, &users[0], "&limit=2")
+	require.Len(t, data.Conversations, 2)
+	require.Equal(t, reply.ID, data.Conversations[0].Latest.ID)
+	require.Equal(t, msgs[2].ID, data.Conversations[1].Thread)
+	require.NotEmpty(t, data.NextCursor)
+
+	data = getConversations(t, srv.URL, token, &users[0], "&limit=2&cursor="+data.NextCursor)
+	require.Len(t, data.Conversations, 1)
+	require.Equal(t, msgs[1].ID, data.Conversations[0].Thread)
+	require.Empty(t, data.NextCursor)
+}
+
+func TestMailboxInvalidView(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+
+	route := url(srv.URL, fmt.Sprintf("/users/%s/mailbox?view=threads", users[0].Username))
+	resp, err := authRequest(t, "GET", route, authToken(t, db, &users[0]), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,183 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/model"
+	"github.com/stretchr/testify/require"
+)
+
+func createDraft(t *testing.T, srvURL string, token string, draft model.DraftPost) *model.Draft {
+	resp, err := authRequest(t, "POST", url(srvURL, "/drafts"), token, toPayload(t, draft))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var data model.Draft
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	require.NoError(t, err)
+	return &data
+}
+
+func sendDraft(t *testing.T, srvURL string, token string, id int64) *http.Response {
+	resp, err := authRequest(t, "POST", url(srvURL, fmt.Sprintf("/drafts/%d/send", id)), token, nil)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestDraftLifecycle(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[0])
+
+	// recipients and body can be missing while composing
+	draft := createDraft(t, srv.URL, token, model.DraftPost{Subject: "Plans"})
+	require.Equal(t, "Plans", draft.Subject)
+	require.Empty(t, draft.To)
+
+	body := "Meet at the library"
+	to := []map[string]string{username(&users[1])}
+	route := url(srv.URL, fmt.Sprintf("/drafts/%d", draft.ID))
+	resp, err := authRequest(t, "PATCH", route, token, toPayload(t, model.DraftPatch{Body: &body, To: &to}))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var updated model.Draft
+	err = json.NewDecoder(resp.Body).Decode(&updated)
+	require.NoError(t, err)
+	require.Equal(t, "Plans", updated.Subject)
+	require.Equal(t, body, updated.Body)
+	require.Equal(t, to, updated.To)
+
+	resp, err = authRequest(t, "GET", url(srv.URL, "/drafts"), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var drafts model.Drafts
+	err = json.NewDecoder(resp.Body).Decode(&drafts)
+	require.NoError(t, err)
+	require.Len(t, drafts.Drafts, 1)
+	require.Equal(t, draft.ID, drafts.Drafts[0].ID)
+
+	// drafts are private to their owner
+	resp, err = authRequest(t, "GET", route, authToken(t, db, &users[1]), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = authRequest(t, "DELETE", route, token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, err = authRequest(t, "GET", route, token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func getDrafts(t *testing.T, srvURL string, token string, query string) model.Drafts {
+	resp, err := authRequest(t, "GET", url(srvURL, "/drafts?"+query), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var drafts model.Drafts
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&drafts))
+	return drafts
+}
+
+func TestDraftsPaging(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[0])
+	var ids []int64
+	for _, subject := range []string{"First", "Second", "Third"} {
+		ids = append(ids, createDraft(t, srv.URL, token, model.DraftPost{Subject: subject}).ID)
+	}
+
+	page := getDrafts(t, srv.URL, token, "limit=2")
+	require.Len(t, page.Drafts, 2)
+	require.Equal(t, ids[2], page.Drafts[0].ID)
+	require.Equal(t, ids[1], page.Drafts[1].ID)
+	require.NotEmpty(t, page.NextCursor)
+
+	page = getDrafts(t, srv.URL, token, "limit=2&cursor="+page.NextCursor)
+	require.Len(t, page.Drafts, 1)
+	require.Equal(t, ids[0], page.Drafts[0].ID)
+	require.Empty(t, page.NextCursor)
+
+	resp, err := authRequest(t, "GET", url(srv.URL, "/drafts?cursor=nope"), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestDraftSend(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[0])
+	draft := createDraft(t, srv.URL, token, model.DraftPost{
+		Subject: "Plans",
+		Body:    "Meet at the library",
+		To:      []map[string]string{username(&users[1])},
+		Bcc:     []map[string]string{username(&users[2])},
+	})
+
+	resp := sendDraft(t, srv.URL, token, draft.ID)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var data model.Message
+	err := json.NewDecoder(resp.Body).Decode(&data)
+	require.NoError(t, err)
+	require.Equal(t, draft.Subject, data.Subject)
+	require.Equal(t, draft.To, data.To)
+	require.Equal(t, draft.Bcc, data.Bcc)
+	require.Equal(t, []int64{data.ID}, getMailboxIDs(t, srv.URL, authToken(t, db, &users[1]), &users[1], ""))
+
+	// the draft is gone once sent
+	_, exist, err := crud.GetDraft(db, users[0].ID, draft.ID)
+	require.NoError(t, err)
+	require.False(t, exist)
+	resp = sendDraft(t, srv.URL, token, draft.ID)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestDraftSendIncomplete(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[0])
+
+	draft := createDraft(t, srv.URL, token, model.DraftPost{Subject: "Plans", Body: "Meet at the library"})
+	resp := sendDraft(t, srv.URL, token, draft.ID)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	draft = createDraft(t, srv.URL, token, model.DraftPost{Subject: "Plans", To: []map[string]string{username(&users[1])}})
+	resp = sendDraft(t, srv.URL, token, draft.ID)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	draft = createDraft(t, srv.URL, token, model.DraftPost{Subject: "Plans", Body: "Meet at the library", To: []map[string]string{{"username": "Voldemort"}}})
+	resp = sendDraft(t, srv.URL, token, draft.ID)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// a draft that failed to send is kept
+	_, exist, err := crud.GetDraft(db, users[0].ID, draft.ID)
+	require.NoError(t, err)
+	require.True(t, exist)
+	require.Empty(t, getMailboxIDs(t, srv.URL, authToken(t, db, &users[1]), &users[1], ""))
+}
+
+func TestDraftSendChanged(t *testing.T) {
+	db := testDB(t)
+	defer clean(t, db, nil)
+	users := createUsers(t, db)
+	draft := crud.Draft{OwnerID: users[0].ID, Subject: "Plans", Body: "Meet at the library"}
+	require.NoError(t, crud.CreateDraft(db, &draft))
+	stale, _, err := crud.GetDraft(db, users[0].ID, draft.ID)
+	require.NoError(t, err)
+	require.NoError(t, crud.DeleteDraft(db, &draft))
+
+	msg := crud.Message{Sender: &users[0], Recipient: &users[1], Subject: stale.Subject, Body: stale.Body, SentAt: stale.UpdatedAt}
+	_, err = crud.SendDraft(db, stale, &msg)
+	require.ErrorIs(t, err, crud.ErrDraftChanged)
+}
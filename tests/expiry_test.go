@@ -0,0 +1,157 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/jobs"
+	"github.com/aorticweb/msg-app/app/model"
+	"github.com/aorticweb/msg-app/app/storage"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func expireMessage(t *testing.T, db *gorm.DB, msg *crud.Message) {
+	err := db.Model(&crud.Message{}).Where("id = ?", msg.ID).Update("expires_at", time.Now().UTC().Add(-time.Second)).Error
+	require.NoError(t, err)
+}
+
+func TestMessageTTL(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+
+	msg := messageUserSuccess(t, &users[0], &users[1])
+	ttl := int64(60)
+	msg.TTL = &ttl
+	resp := postMessage(t, srv.URL, authToken(t, db, &users[0]), msg)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var data model.Message
+	err := json.NewDecoder(resp.Body).Decode(&data)
+	require.NoError(t, err)
+	require.NotNil(t, data.ExpiresAt)
+	require.WithinDuration(t, data.SentAt.Add(time.Minute), *data.ExpiresAt, time.Millisecond)
+
+	ttl = 0
+	resp = postMessage(t, srv.URL, authToken(t, db, &users[0]), msg)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestExpiredMessagesHidden(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	base := createDirectMessage(t, db, &users[0], &users[1], nil)
+	kept := createDirectMessage(t, db, &users[1], &users[0], &base.ID)
+	expired := createDirectMessage(t, db, &users[1], &users[0], &base.ID)
+	expireMessage(t, db, expired)
+
+	// expired messages are gone before the sweeper runs
+	_, exist, err := crud.GetMessage(db, expired.ID)
+	require.NoError(t, err)
+	require.False(t, exist)
+	token := authToken(t, db, &users[0])
+	resp, err := authRequest(t, "GET", url(srv.URL, fmt.Sprintf("/messages/%d", expired.ID)), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.Equal(t, []int64{kept.ID}, getMailboxIDs(t, srv.URL, token, &users[0], ""))
+
+	replies, _, err := crud.GetMessageReplies(db, base.ID, users[0].ID, crud.Page{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, replies, 1)
+	require.Equal(t, kept.ID, replies[0].ID)
+	mailbox, _, err := crud.GetUserMailbox(db, users[0].ID, crud.MailboxFilter{}, crud.Page{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, mailbox, 1)
+}
+
+func TestGroupDefaultTTL(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	token := authToken(t, db, &users[0])
+
+	ttl := int64(3600)
+	route := url(srv.URL, "/groups/"+group.Groupname)
+	resp, err := authRequest(t, "PATCH", route, token, toPayload(t, model.GroupPatch{DefaultTTL: &ttl}))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var groupData model.Group
+	err = json.NewDecoder(resp.Body).Decode(&groupData)
+	require.NoError(t, err)
+	require.Equal(t, group.Groupname, groupData.Groupname)
+	require.Equal(t, ttl, *groupData.DefaultTTL)
+
+	resp = postMessage(t, srv.URL, token, messageGroupSuccess(t, &users[0], group))
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var data model.Message
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	require.NoError(t, err)
+	require.WithinDuration(t, data.SentAt.Add(time.Hour), *data.ExpiresAt, time.Millisecond)
+
+	// an explicit ttl wins over the group default
+	msg := messageGroupSuccess(t, &users[0], group)
+	own := int64(60)
+	msg.TTL = &own
+	resp = postMessage(t, srv.URL, token, msg)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	require.NoError(t, err)
+	require.WithinDuration(t, data.SentAt.Add(time.Minute), *data.ExpiresAt, time.Millisecond)
+
+	ttl = 0
+	resp, err = authRequest(t, "PATCH", route, token, toPayload(t, model.GroupPatch{DefaultTTL: &ttl}))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = postMessage(t, srv.URL, token, messageGroupSuccess(t, &users[0], group))
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	data = model.Message{}
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	require.NoError(t, err)
+	require.Nil(t, data.ExpiresAt)
+}
+
+func TestExpirySweep(t *testing.T) {
+	db := testDB(t)
+	defer clean(t, db, nil)
+	users := createUsers(t, db)
+	blobs, err := storage.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	msg := createDirectMessage(t, db, &users[0], &users[1], nil)
+	reply := createDirectMessage(t, db, &users[1], &users[0], &msg.ID)
+	key, err := crud.NewAttachmentKey(msg.ID)
+	require.NoError(t, err)
+	require.NoError(t, blobs.Put(ctx, key, bytes.NewReader(pngContent), int64(len(pngContent)), "image/png"))
+	attachment := crud.Attachment{MessageID: msg.ID, Filename: "photo.png", ContentType: "image/png", Size: int64(len(pngContent)), StorageKey: key, CreatedAt: msg.SentAt}
+	require.NoError(t, crud.CreateAttachment(db, &attachment))
+	require.NoError(t, crud.MarkMessagesRead(db, users[1].ID, []int64{msg.ID}))
+	expireMessage(t, db, msg)
+
+	require.NoError(t, jobs.ExpirySweep(db, blobs)(ctx))
+
+	var count int64
+	require.NoError(t, db.Model(&crud.Message{}).Where("id = ?", msg.ID).Count(&count).Error)
+	require.Zero(t, count)
+	require.NoError(t, db.Model(&crud.MessageState{}).Where("message_id = ?", msg.ID).Count(&count).Error)
+	require.Zero(t, count)
+	_, err = blobs.Get(ctx, key)
+	require.ErrorIs(t, err, storage.ErrBlobNotFound)
+
+	// the reply stays, detached from the expired message
+	dbReply, exist, err := crud.GetMessage(db, reply.ID)
+	require.NoError(t, err)
+	require.True(t, exist)
+	require.Nil(t, dbReply.REID)
+}
@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"testing"
+	"time"
+
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/model"
+	"github.com/stretchr/testify/require"
+)
+
+func getMailboxIDs(t *testing.T, srvURL string, token string, user *crud.User, query string) []int64 {
+	resp, err := authRequest(t, "GET", url(srvURL, fmt.Sprintf("/users/%s/mailbox?%s", user.Username, query)), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var data model.MessagePage
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	require.NoError(t, err)
+	ids := []int64{}
+	for _, msg := range data.Messages {
+		ids = append(ids, msg.ID)
+	}
+	return ids
+}
+
+func TestMailboxFilters(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	now := time.Now().UTC()
+
+	msgs := []crud.Message{
+		{Sender: &users[1], Recipient: &users[0], Subject: "Quidditch practice", Body: "Tonight", SentAt: now.Add(-3 * time.Hour)},
+		{Sender: &users[2], Group: group, Subject: "Potions homework", Body: "Due tomorrow", SentAt: now.Add(-2 * time.Hour)},
+		{Sender: &users[1], Group: group, Subject: "quidditch match", Body: "Saturday", SentAt: now.Add(-1 * time.Hour)},
+	}
+	err := db.Create(&msgs).Error
+	require.NoError(t, err)
+	reply := crud.Message{Sender: &users[2], Group: group, REID: &msgs[2].ID, Subject: "Re: quidditch match", Body: "Count me in", SentAt: now}
+	err = db.Create(&reply).Error
+	require.NoError(t, err)
+	err = crud.MarkMessagesRead(db, users[0].ID, []int64{msgs[1].ID})
+	require.NoError(t, err)
+
+	m1, m2, m3, m4 := msgs[0].ID, msgs[1].ID, msgs[2].ID, reply.ID
+	token := authToken(t, db, &users[0])
+	cases := []struct {
+		query    string
+		expected []int64
+	}{
+		{"", []int64{m4, m3, m2, m1}},
+		{"sort=asc", []int64{m1, m2, m3, m4}},
+		{"sender=" + users[1].Username, []int64{m3, m1}},
+		{"kind=direct", []int64{m1}},
+		{"kind=group", []int64{m4, m3, m2}},
+		{"since=" + neturl.QueryEscape(now.Add(-150*time.Minute).Format(time.RFC3339)), []int64{m4, m3, m2}},
+		{"until=" + neturl.QueryEscape(now.Add(-90*time.Minute).Format(time.RFC3339)), []int64{m2, m1}},
+		{"unread=true", []int64{m4, m3, m1}},
+		{"has_replies=true", []int64{m3}},
+		{"has_replies=false", []int64{m4, m2, m1}},
+		{"subject=QUIDDITCH", []int64{m4, m3, m1}},
+		{"subject=100%25", []int64{}},
+		{"kind=group&unread=true&sender=" + users[2].Username, []int64{m4}},
+	}
+	for _, tc := range cases {
+		require.Equal(t, tc.expected, getMailboxIDs(t, srv.URL, token, &users[0], tc.query), tc.query)
+	}
+}
+
+func TestMailboxFiltersInvalid(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[0])
+
+	for _, query := range []string{"kind=broadcast", "since=yesterday", "unread=maybe", "has_replies=2", "sort=random"} {
+		resp, err := authRequest(t, "GET", url(srv.URL, fmt.Sprintf("/users/%s/mailbox?%s", users[0].Username, query)), token, nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+	}
+}
@@ -12,8 +12,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aorticweb/msg-app/app/config"
 	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/events"
 	api "github.com/aorticweb/msg-app/app/handlers"
+	"github.com/aorticweb/msg-app/app/storage"
 
 	"github.com/stretchr/testify/require"
 	"gorm.io/gorm"
@@ -34,8 +37,14 @@ func testDB(t *testing.T) *gorm.DB {
 
 // testServer ... fixture for test server ... do not forget to close server
 func testServer(t *testing.T, db *gorm.DB) *httptest.Server {
+	return testServerWithConfig(t, db, config.Default())
+}
+
+func testServerWithConfig(t *testing.T, db *gorm.DB, cfg config.Config) *httptest.Server {
 	logger := log.New(os.Stdout, "msg-app: ", log.LstdFlags|log.Llongfile)
-	srv := httptest.NewServer(api.NewAPI(db, logger))
+	blobs, err := storage.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	srv := httptest.NewServer(api.NewAPI(db, logger, cfg, blobs, events.NewMemoryBus()))
 	return srv
 }
 
@@ -58,3 +67,23 @@ func toPayload(t *testing.T, data interface{}) io.Reader {
 	require.NoError(t, err)
 	return b
 }
+
+// authToken ... fixture issuing a bearer token for user
+func authToken(t *testing.T, db *gorm.DB, user *crud.User) string {
+	token, _, err := crud.CreateAuthToken(db, user.ID, time.Hour)
+	require.NoError(t, err)
+	return token
+}
+
+// authRequest ... send request with token as bearer, anonymous when token is empty
+func authRequest(t *testing.T, method string, url string, token string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
+	require.NoError(t, err)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+	return http.DefaultClient.Do(req)
+}
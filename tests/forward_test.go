@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/model"
+	"github.com/stretchr/testify/require"
+)
+
+func forwardMessage(t *testing.T, srvURL string, token string, id int64, forward model.ForwardPost) *http.Response {
+	resp, err := authRequest(t, "POST", url(srvURL, fmt.Sprintf("/messages/%d/forward", id)), token, toPayload(t, forward))
+	require.NoError(t, err)
+	return resp
+}
+
+func TestForwardMessage(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	outsider := createOutsider(t, db)
+	resp := postMessageWithFiles(t, srv.URL, authToken(t, db, &users[0]), messageUserSuccess(t, &users[0], &users[1]), pngContent, "photo.png")
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var msg model.Message
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&msg))
+
+	token := authToken(t, db, &users[1])
+	resp = forwardMessage(t, srv.URL, token, msg.ID, model.ForwardPost{
+		Body: "Have a look",
+		To:   []map[string]string{username(outsider)},
+	})
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var data model.Message
+	err := json.NewDecoder(resp.Body).Decode(&data)
+	require.NoError(t, err)
+	require.Equal(t, "Fwd: "+msg.Subject, data.Subject)
+	require.Contains(t, data.Body, "Have a look")
+	require.Contains(t, data.Body, "From: "+users[0].Username)
+	require.Contains(t, data.Body, msg.Body)
+	require.Equal(t, users[1].Username, data.Sender)
+	require.Equal(t, []map[string]string{username(outsider)}, data.To)
+	require.Equal(t, msg.ID, *data.ForwardedFrom)
+	require.Nil(t, data.RE)
+
+	// the attachment is copied, the recipient of the forward can download it
+	outsiderToken := authToken(t, db, outsider)
+	seen := getMessage(t, srv.URL, outsiderToken, data.ID)
+	require.Len(t, seen.Attachments, 1)
+	route := url(srv.URL, fmt.Sprintf("/messages/%d/attachments/%d", data.ID, seen.Attachments[0].ID))
+	resp, err = authRequest(t, "GET", route, outsiderToken, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	downloaded, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, pngContent, downloaded)
+
+	// forwarding a forward keeps a single prefix and links to the forward
+	resp = forwardMessage(t, srv.URL, outsiderToken, data.ID, model.ForwardPost{To: []map[string]string{username(&users[2])}})
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var again model.Message
+	err = json.NewDecoder(resp.Body).Decode(&again)
+	require.NoError(t, err)
+	require.Equal(t, "Fwd: "+msg.Subject, again.Subject)
+	require.Equal(t, data.ID, *again.ForwardedFrom)
+}
+
+func TestForwardMessageNotReadable(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	msg := createDirectMessage(t, db, &users[0], &users[1], nil)
+
+	resp := forwardMessage(t, srv.URL, authToken(t, db, &users[2]), msg.ID, model.ForwardPost{To: []map[string]string{username(&users[2])}})
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestForwardMessageInvalid(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	msg := createDirectMessage(t, db, &users[0], &users[1], nil)
+	token := authToken(t, db, &users[1])
+
+	resp := forwardMessage(t, srv.URL, token, msg.ID, model.ForwardPost{})
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	now := msg.SentAt
+	err := db.Model(&crud.Message{}).Where("id = ?", msg.ID).Update("deleted_at", now).Error
+	require.NoError(t, err)
+	resp = forwardMessage(t, srv.URL, token, msg.ID, model.ForwardPost{To: []map[string]string{username(&users[2])}})
+	require.Equal(t, http.StatusGone, resp.StatusCode)
+}
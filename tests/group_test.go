@@ -47,8 +47,9 @@ func TestGroupPostSuccess(t *testing.T) {
 	srv := testServer(t, db)
 	defer clean(t, db, srv)
 
-	createUsers(t, db)
-	resp, err := http.Post(url(srv.URL, "/groups"), "application/json", groupSuccessPayload(t))
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[0])
+	resp, err := authRequest(t, "POST", url(srv.URL, "/groups"), token, groupSuccessPayload(t))
 	require.NoError(t, err)
 	require.Equal(t, http.StatusCreated, resp.StatusCode)
 	var data model.GroupPost
@@ -64,8 +65,9 @@ func TestGroupPostUserNotRegistered(t *testing.T) {
 	srv := testServer(t, db)
 	defer clean(t, db, srv)
 
-	createUsers(t, db)
-	resp, err := http.Post(url(srv.URL, "/groups"), "application/json", groupUserNotRegisterPayload(t))
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[0])
+	resp, err := authRequest(t, "POST", url(srv.URL, "/groups"), token, groupUserNotRegisterPayload(t))
 	require.NoError(t, err)
 	require.Equal(t, http.StatusConflict, resp.StatusCode)
 }
@@ -75,8 +77,9 @@ func TestGroupPostGroupAlreadyExist(t *testing.T) {
 	srv := testServer(t, db)
 	defer clean(t, db, srv)
 
-	createUsers(t, db)
-	resp, err := http.Post(url(srv.URL, "/groups"), "application/json", groupSuccessPayload(t))
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[0])
+	resp, err := authRequest(t, "POST", url(srv.URL, "/groups"), token, groupSuccessPayload(t))
 	require.NoError(t, err)
 	require.Equal(t, http.StatusCreated, resp.StatusCode)
 	var data model.GroupPost
@@ -86,7 +89,349 @@ func TestGroupPostGroupAlreadyExist(t *testing.T) {
 	require.Equal(t, groupname, data.Groupname)
 	require.Equal(t, usernames, data.Usernames)
 
-	resp, err = http.Post(url(srv.URL, "/groups"), "application/json", groupSuccessPayload(t))
+	resp, err = authRequest(t, "POST", url(srv.URL, "/groups"), token, groupSuccessPayload(t))
 	require.NoError(t, err)
 	require.Equal(t, http.StatusConflict, resp.StatusCode)
 }
+
+func TestGroupPostUnauthenticated(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+
+	createUsers(t, db)
+	resp, err := http.Post(url(srv.URL, "/groups"), "application/json", groupSuccessPayload(t))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func membersPayload(t *testing.T, names ...string) io.Reader {
+	return toPayload(t, model.GroupMembersPost{Usernames: names})
+}
+
+func groupMemberNames(t *testing.T, db *gorm.DB, group *crud.Group) []string {
+	members, err := crud.GetGroupMembers(db, group.ID)
+	require.NoError(t, err)
+	names := []string{}
+	for _, member := range members {
+		names = append(names, member.User.Username)
+	}
+	return names
+}
+
+func TestGroupGetSuccess(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	createGroup(t, db, users)
+
+	resp, err := authRequest(t, "GET", url(srv.URL, "/groups/"+groupname), authToken(t, db, &users[1]), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var data model.Group
+	err = json.NewDecoder(resp.Body).Decode(&data)
+
+	require.NoError(t, err)
+	require.Equal(t, groupname, data.Groupname)
+	require.ElementsMatch(t, usernames, data.Usernames)
+}
+
+func TestGroupGetNotAMember(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	createGroup(t, db, users[1:])
+
+	resp, err := authRequest(t, "GET", url(srv.URL, "/groups/"+groupname), authToken(t, db, &users[0]), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, err = authRequest(t, "GET", url(srv.URL, "/groups/Slytherin"), authToken(t, db, &users[0]), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestGroupMembersPostSuccess(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users[:1])
+
+	// adding an existing member is a no-op
+	payload := membersPayload(t, users[0].Username, users[1].Username, users[2].Username)
+	resp, err := authRequest(t, "POST", url(srv.URL, "/groups/"+groupname+"/members"), authToken(t, db, &users[0]), payload)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var data model.Group
+	err = json.NewDecoder(resp.Body).Decode(&data)
+
+	require.NoError(t, err)
+	require.ElementsMatch(t, usernames, data.Usernames)
+	require.ElementsMatch(t, usernames, groupMemberNames(t, db, group))
+}
+
+func TestGroupMembersPostUserNotRegistered(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users[:1])
+
+	payload := membersPayload(t, users[1].Username, "Malfoy")
+	resp, err := authRequest(t, "POST", url(srv.URL, "/groups/"+groupname+"/members"), authToken(t, db, &users[0]), payload)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+	require.Equal(t, []string{users[0].Username}, groupMemberNames(t, db, group))
+}
+
+func TestGroupMemberDeleteSuccess(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+
+	resp, err := authRequest(t, "DELETE", url(srv.URL, "/groups/"+groupname+"/members/"+users[2].Username), authToken(t, db, &users[0]), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.ElementsMatch(t, usernames[:2], groupMemberNames(t, db, group))
+
+	resp, err = authRequest(t, "DELETE", url(srv.URL, "/groups/"+groupname+"/members/"+users[2].Username), authToken(t, db, &users[0]), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestGroupLeave(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	token := authToken(t, db, &users[1])
+
+	resp, err := authRequest(t, "POST", url(srv.URL, "/groups/"+groupname+"/leave"), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.ElementsMatch(t, []string{users[0].Username, users[2].Username}, groupMemberNames(t, db, group))
+
+	// former members lose access to the group
+	resp, err = authRequest(t, "GET", url(srv.URL, "/groups/"+groupname), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func groupRoles(t *testing.T, db *gorm.DB, group *crud.Group) map[string]string {
+	members, err := crud.GetGroupMembers(db, group.ID)
+	require.NoError(t, err)
+	roles := map[string]string{}
+	for _, member := range members {
+		roles[member.User.Username] = member.Role
+	}
+	return roles
+}
+
+func TestGroupPostCreatorIsOwner(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	outsider := createOutsider(t, db)
+
+	resp, err := authRequest(t, "POST", url(srv.URL, "/groups"), authToken(t, db, outsider), groupSuccessPayload(t))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	group, exist, err := crud.FindGroup(db, groupname)
+	require.NoError(t, err)
+	require.True(t, exist)
+	roles := groupRoles(t, db, group)
+	require.Len(t, roles, len(users)+1)
+	require.Equal(t, crud.RoleOwner, roles[outsider.Username])
+	for _, user := range users {
+		require.Equal(t, crud.RoleMember, roles[user.Username])
+	}
+}
+
+func TestGroupMemberCannotManage(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	outsider := createOutsider(t, db)
+	createGroup(t, db, users)
+	token := authToken(t, db, &users[1])
+
+	resp, err := authRequest(t, "POST", url(srv.URL, "/groups/"+groupname+"/members"), token, membersPayload(t, outsider.Username))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, err = authRequest(t, "DELETE", url(srv.URL, "/groups/"+groupname+"/members/"+users[2].Username), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, err = authRequest(t, "PATCH", url(srv.URL, "/groups/"+groupname), token, toPayload(t, model.GroupPatch{Groupname: "Slytherin"}))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, err = authRequest(t, "DELETE", url(srv.URL, "/groups/"+groupname), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestGroupAdminManagesMembersOnly(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	err := crud.SetGroupMemberRole(db, group.ID, users[1].ID, crud.RoleAdmin)
+	require.NoError(t, err)
+	token := authToken(t, db, &users[1])
+
+	resp, err := authRequest(t, "DELETE", url(srv.URL, "/groups/"+groupname+"/members/"+users[0].Username), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, err = authRequest(t, "PUT", url(srv.URL, "/groups/"+groupname+"/members/"+users[2].Username), token, toPayload(t, model.GroupMemberPut{Role: crud.RoleAdmin}))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, crud.RoleAdmin, groupRoles(t, db, group)[users[2].Username])
+
+	resp, err = authRequest(t, "DELETE", url(srv.URL, "/groups/"+groupname+"/members/"+users[2].Username), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestGroupRename(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	createGroup(t, db, users)
+
+	resp, err := authRequest(t, "PATCH", url(srv.URL, "/groups/"+groupname), authToken(t, db, &users[0]), toPayload(t, model.GroupPatch{Groupname: "Slytherin"}))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var data model.Group
+	err = json.NewDecoder(resp.Body).Decode(&data)
+
+	require.NoError(t, err)
+	require.Equal(t, "Slytherin", data.Groupname)
+	exist, err := crud.GroupExists(db, groupname)
+	require.NoError(t, err)
+	require.False(t, exist)
+}
+
+func TestGroupPatchConflict(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	_, err := crud.CreateGroup(db, "Slytherin", users[0], nil)
+	require.NoError(t, err)
+
+	// nothing is changed when the new name is taken
+	ttl := int64(3600)
+	resp, err := authRequest(t, "PATCH", url(srv.URL, "/groups/"+groupname), authToken(t, db, &users[0]), toPayload(t, model.GroupPatch{Groupname: "Slytherin", DefaultTTL: &ttl}))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+	found, exist, err := crud.FindGroup(db, groupname)
+	require.NoError(t, err)
+	require.True(t, exist)
+	require.Equal(t, group.ID, found.ID)
+	require.Nil(t, found.DefaultTTL)
+}
+
+func TestGroupDelete(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	msg := createGroupMessage(t, db, &users[1], group, nil)
+
+	// the group managers delete the group, members do not
+	resp, err := authRequest(t, "DELETE", url(srv.URL, "/groups/"+groupname), authToken(t, db, &users[2]), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	require.NoError(t, crud.SetGroupMemberRole(db, group.ID, users[1].ID, crud.RoleAdmin))
+	resp, err = authRequest(t, "DELETE", url(srv.URL, "/groups/"+groupname), authToken(t, db, &users[1]), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	exist, err := crud.GroupExists(db, groupname)
+	require.NoError(t, err)
+	require.False(t, exist)
+	resp = postMessage(t, srv.URL, authToken(t, db, &users[0]), model.ComposedMessage{
+		ReplyMessage: model.ReplyMessage{Subject: "Hello", Body: "Anyone?"},
+		Recipient:    map[string]string{"groupname": groupname},
+	})
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// the members keep the messages of the group
+	_, exist, err = crud.GetMessage(db, msg.ID)
+	require.NoError(t, err)
+	require.True(t, exist)
+	for _, user := range users {
+		require.Equal(t, []int64{msg.ID}, getMailboxIDs(t, srv.URL, authToken(t, db, &user), &user, ""))
+	}
+
+	// replying to all no longer reaches the group
+	reply := replySuccess(t, srv.URL, authToken(t, db, &users[2]), msg.ID, &users[2], model.ReplyModeAll)
+	require.Equal(t, []map[string]string{username(&users[1])}, reply.To)
+	require.Equal(t, []int64{reply.ID, msg.ID}, getMailboxIDs(t, srv.URL, authToken(t, db, &users[1]), &users[1], ""))
+	require.Equal(t, []int64{msg.ID}, getMailboxIDs(t, srv.URL, authToken(t, db, &users[0]), &users[0], ""))
+}
+
+func TestGroupLastOwnerCannotLeave(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	token := authToken(t, db, &users[0])
+
+	resp, err := authRequest(t, "POST", url(srv.URL, "/groups/"+groupname+"/leave"), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp, err = authRequest(t, "PUT", url(srv.URL, "/groups/"+groupname+"/members/"+users[0].Username), token, toPayload(t, model.GroupMemberPut{Role: crud.RoleMember}))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+	require.Equal(t, crud.RoleOwner, groupRoles(t, db, group)[users[0].Username])
+}
+
+func TestGroupOwnershipTransfer(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	token := authToken(t, db, &users[0])
+
+	resp, err := authRequest(t, "POST", url(srv.URL, "/groups/"+groupname+"/owner"), authToken(t, db, &users[1]), toPayload(t, model.GroupOwnerPost{Username: users[1].Username}))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// transferring to themself would leave the group without owner
+	resp, err = authRequest(t, "POST", url(srv.URL, "/groups/"+groupname+"/owner"), token, toPayload(t, model.GroupOwnerPost{Username: users[0].Username}))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+	require.Equal(t, crud.RoleOwner, groupRoles(t, db, group)[users[0].Username])
+
+	resp, err = authRequest(t, "POST", url(srv.URL, "/groups/"+groupname+"/owner"), token, toPayload(t, model.GroupOwnerPost{Username: users[1].Username}))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	roles := groupRoles(t, db, group)
+	require.Equal(t, crud.RoleAdmin, roles[users[0].Username])
+	require.Equal(t, crud.RoleOwner, roles[users[1].Username])
+
+	resp, err = authRequest(t, "POST", url(srv.URL, "/groups/"+groupname+"/leave"), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
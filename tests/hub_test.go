@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/aorticweb/msg-app/app/events"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHubFanOut(t *testing.T) {
+	hub := events.NewHub()
+	first := hub.Subscribe(1, 4)
+	second := hub.Subscribe(1, 4)
+	other := hub.Subscribe(2, 4)
+
+	hub.Publish(events.Event{UserID: 1, Kind: events.KindMessage, MessageID: 10})
+	require.Equal(t, int64(10), (<-first.Events()).MessageID)
+	require.Equal(t, int64(10), (<-second.Events()).MessageID)
+	require.Empty(t, other.Events())
+
+	// a closed subscription stops receiving, the others keep going
+	first.Close()
+	first.Close()
+	_, ok := <-first.Events()
+	require.False(t, ok)
+	require.NoError(t, first.Err())
+	hub.Publish(events.Event{UserID: 1, Kind: events.KindMessage, MessageID: 11})
+	require.Equal(t, int64(11), (<-second.Events()).MessageID)
+}
+
+func TestHubSlowConsumer(t *testing.T) {
+	hub := events.NewHub()
+	slow := hub.Subscribe(1, 1)
+
+	hub.Publish(
+		events.Event{UserID: 1, Kind: events.KindMessage, MessageID: 10},
+		events.Event{UserID: 1, Kind: events.KindMessage, MessageID: 11},
+	)
+	// the buffered event is still delivered before the end of the subscription
+	require.Equal(t, int64(10), (<-slow.Events()).MessageID)
+	_, ok := <-slow.Events()
+	require.False(t, ok)
+	require.ErrorIs(t, slow.Err(), events.ErrSlowConsumer)
+}
+
+func TestHubClose(t *testing.T) {
+	hub := events.NewHub()
+	subscription := hub.Subscribe(1, 1)
+
+	hub.Close()
+	_, ok := <-subscription.Events()
+	require.False(t, ok)
+	require.ErrorIs(t, subscription.Err(), events.ErrHubClosed)
+
+	late := hub.Subscribe(1, 1)
+	_, ok = <-late.Events()
+	require.False(t, ok)
+	require.ErrorIs(t, late.Err(), events.ErrHubClosed)
+}
+
+func TestHubInterrupt(t *testing.T) {
+	hub := events.NewHub()
+	subscription := hub.Subscribe(1, 1)
+
+	hub.Interrupt(events.ErrEventsLost)
+	_, ok := <-subscription.Events()
+	require.False(t, ok)
+	require.ErrorIs(t, subscription.Err(), events.ErrEventsLost)
+
+	// the hub keeps working for the clients that reconnect
+	again := hub.Subscribe(1, 1)
+	hub.Publish(events.Event{UserID: 1, Kind: events.KindMessage, MessageID: 10})
+	require.Equal(t, int64(10), (<-again.Events()).MessageID)
+}
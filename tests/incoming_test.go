@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aorticweb/msg-app/app/config"
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/model"
+	"github.com/stretchr/testify/require"
+)
+
+func createIncomingWebhook(t *testing.T, srvURL string, token string, groupname string, name string) *http.Response {
+	route := url(srvURL, fmt.Sprintf("/groups/%s/incoming-webhooks", groupname))
+	resp, err := authRequest(t, "POST", route, token, toPayload(t, model.IncomingWebhookPost{Name: name}))
+	require.NoError(t, err)
+	return resp
+}
+
+func incomingWebhookSuccess(t *testing.T, srvURL string, token string, groupname string, name string) *model.IncomingWebhook {
+	resp := createIncomingWebhook(t, srvURL, token, groupname, name)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var data model.IncomingWebhook
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&data))
+	require.NotEmpty(t, data.Token)
+	return &data
+}
+
+// postIncomingMessage ... post msg with the incoming webhook token in the X-Msg-Token header
+func postIncomingMessage(t *testing.T, srvURL string, token string, msg model.IncomingMessage) *http.Response {
+	req, err := http.NewRequest("POST", url(srvURL, "/incoming-webhooks/messages"), toPayload(t, msg))
+	require.NoError(t, err)
+	req.Header.Set("X-Msg-Token", token)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestIncomingWebhookMessage(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	webhook := incomingWebhookSuccess(t, srv.URL, authToken(t, db, &users[0]), group.Groupname, "ci")
+	require.Equal(t, "ci[bot]", webhook.Username)
+	require.Equal(t, group.Groupname, webhook.Groupname)
+
+	resp := postIncomingMessage(t, srv.URL, webhook.Token, model.IncomingMessage{Subject: "Build failed", Body: "main is red"})
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var sent model.Message
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&sent))
+	require.Equal(t, "ci[bot]", sent.Sender)
+	require.Equal(t, "Build failed", sent.Subject)
+	require.Equal(t, map[string]string{"groupname": group.Groupname}, sent.Recipient)
+
+	// the subject defaults to the webhook name and the token can be given in the query
+	resp, err := http.Post(url(srv.URL, "/incoming-webhooks/messages?token="+webhook.Token), "application/json",
+		toPayload(t, model.IncomingMessage{Body: "main is green"}))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var defaulted model.Message
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&defaulted))
+	require.Equal(t, "ci", defaulted.Subject)
+
+	for _, user := range users {
+		require.Equal(t, []int64{defaulted.ID, sent.ID}, getMailboxIDs(t, srv.URL, authToken(t, db, &user), &user, ""))
+	}
+
+	resp = postIncomingMessage(t, srv.URL, webhook.Token, model.IncomingMessage{Subject: "No body"})
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = postIncomingMessage(t, srv.URL, "not a token", model.IncomingMessage{Body: "main is red"})
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp, err = http.Post(url(srv.URL, "/incoming-webhooks/messages"), "application/json", toPayload(t, model.IncomingMessage{Body: "main is red"}))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestIncomingWebhookManagement(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	outsider := createOutsider(t, db)
+	ownerToken := authToken(t, db, &users[0])
+
+	// incoming webhooks are managed by the group managers
+	resp := createIncomingWebhook(t, srv.URL, authToken(t, db, &users[1]), group.Groupname, "ci")
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = createIncomingWebhook(t, srv.URL, authToken(t, db, outsider), group.Groupname, "ci")
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = createIncomingWebhook(t, srv.URL, ownerToken, group.Groupname, "ci/cd")
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	webhook := incomingWebhookSuccess(t, srv.URL, ownerToken, group.Groupname, "ci")
+	resp = createIncomingWebhook(t, srv.URL, ownerToken, group.Groupname, "ci")
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+	incomingWebhookSuccess(t, srv.URL, ownerToken, group.Groupname, "monitoring")
+
+	// bots cannot log in and their usernames cannot be registered
+	resp, err := http.Post(url(srv.URL, "/auth/login"), "application/json", toPayload(t, model.Credentials{Username: "ci[bot]", Password: "password"}))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp, err = http.Post(url(srv.URL, "/users"), "application/json", toPayload(t, model.UserPost{Username: "deploy[bot]", Password: "password"}))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	route := url(srv.URL, fmt.Sprintf("/groups/%s/incoming-webhooks/%d", group.Groupname, webhook.ID))
+	resp, err = authRequest(t, "DELETE", route, authToken(t, db, &users[1]), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp, err = authRequest(t, "DELETE", route, ownerToken, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = postIncomingMessage(t, srv.URL, webhook.Token, model.IncomingMessage{Body: "main is red"})
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, err = authRequest(t, "GET", url(srv.URL, fmt.Sprintf("/groups/%s/incoming-webhooks", group.Groupname)), ownerToken, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var list model.IncomingWebhooks
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	require.Len(t, list.IncomingWebhooks, 2)
+	require.NotNil(t, list.IncomingWebhooks[0].RevokedAt)
+	require.Nil(t, list.IncomingWebhooks[1].RevokedAt)
+	for _, listed := range list.IncomingWebhooks {
+		require.Empty(t, listed.Token)
+	}
+}
+
+func TestIncomingWebhookRateLimit(t *testing.T) {
+	db := testDB(t)
+	cfg := config.Default()
+	cfg.IncomingWebhookRate = 2
+	srv := testServerWithConfig(t, db, cfg)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	ownerToken := authToken(t, db, &users[0])
+	ci := incomingWebhookSuccess(t, srv.URL, ownerToken, group.Groupname, "ci")
+	monitoring := incomingWebhookSuccess(t, srv.URL, ownerToken, group.Groupname, "monitoring")
+
+	for i := 0; i < cfg.IncomingWebhookRate; i++ {
+		resp := postIncomingMessage(t, srv.URL, ci.Token, model.IncomingMessage{Body: "main is red"})
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	}
+	resp := postIncomingMessage(t, srv.URL, ci.Token, model.IncomingMessage{Body: "main is red"})
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	require.Equal(t, "60", resp.Header.Get("Retry-After"))
+
+	// each token has its own limit
+	resp = postIncomingMessage(t, srv.URL, monitoring.Token, model.IncomingMessage{Body: "disk full"})
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	bot, exist, err := crud.FindUser(db, ci.Username)
+	require.NoError(t, err)
+	require.True(t, exist)
+	require.NoError(t, db.Model(&crud.Message{}).Where("sender_id = ?", bot.ID).Update("sent_at", time.Now().UTC().Add(-time.Minute-time.Second)).Error)
+	resp = postIncomingMessage(t, srv.URL, ci.Token, model.IncomingMessage{Body: "main is green"})
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+}
@@ -17,7 +17,7 @@ import (
 )
 
 func createGroup(t *testing.T, db *gorm.DB, users []crud.User) *crud.Group {
-	group, err := crud.CreateGroup(db, groupname, users)
+	group, err := crud.CreateGroup(db, groupname, users[0], users[1:])
 	require.NoError(t, err)
 	return group
 }
@@ -81,7 +81,7 @@ func TestSendMessageToUser(t *testing.T) {
 	users := createUsers(t, db)
 
 	msg := messageUserSuccess(t, &users[0], &users[1])
-	resp, err := http.Post(url(srv.URL, "/messages"), "application/json", toPayload(t, msg))
+	resp, err := authRequest(t, "POST", url(srv.URL, "/messages"), authToken(t, db, &users[0]), toPayload(t, msg))
 	require.NoError(t, err)
 	require.Equal(t, http.StatusCreated, resp.StatusCode)
 	var data model.Message
@@ -111,7 +111,7 @@ func TestSendMessageToUserRecipientUserNotFound(t *testing.T) {
 
 	msg := messageUserSuccess(t, &users[0], &users[1])
 	msg.Recipient["username"] = "Fake User"
-	resp, err := http.Post(url(srv.URL, "/messages"), "application/json", toPayload(t, msg))
+	resp, err := authRequest(t, "POST", url(srv.URL, "/messages"), authToken(t, db, &users[0]), toPayload(t, msg))
 	require.NoError(t, err)
 	require.Equal(t, http.StatusNotFound, resp.StatusCode)
 	var data model.Message
@@ -121,7 +121,7 @@ func TestSendMessageToUserRecipientUserNotFound(t *testing.T) {
 	require.True(t, errors.Is(err, gorm.ErrRecordNotFound))
 }
 
-func TestSendMessageToUserSenderNotFound(t *testing.T) {
+func TestSendMessageToUserSenderMismatch(t *testing.T) {
 	db := testDB(t)
 	srv := testServer(t, db)
 	defer clean(t, db, srv)
@@ -129,9 +129,9 @@ func TestSendMessageToUserSenderNotFound(t *testing.T) {
 
 	msg := messageUserSuccess(t, &users[0], &users[1])
 	msg.Sender = "Fake User"
-	resp, err := http.Post(url(srv.URL, "/messages"), "application/json", toPayload(t, msg))
+	resp, err := authRequest(t, "POST", url(srv.URL, "/messages"), authToken(t, db, &users[0]), toPayload(t, msg))
 	require.NoError(t, err)
-	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
 	var data model.Message
 	err = json.NewDecoder(resp.Body).Decode(&data)
 
@@ -147,7 +147,7 @@ func TestMessageToGroup(t *testing.T) {
 	group := createGroup(t, db, users)
 
 	msg := messageGroupSuccess(t, &users[0], group)
-	resp, err := http.Post(url(srv.URL, "/messages"), "application/json", toPayload(t, msg))
+	resp, err := authRequest(t, "POST", url(srv.URL, "/messages"), authToken(t, db, &users[0]), toPayload(t, msg))
 	require.NoError(t, err)
 	require.Equal(t, http.StatusCreated, resp.StatusCode)
 	var data model.Message
@@ -178,7 +178,7 @@ func TestSendMessageToGroupRecipientNotFound(t *testing.T) {
 
 	msg := messageGroupSuccess(t, &users[0], group)
 	msg.Recipient["groupname"] = "Fake Group"
-	resp, err := http.Post(url(srv.URL, "/messages"), "application/json", toPayload(t, msg))
+	resp, err := authRequest(t, "POST", url(srv.URL, "/messages"), authToken(t, db, &users[0]), toPayload(t, msg))
 	require.NoError(t, err)
 	require.Equal(t, http.StatusNotFound, resp.StatusCode)
 	var data model.Message
@@ -204,7 +204,7 @@ func TestSendReplyMessageToUser(t *testing.T) {
 	require.NoError(t, err)
 
 	msg := messageReplySuccess(t, &users[1])
-	resp, err := http.Post(url(srv.URL, fmt.Sprintf("/messages/%d/replies", existingMsg.ID)), "application/json", toPayload(t, msg))
+	resp, err := authRequest(t, "POST", url(srv.URL, fmt.Sprintf("/messages/%d/replies", existingMsg.ID)), authToken(t, db, &users[1]), toPayload(t, msg))
 	require.NoError(t, err)
 	require.Equal(t, http.StatusCreated, resp.StatusCode)
 	var data model.Message
@@ -244,7 +244,7 @@ func TestSendReplyMessageToGroup(t *testing.T) {
 	require.NoError(t, err)
 
 	msg := messageReplySuccess(t, &users[1])
-	resp, err := http.Post(url(srv.URL, fmt.Sprintf("/messages/%d/replies", existingMsg.ID)), "application/json", toPayload(t, msg))
+	resp, err := authRequest(t, "POST", url(srv.URL, fmt.Sprintf("/messages/%d/replies", existingMsg.ID)), authToken(t, db, &users[1]), toPayload(t, msg))
 	require.NoError(t, err)
 	require.Equal(t, http.StatusCreated, resp.StatusCode)
 	var data model.Message
@@ -273,7 +273,7 @@ func TestSendReplyMessageToUserMessageNotFound(t *testing.T) {
 	users := createUsers(t, db)
 
 	msg := messageReplySuccess(t, &users[1])
-	resp, err := http.Post(url(srv.URL, "/messages/1/replies"), "application/json", toPayload(t, msg))
+	resp, err := authRequest(t, "POST", url(srv.URL, "/messages/1/replies"), authToken(t, db, &users[1]), toPayload(t, msg))
 	require.NoError(t, err)
 	require.Equal(t, http.StatusNotFound, resp.StatusCode)
 }
@@ -293,7 +293,7 @@ func TestGetMessageSentToUser(t *testing.T) {
 	_, err := crud.CreateMessage(db, &existingMsg)
 	require.NoError(t, err)
 
-	resp, err := http.Get(url(srv.URL, fmt.Sprintf("/messages/%d", existingMsg.ID)))
+	resp, err := authRequest(t, "GET", url(srv.URL, fmt.Sprintf("/messages/%d", existingMsg.ID)), authToken(t, db, &users[1]), nil)
 	require.NoError(t, err)
 	require.Equal(t, http.StatusOK, resp.StatusCode)
 	var data model.Message
@@ -333,7 +333,7 @@ func TestGetMessageSentToUserWithRe(t *testing.T) {
 	_, err = crud.CreateMessage(db, &existingMsg)
 	require.NoError(t, err)
 
-	resp, err := http.Get(url(srv.URL, fmt.Sprintf("/messages/%d", existingMsg.ID)))
+	resp, err := authRequest(t, "GET", url(srv.URL, fmt.Sprintf("/messages/%d", existingMsg.ID)), authToken(t, db, &users[1]), nil)
 	require.NoError(t, err)
 	require.Equal(t, http.StatusOK, resp.StatusCode)
 	var data model.Message
@@ -363,7 +363,7 @@ func TestGetMessageSentToUserMessageNotFound(t *testing.T) {
 	_, err := crud.CreateMessage(db, &existingMsg)
 	require.NoError(t, err)
 
-	resp, err := http.Get(url(srv.URL, fmt.Sprintf("/messages/%d", 150)))
+	resp, err := authRequest(t, "GET", url(srv.URL, fmt.Sprintf("/messages/%d", 150)), authToken(t, db, &users[1]), nil)
 	require.NoError(t, err)
 	require.Equal(t, http.StatusNotFound, resp.StatusCode)
 }
@@ -411,13 +411,13 @@ func TestGetMessageReplies(t *testing.T) {
 	err = db.Create(&messages).Error
 	require.NoError(t, err)
 
-	resp, err := http.Get(url(srv.URL, fmt.Sprintf("/messages/%d/replies", baseMsg.ID)))
+	resp, err := authRequest(t, "GET", url(srv.URL, fmt.Sprintf("/messages/%d/replies", baseMsg.ID)), authToken(t, db, &users[1]), nil)
 	require.NoError(t, err)
 	require.Equal(t, http.StatusOK, resp.StatusCode)
 
-	var data []model.Message
+	var data model.MessagePage
 	err = json.NewDecoder(resp.Body).Decode(&data)
-	require.True(t, len(data) == 2)
+	require.True(t, len(data.Messages) == 2)
 
 	// TODO:
 	// add tests on messages returned
@@ -465,7 +465,7 @@ func TestGetMessageRepliesMessageNotFound(t *testing.T) {
 	err = db.Create(&messages).Error
 	require.NoError(t, err)
 
-	resp, err := http.Get(url(srv.URL, fmt.Sprintf("/messages/%d/replies", 150)))
+	resp, err := authRequest(t, "GET", url(srv.URL, fmt.Sprintf("/messages/%d/replies", 150)), authToken(t, db, &users[1]), nil)
 	require.NoError(t, err)
 	require.Equal(t, http.StatusNotFound, resp.StatusCode)
 }
@@ -555,17 +555,17 @@ func TestGetUserMailbox(t *testing.T) {
 	require.NoError(t, err)
 
 	validMsgs := []crud.Message{baseMsgs[0], baseMsgs[1], childMsgs[1]}
-	resp, err := http.Get(url(srv.URL, fmt.Sprintf("/users/%s/mailbox", users[0].Username)))
+	resp, err := authRequest(t, "GET", url(srv.URL, fmt.Sprintf("/users/%s/mailbox", users[0].Username)), authToken(t, db, &users[0]), nil)
 	require.NoError(t, err)
 	require.Equal(t, http.StatusOK, resp.StatusCode)
 
-	var data []model.Message
+	var data model.MessagePage
 	err = json.NewDecoder(resp.Body).Decode(&data)
-	log.Println(len(data))
-	require.True(t, len(data) == len(validMsgs))
+	log.Println(len(data.Messages))
+	require.True(t, len(data.Messages) == len(validMsgs))
 
 	dataMap := map[int64]model.Message{}
-	for _, msg := range data {
+	for _, msg := range data.Messages {
 		dataMap[msg.ID] = msg
 	}
 	var found bool
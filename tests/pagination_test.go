@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/model"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// createMailbox ... count messages to recipient, two by two sharing the same sent_at
+func createMailbox(t *testing.T, db *gorm.DB, sender *crud.User, recipient *crud.User, reID *int64, count int) []crud.Message {
+	start := time.Now().UTC().Add(-time.Hour)
+	msgs := []crud.Message{}
+	for i := 0; i < count; i++ {
+		msgs = append(msgs, crud.Message{
+			Sender:    sender,
+			Recipient: recipient,
+			REID:      reID,
+			Subject:   fmt.Sprintf("Page %d", i),
+			Body:      "Paginated",
+			SentAt:    start.Add(time.Duration(i/2) * time.Minute),
+		})
+	}
+	err := db.Create(&msgs).Error
+	require.NoError(t, err)
+	return msgs
+}
+
+// collectPages ... follow next_cursor until the last page, return message ids in order
+func collectPages(t *testing.T, route string, token string, limit int) ([]int64, int) {
+	ids := []int64{}
+	pages := 0
+	cursor := ""
+	for {
+		resp, err := authRequest(t, "GET", fmt.Sprintf("%s?limit=%d&cursor=%s", route, limit, cursor), token, nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var data model.MessagePage
+		err = json.NewDecoder(resp.Body).Decode(&data)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(data.Messages), limit)
+		pages++
+		for _, msg := range data.Messages {
+			ids = append(ids, msg.ID)
+		}
+		if data.NextCursor == "" {
+			return ids, pages
+		}
+		cursor = data.NextCursor
+	}
+}
+
+func expectedOrder(msgs []crud.Message) []int64 {
+	ids := []int64{}
+	for i := len(msgs) - 1; i >= 0; i-- {
+		ids = append(ids, msgs[i].ID)
+	}
+	return ids
+}
+
+func TestMailboxPagination(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	msgs := createMailbox(t, db, &users[0], &users[1], nil, 7)
+
+	route := url(srv.URL, fmt.Sprintf("/users/%s/mailbox", users[1].Username))
+	ids, pages := collectPages(t, route, authToken(t, db, &users[1]), 3)
+	require.Equal(t, 3, pages)
+	require.Equal(t, expectedOrder(msgs), ids)
+}
+
+func TestRepliesPagination(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	base := createDirectMessage(t, db, &users[1], &users[0], nil)
+	msgs := createMailbox(t, db, &users[0], &users[1], &base.ID, 4)
+
+	route := url(srv.URL, fmt.Sprintf("/messages/%d/replies", base.ID))
+	ids, pages := collectPages(t, route, authToken(t, db, &users[1]), 2)
+	require.Equal(t, 2, pages)
+	require.Equal(t, expectedOrder(msgs), ids)
+}
+
+func TestPaginationInvalidParameters(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[1])
+	route := url(srv.URL, fmt.Sprintf("/users/%s/mailbox", users[1].Username))
+
+	for _, query := range []string{"?limit=0", "?limit=abc", "?cursor=not-a-cursor"} {
+		resp, err := authRequest(t, "GET", route+query, token, nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+}
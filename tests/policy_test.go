@@ -0,0 +1,159 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/model"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func createOutsider(t *testing.T, db *gorm.DB) *crud.User {
+	outsider := crud.User{Username: "Malfoy"}
+	err := db.Create(&outsider).Error
+	require.NoError(t, err)
+	return &outsider
+}
+
+func createDirectMessage(t *testing.T, db *gorm.DB, sender *crud.User, recipient *crud.User, reID *int64) *crud.Message {
+	msg := crud.Message{
+		Sender:    sender,
+		Recipient: recipient,
+		REID:      reID,
+		Subject:   "Private",
+		Body:      "For your eyes only",
+		SentAt:    time.Now().UTC(),
+	}
+	_, err := crud.CreateMessage(db, &msg)
+	require.NoError(t, err)
+	return &msg
+}
+
+func createGroupMessage(t *testing.T, db *gorm.DB, sender *crud.User, group *crud.Group, reID *int64) *crud.Message {
+	msg := crud.Message{
+		Sender:  sender,
+		Group:   group,
+		REID:    reID,
+		Subject: "Team",
+		Body:    "For the whole team",
+		SentAt:  time.Now().UTC(),
+	}
+	_, err := crud.CreateMessage(db, &msg)
+	require.NoError(t, err)
+	return &msg
+}
+
+func TestGetMessageAllowedReaders(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users[1:])
+	direct := createDirectMessage(t, db, &users[0], &users[1], nil)
+	groupMsg := createGroupMessage(t, db, &users[0], group, nil)
+
+	allowed := []struct {
+		reader *crud.User
+		msg    *crud.Message
+	}{
+		{&users[0], direct},   // sender
+		{&users[1], direct},   // direct recipient
+		{&users[0], groupMsg}, // sender outside of the group
+		{&users[2], groupMsg}, // group member
+	}
+	for _, tc := range allowed {
+		resp, err := authRequest(t, "GET", url(srv.URL, fmt.Sprintf("/messages/%d", tc.msg.ID)), authToken(t, db, tc.reader), nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+}
+
+func TestGetMessageDeniedReaders(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users[:2])
+	direct := createDirectMessage(t, db, &users[0], &users[1], nil)
+	groupMsg := createGroupMessage(t, db, &users[0], group, nil)
+
+	for _, msg := range []*crud.Message{direct, groupMsg} {
+		resp, err := authRequest(t, "GET", url(srv.URL, fmt.Sprintf("/messages/%d", msg.ID)), authToken(t, db, &users[2]), nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+func TestGetMessageRepliesDenied(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	direct := createDirectMessage(t, db, &users[0], &users[1], nil)
+	createDirectMessage(t, db, &users[1], &users[0], &direct.ID)
+
+	resp, err := authRequest(t, "GET", url(srv.URL, fmt.Sprintf("/messages/%d/replies", direct.ID)), authToken(t, db, &users[2]), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestGetMessageRepliesOnlyVisible(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	groupMsg := createGroupMessage(t, db, &users[0], group, nil)
+	visible := createGroupMessage(t, db, &users[1], group, &groupMsg.ID)
+	// private reply between two members is hidden from the third one
+	createDirectMessage(t, db, &users[1], &users[0], &groupMsg.ID)
+
+	resp, err := authRequest(t, "GET", url(srv.URL, fmt.Sprintf("/messages/%d/replies", groupMsg.ID)), authToken(t, db, &users[2]), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var data model.MessagePage
+	err = json.NewDecoder(resp.Body).Decode(&data)
+
+	require.NoError(t, err)
+	require.Len(t, data.Messages, 1)
+	require.Equal(t, visible.ID, data.Messages[0].ID)
+}
+
+func TestReplyToUnreadableMessageDenied(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	direct := createDirectMessage(t, db, &users[0], &users[1], nil)
+
+	msg := messageReplySuccess(t, &users[2])
+	resp, err := authRequest(t, "POST", url(srv.URL, fmt.Sprintf("/messages/%d/replies", direct.ID)), authToken(t, db, &users[2]), toPayload(t, msg))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	replies, _, err := crud.GetMessageReplies(db, direct.ID, users[0].ID, crud.Page{Limit: crud.DefaultPageLimit})
+	require.NoError(t, err)
+	require.Empty(t, replies)
+}
+
+func TestGetOtherUserMailboxForbidden(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	outsider := createOutsider(t, db)
+	createDirectMessage(t, db, &users[0], &users[1], nil)
+
+	resp, err := authRequest(t, "GET", url(srv.URL, fmt.Sprintf("/users/%s/mailbox", users[1].Username)), authToken(t, db, outsider), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, err = authRequest(t, "GET", url(srv.URL, "/users/Nobody/mailbox"), authToken(t, db, outsider), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/model"
+	"github.com/stretchr/testify/require"
+)
+
+func username(user *crud.User) map[string]string {
+	return map[string]string{"username": user.Username}
+}
+
+func postMessage(t *testing.T, srvURL string, token string, msg model.ComposedMessage) *http.Response {
+	resp, err := authRequest(t, "POST", url(srvURL, "/messages"), token, toPayload(t, msg))
+	require.NoError(t, err)
+	return resp
+}
+
+func TestSendMessageToManyRecipients(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	outsider := createOutsider(t, db)
+
+	msg := messageReplySuccess(t, &users[0])
+	msg.To = []map[string]string{username(&users[1])}
+	msg.Cc = []map[string]string{{"groupname": group.Groupname}}
+	msg.Bcc = []map[string]string{username(outsider)}
+	resp := postMessage(t, srv.URL, authToken(t, db, &users[0]), msg)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var data model.Message
+	err := json.NewDecoder(resp.Body).Decode(&data)
+	require.NoError(t, err)
+	require.Equal(t, username(&users[1]), data.Recipient)
+	require.Equal(t, msg.Bcc, data.Bcc)
+
+	// Hermione is reached directly and through the group but gets the message once
+	recipientToken := authToken(t, db, &users[1])
+	require.Equal(t, []int64{data.ID}, getMailboxIDs(t, srv.URL, recipientToken, &users[1], ""))
+	seen := getMessage(t, srv.URL, recipientToken, data.ID)
+	require.Equal(t, msg.To, seen.To)
+	require.Equal(t, msg.Cc, seen.Cc)
+	require.Empty(t, seen.Bcc)
+
+	outsiderToken := authToken(t, db, outsider)
+	require.Equal(t, []int64{data.ID}, getMailboxIDs(t, srv.URL, outsiderToken, outsider, ""))
+	seen = getMessage(t, srv.URL, outsiderToken, data.ID)
+	require.Equal(t, []map[string]string{username(outsider)}, seen.Bcc)
+
+	require.Equal(t, []int64{data.ID}, getMailboxIDs(t, srv.URL, authToken(t, db, &users[2]), &users[2], "kind=group"))
+}
+
+func TestSendMessageBccOnly(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+
+	msg := messageReplySuccess(t, &users[0])
+	msg.Bcc = []map[string]string{username(&users[1]), username(&users[2])}
+	resp := postMessage(t, srv.URL, authToken(t, db, &users[0]), msg)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var data model.Message
+	err := json.NewDecoder(resp.Body).Decode(&data)
+	require.NoError(t, err)
+	require.Empty(t, data.Recipient)
+	require.Len(t, data.Bcc, 2)
+
+	seen := getMessage(t, srv.URL, authToken(t, db, &users[2]), data.ID)
+	require.Empty(t, seen.To)
+	require.Equal(t, []map[string]string{username(&users[2])}, seen.Bcc)
+}
+
+func TestSendMessageDuplicateRecipient(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+
+	msg := messageUserSuccess(t, &users[0], &users[1])
+	msg.To = []map[string]string{username(&users[1])}
+	msg.Bcc = []map[string]string{username(&users[1])}
+	resp := postMessage(t, srv.URL, authToken(t, db, &users[0]), msg)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var data model.Message
+	err := json.NewDecoder(resp.Body).Decode(&data)
+	require.NoError(t, err)
+	require.Equal(t, []map[string]string{username(&users[1])}, data.To)
+	require.Empty(t, data.Bcc)
+}
+
+func TestSendMessageInvalidRecipients(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[0])
+
+	msg := messageReplySuccess(t, &users[0])
+	resp := postMessage(t, srv.URL, token, msg)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	msg.Cc = []map[string]string{{"username": users[1].Username, "groupname": groupname}}
+	resp = postMessage(t, srv.URL, token, msg)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	msg.Cc = []map[string]string{{"username": "Voldemort"}}
+	resp = postMessage(t, srv.URL, token, msg)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/model"
+	"github.com/stretchr/testify/require"
+)
+
+func postReply(t *testing.T, srvURL string, token string, reID int64, sender *crud.User, mode string) *http.Response {
+	reply := model.ReplyPost{
+		ReplyMessage: messageReplySuccess(t, sender).ReplyMessage,
+		Mode:         mode,
+	}
+	resp, err := authRequest(t, "POST", url(srvURL, fmt.Sprintf("/messages/%d/replies", reID)), token, toPayload(t, reply))
+	require.NoError(t, err)
+	return resp
+}
+
+func replySuccess(t *testing.T, srvURL string, token string, reID int64, sender *crud.User, mode string) model.Message {
+	resp := postReply(t, srvURL, token, reID, sender, mode)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var data model.Message
+	err := json.NewDecoder(resp.Body).Decode(&data)
+	require.NoError(t, err)
+	require.Equal(t, reID, *data.RE)
+	return data
+}
+
+func TestReplyToGroupMessage(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	msg := createGroupMessage(t, db, &users[0], group, nil)
+	token := authToken(t, db, &users[1])
+
+	data := replySuccess(t, srv.URL, token, msg.ID, &users[1], model.ReplyModeSender)
+	require.Equal(t, []map[string]string{username(&users[0])}, data.To)
+	require.Empty(t, data.Cc)
+	require.NotContains(t, getMailboxIDs(t, srv.URL, authToken(t, db, &users[2]), &users[2], ""), data.ID)
+
+	data = replySuccess(t, srv.URL, token, msg.ID, &users[1], model.ReplyModeAll)
+	require.Equal(t, []map[string]string{username(&users[0]), {"groupname": group.Groupname}}, data.To)
+	require.Contains(t, getMailboxIDs(t, srv.URL, authToken(t, db, &users[2]), &users[2], ""), data.ID)
+
+	// all is the default mode
+	data = replySuccess(t, srv.URL, token, msg.ID, &users[1], "")
+	require.Equal(t, []map[string]string{username(&users[0]), {"groupname": group.Groupname}}, data.To)
+}
+
+func TestReplyToOwnMessage(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	outsider := createOutsider(t, db)
+	token := authToken(t, db, &users[0])
+
+	msg := messageUserSuccess(t, &users[0], &users[1])
+	msg.Cc = []map[string]string{username(&users[2])}
+	msg.Bcc = []map[string]string{username(outsider)}
+	resp := postMessage(t, srv.URL, token, msg)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var sent model.Message
+	err := json.NewDecoder(resp.Body).Decode(&sent)
+	require.NoError(t, err)
+
+	// a follow up goes to the original recipient, not back to the sender
+	data := replySuccess(t, srv.URL, token, sent.ID, &users[0], model.ReplyModeSender)
+	require.Equal(t, []map[string]string{username(&users[1])}, data.To)
+	require.Empty(t, data.Cc)
+	require.Empty(t, data.Bcc)
+	require.NotContains(t, getMailboxIDs(t, srv.URL, token, &users[0], ""), data.ID)
+
+	data = replySuccess(t, srv.URL, token, sent.ID, &users[0], model.ReplyModeAll)
+	require.Equal(t, []map[string]string{username(&users[1])}, data.To)
+	require.Equal(t, []map[string]string{username(&users[2])}, data.Cc)
+	require.Empty(t, data.Bcc)
+	require.NotContains(t, getMailboxIDs(t, srv.URL, authToken(t, db, outsider), outsider, ""), data.ID)
+}
+
+func TestReplyToOwnBccOnlyMessage(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[0])
+
+	msg := messageReplySuccess(t, &users[0])
+	msg.Bcc = []map[string]string{username(&users[1]), username(&users[2])}
+	resp := postMessage(t, srv.URL, token, msg)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var sent model.Message
+	err := json.NewDecoder(resp.Body).Decode(&sent)
+	require.NoError(t, err)
+
+	// the bcc recipients are not disclosed to each other, the follow up is a note to self
+	data := replySuccess(t, srv.URL, token, sent.ID, &users[0], model.ReplyModeSender)
+	require.Equal(t, []map[string]string{username(&users[0])}, data.To)
+	require.Empty(t, data.Bcc)
+	for _, user := range users[1:] {
+		require.NotContains(t, getMailboxIDs(t, srv.URL, authToken(t, db, &user), &user, ""), data.ID)
+	}
+}
+
+func TestReplyAllExcludesReplierAndBcc(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	outsider := createOutsider(t, db)
+
+	msg := messageUserSuccess(t, &users[0], &users[1])
+	msg.Cc = []map[string]string{username(&users[2])}
+	msg.Bcc = []map[string]string{username(outsider)}
+	resp := postMessage(t, srv.URL, authToken(t, db, &users[0]), msg)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var sent model.Message
+	err := json.NewDecoder(resp.Body).Decode(&sent)
+	require.NoError(t, err)
+
+	data := replySuccess(t, srv.URL, authToken(t, db, &users[2]), sent.ID, &users[2], model.ReplyModeAll)
+	require.Equal(t, []map[string]string{username(&users[0]), username(&users[1])}, data.To)
+	require.Empty(t, data.Cc)
+	require.Empty(t, data.Bcc)
+
+	// a bcc recipient replying to all does not reveal the other bcc recipients
+	data = replySuccess(t, srv.URL, authToken(t, db, outsider), sent.ID, outsider, model.ReplyModeAll)
+	require.Equal(t, []map[string]string{username(&users[0]), username(&users[1])}, data.To)
+	require.Equal(t, []map[string]string{username(&users[2])}, data.Cc)
+	require.Empty(t, data.Bcc)
+}
+
+func TestReplyToNoteToSelf(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[0])
+	msg := createDirectMessage(t, db, &users[0], &users[0], nil)
+
+	for _, mode := range []string{model.ReplyModeSender, model.ReplyModeAll} {
+		data := replySuccess(t, srv.URL, token, msg.ID, &users[0], mode)
+		require.Equal(t, []map[string]string{username(&users[0])}, data.To)
+	}
+}
+
+func TestReplyInvalidMode(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	msg := createDirectMessage(t, db, &users[0], &users[1], nil)
+
+	resp := postReply(t, srv.URL, authToken(t, db, &users[1]), msg.ID, &users[1], "everyone")
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/model"
+	"github.com/stretchr/testify/require"
+)
+
+func patchMessage(t *testing.T, srvURL string, token string, msg *crud.Message, body io.Reader) *http.Response {
+	resp, err := authRequest(t, "PATCH", url(srvURL, fmt.Sprintf("/messages/%d", msg.ID)), token, body)
+	require.NoError(t, err)
+	return resp
+}
+
+func getRevisions(t *testing.T, srvURL string, token string, msg *crud.Message) []model.Revision {
+	resp, err := authRequest(t, "GET", url(srvURL, fmt.Sprintf("/messages/%d/revisions", msg.ID)), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var data model.Revisions
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	require.NoError(t, err)
+	return data.Revisions
+}
+
+func TestMessageEdit(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	msg := createDirectMessage(t, db, &users[0], &users[1], nil)
+	token := authToken(t, db, &users[0])
+
+	resp := patchMessage(t, srv.URL, token, msg, toPayload(t, map[string]string{"body": "Edited once"}))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var data model.Message
+	err := json.NewDecoder(resp.Body).Decode(&data)
+	require.NoError(t, err)
+	require.Equal(t, msg.Subject, data.Subject)
+	require.Equal(t, "Edited once", data.Body)
+	require.NotNil(t, data.EditedAt)
+
+	resp = patchMessage(t, srv.URL, token, msg, toPayload(t, map[string]string{"subject": "Renamed", "body": "Edited twice"}))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	recipientToken := authToken(t, db, &users[1])
+	current := getMessage(t, srv.URL, recipientToken, msg.ID)
+	require.Equal(t, "Renamed", current.Subject)
+	require.Equal(t, "Edited twice", current.Body)
+
+	revisions := getRevisions(t, srv.URL, recipientToken, msg)
+	require.Len(t, revisions, 2)
+	require.Equal(t, msg.Body, revisions[0].Body)
+	require.Equal(t, msg.Subject, revisions[0].Subject)
+	require.Equal(t, "Edited once", revisions[1].Body)
+	require.Equal(t, revisions[0].ReplacedAt, revisions[1].WrittenAt)
+}
+
+func TestMessageEditForbidden(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	msg := createDirectMessage(t, db, &users[0], &users[1], nil)
+
+	resp := patchMessage(t, srv.URL, authToken(t, db, &users[1]), msg, toPayload(t, map[string]string{"body": "Not mine"}))
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = patchMessage(t, srv.URL, authToken(t, db, &users[2]), msg, toPayload(t, map[string]string{"body": "Not visible"}))
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.Empty(t, getRevisions(t, srv.URL, authToken(t, db, &users[1]), msg))
+}
+
+func TestMessageEditInvalid(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	msg := createDirectMessage(t, db, &users[0], &users[1], nil)
+	token := authToken(t, db, &users[0])
+
+	resp := patchMessage(t, srv.URL, token, msg, toPayload(t, map[string]string{}))
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = patchMessage(t, srv.URL, token, msg, toPayload(t, map[string]string{"body": ""}))
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestMessageEditWindowExpired(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	msg := createDirectMessage(t, db, &users[0], &users[1], nil)
+	err := db.Model(msg).Update("sent_at", time.Now().UTC().Add(-time.Hour)).Error
+	require.NoError(t, err)
+
+	resp := patchMessage(t, srv.URL, authToken(t, db, &users[0]), msg, toPayload(t, map[string]string{"body": "Too late"}))
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
@@ -0,0 +1,204 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/events"
+	"github.com/aorticweb/msg-app/app/jobs"
+	"github.com/aorticweb/msg-app/app/model"
+	"github.com/stretchr/testify/require"
+)
+
+func scheduleMessage(t *testing.T, srvURL string, token string, sender *crud.User, recipient *crud.User, sendAt time.Time) *model.Message {
+	msg := messageUserSuccess(t, sender, recipient)
+	msg.SendAt = &sendAt
+	resp := postMessage(t, srvURL, token, msg)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var data model.Message
+	err := json.NewDecoder(resp.Body).Decode(&data)
+	require.NoError(t, err)
+	return &data
+}
+
+func getScheduledIDs(t *testing.T, srvURL string, token string, user *crud.User) []int64 {
+	resp, err := authRequest(t, "GET", url(srvURL, fmt.Sprintf("/users/%s/scheduled", user.Username)), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var page model.MessagePage
+	err = json.NewDecoder(resp.Body).Decode(&page)
+	require.NoError(t, err)
+	ids := []int64{}
+	for _, msg := range page.Messages {
+		ids = append(ids, msg.ID)
+	}
+	return ids
+}
+
+func TestScheduledMessageDelivery(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[0])
+	recipientToken := authToken(t, db, &users[1])
+	sendAt := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+
+	data := scheduleMessage(t, srv.URL, token, &users[0], &users[1], sendAt)
+	require.True(t, sendAt.Equal(*data.SendAt))
+
+	// pending messages are only listed to their sender
+	require.Equal(t, []int64{data.ID}, getScheduledIDs(t, srv.URL, token, &users[0]))
+	require.Empty(t, getMailboxIDs(t, srv.URL, recipientToken, &users[1], ""))
+	require.Equal(t, int64(0), getUnreadCount(t, srv.URL, recipientToken, &users[1]))
+	resp, err := authRequest(t, "GET", url(srv.URL, fmt.Sprintf("/messages/%d", data.ID)), recipientToken, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	delivered, err := crud.DeliverScheduledMessages(db, sendAt.Add(-time.Minute), 10)
+	require.NoError(t, err)
+	require.Empty(t, delivered)
+	delivered, err = crud.DeliverScheduledMessages(db, sendAt, 10)
+	require.NoError(t, err)
+	require.Equal(t, []int64{data.ID}, delivered)
+
+	require.Empty(t, getScheduledIDs(t, srv.URL, token, &users[0]))
+	require.Equal(t, []int64{data.ID}, getMailboxIDs(t, srv.URL, recipientToken, &users[1], ""))
+	seen := getMessage(t, srv.URL, recipientToken, data.ID)
+	require.Nil(t, seen.SendAt)
+
+	// a delivered message cannot be rescheduled anymore
+	resp, err = authRequest(t, "DELETE", url(srv.URL, fmt.Sprintf("/messages/%d/schedule", data.ID)), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+func TestScheduledMessagesPaging(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[0])
+	now := time.Now().UTC()
+	later := scheduleMessage(t, srv.URL, token, &users[0], &users[1], now.Add(3*time.Hour))
+	soon := scheduleMessage(t, srv.URL, token, &users[0], &users[1], now.Add(time.Hour))
+	next := scheduleMessage(t, srv.URL, token, &users[0], &users[1], now.Add(2*time.Hour))
+
+	route := url(srv.URL, fmt.Sprintf("/users/%s/scheduled?limit=2", users[0].Username))
+	resp, err := authRequest(t, "GET", route, token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var page model.MessagePage
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&page))
+	require.Len(t, page.Messages, 2)
+	require.Equal(t, soon.ID, page.Messages[0].ID)
+	require.Equal(t, next.ID, page.Messages[1].ID)
+	require.NotEmpty(t, page.NextCursor)
+
+	resp, err = authRequest(t, "GET", route+"&cursor="+page.NextCursor, token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	page = model.MessagePage{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&page))
+	require.Len(t, page.Messages, 1)
+	require.Equal(t, later.ID, page.Messages[0].ID)
+	require.Empty(t, page.NextCursor)
+}
+
+func TestScheduledMessageReschedule(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[0])
+	sendAt := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	data := scheduleMessage(t, srv.URL, token, &users[0], &users[1], sendAt)
+	route := url(srv.URL, fmt.Sprintf("/messages/%d/schedule", data.ID))
+
+	later := sendAt.Add(time.Hour)
+	resp, err := authRequest(t, "PUT", route, token, toPayload(t, model.SchedulePut{SendAt: later}))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var rescheduled model.Message
+	err = json.NewDecoder(resp.Body).Decode(&rescheduled)
+	require.NoError(t, err)
+	require.True(t, later.Equal(*rescheduled.SendAt))
+
+	delivered, err := crud.DeliverScheduledMessages(db, sendAt, 10)
+	require.NoError(t, err)
+	require.Empty(t, delivered)
+
+	resp, err = authRequest(t, "PUT", route, token, toPayload(t, model.SchedulePut{SendAt: time.Now().Add(-time.Minute)}))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// the recipient does not know about the message yet
+	resp, err = authRequest(t, "PUT", route, authToken(t, db, &users[1]), toPayload(t, model.SchedulePut{SendAt: later}))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestScheduledMessageCancel(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[0])
+	sendAt := time.Now().UTC().Add(time.Hour)
+	data := scheduleMessage(t, srv.URL, token, &users[0], &users[1], sendAt)
+
+	route := url(srv.URL, fmt.Sprintf("/messages/%d/schedule", data.ID))
+	resp, err := authRequest(t, "DELETE", route, token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Empty(t, getScheduledIDs(t, srv.URL, token, &users[0]))
+
+	delivered, err := crud.DeliverScheduledMessages(db, sendAt, 10)
+	require.NoError(t, err)
+	require.Empty(t, delivered)
+	resp, err = authRequest(t, "DELETE", route, token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestScheduledMessageInPast(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+
+	msg := messageUserSuccess(t, &users[0], &users[1])
+	sendAt := time.Now().Add(-time.Minute)
+	msg.SendAt = &sendAt
+	resp := postMessage(t, srv.URL, authToken(t, db, &users[0]), msg)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestScheduledDeliveryPublishes(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	msg := messageGroupSuccess(t, &users[0], group)
+	sendAt := time.Now().UTC().Add(time.Hour)
+	msg.SendAt = &sendAt
+	resp := postMessage(t, srv.URL, authToken(t, db, &users[0]), msg)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var data model.Message
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&data))
+	require.NoError(t, db.Model(&crud.Message{}).Where("id = ?", data.ID).Update("send_at", time.Now().UTC().Add(-time.Second)).Error)
+
+	bus := events.NewMemoryBus()
+	subscription := bus.Subscribe(users[2].ID, 4)
+	require.NoError(t, jobs.ScheduledDelivery(db, bus)(context.Background()))
+	event := nextEvent(t, subscription)
+	require.Equal(t, events.KindMessage, event.Kind)
+	require.Equal(t, data.ID, event.MessageID)
+	require.NotZero(t, event.ID)
+}
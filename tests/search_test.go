@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"testing"
+	"time"
+
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/model"
+	"github.com/stretchr/testify/require"
+)
+
+func searchMessages(t *testing.T, srvURL string, token string, query string) model.SearchPage {
+	resp, err := authRequest(t, "GET", url(srvURL, "/search/messages?"+query), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var data model.SearchPage
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	require.NoError(t, err)
+	return data
+}
+
+func TestSearchMessages(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	outsiderGroup := createGroup(t, db, users[1:])
+	now := time.Now().UTC()
+
+	msgs := []crud.Message{
+		// subject matches rank above body matches
+		{Sender: &users[1], Recipient: &users[0], Subject: "Dragons", Body: "Hagrid has a new pet", SentAt: now},
+		{Sender: &users[2], Group: group, Subject: "Care of magical creatures", Body: "We will study dragons on Monday", SentAt: now},
+		{Sender: &users[1], Group: group, Subject: "Potions", Body: "Nothing to see here", SentAt: now},
+		// not part of the mailbox
+		{Sender: &users[1], Group: outsiderGroup, Subject: "Dragons again", Body: "Secret", SentAt: now},
+		{Sender: &users[0], Recipient: &users[1], Subject: "Dragons sent", Body: "Sent by the caller", SentAt: now},
+	}
+	err := db.Create(&msgs).Error
+	require.NoError(t, err)
+
+	data := searchMessages(t, srv.URL, authToken(t, db, &users[0]), "q=dragon")
+	require.Len(t, data.Results, 2)
+	require.Nil(t, data.NextOffset)
+	require.Equal(t, msgs[0].ID, data.Results[0].Message.ID)
+	require.Equal(t, msgs[1].ID, data.Results[1].Message.ID)
+	require.Greater(t, data.Results[0].Rank, data.Results[1].Rank)
+	require.Contains(t, data.Results[0].Snippet, "<mark>Dragons</mark>")
+	require.Contains(t, data.Results[1].Snippet, "<mark>dragons</mark>")
+}
+
+func TestSearchMessagesEscapesSnippet(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+
+	msg := crud.Message{Sender: &users[1], Recipient: &users[0], Subject: "Dragons",
+		Body: `<img src=x onerror="alert(1)"> & dragons`, SentAt: time.Now().UTC()}
+	require.NoError(t, db.Create(&msg).Error)
+
+	data := searchMessages(t, srv.URL, authToken(t, db, &users[0]), "q=dragon")
+	require.Len(t, data.Results, 1)
+	snippet := data.Results[0].Snippet
+	require.NotContains(t, snippet, "<img")
+	require.Contains(t, snippet, "&lt;img")
+	require.Contains(t, snippet, "&amp;")
+	require.Contains(t, snippet, "<mark>dragons</mark>")
+}
+
+func TestSearchMessagesPaging(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	createMailbox(t, db, &users[1], &users[0], nil, 3)
+	token := authToken(t, db, &users[0])
+
+	first := searchMessages(t, srv.URL, token, "q=paginated&limit=2")
+	require.Len(t, first.Results, 2)
+	require.NotNil(t, first.NextOffset)
+	second := searchMessages(t, srv.URL, token, fmt.Sprintf("q=paginated&limit=2&offset=%d", *first.NextOffset))
+	require.Len(t, second.Results, 1)
+	require.Nil(t, second.NextOffset)
+}
+
+func TestSearchMessagesInvalidQuery(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[0])
+
+	for _, query := range []string{"", "q=", "q=dragon&limit=0", "q=dragon&offset=-1"} {
+		resp, err := authRequest(t, "GET", url(srv.URL, "/search/messages?"+query), token, nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+	}
+
+	// web search syntax never fails to parse
+	data := searchMessages(t, srv.URL, token, "q="+neturl.QueryEscape(`"unbalanced -`))
+	require.Empty(t, data.Results)
+}
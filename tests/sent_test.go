@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/aorticweb/msg-app/app/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetUserSent(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	direct := createDirectMessage(t, db, &users[0], &users[1], nil)
+	groupMsg := createGroupMessage(t, db, &users[0], group, nil)
+	// received messages are not part of the sent folder
+	createDirectMessage(t, db, &users[1], &users[0], nil)
+	createGroupMessage(t, db, &users[2], group, nil)
+
+	resp, err := authRequest(t, "GET", url(srv.URL, fmt.Sprintf("/users/%s/sent", users[0].Username)), authToken(t, db, &users[0]), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var data model.MessagePage
+	err = json.NewDecoder(resp.Body).Decode(&data)
+
+	require.NoError(t, err)
+	require.Len(t, data.Messages, 2)
+	require.Equal(t, groupMsg.ID, data.Messages[0].ID)
+	require.Equal(t, direct.ID, data.Messages[1].ID)
+	require.Equal(t, users[1].Username, data.Messages[1].Recipient["username"])
+	require.Equal(t, users[0].Username, data.Messages[0].Sender)
+}
+
+func TestGetUserSentPagination(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	msgs := createMailbox(t, db, &users[0], &users[1], nil, 5)
+
+	route := url(srv.URL, fmt.Sprintf("/users/%s/sent", users[0].Username))
+	ids, pages := collectPages(t, route, authToken(t, db, &users[0]), 2)
+	require.Equal(t, 3, pages)
+	require.Equal(t, expectedOrder(msgs), ids)
+}
+
+func TestGetOtherUserSentForbidden(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	createDirectMessage(t, db, &users[0], &users[1], nil)
+
+	resp, err := authRequest(t, "GET", url(srv.URL, fmt.Sprintf("/users/%s/sent", users[0].Username)), authToken(t, db, &users[1]), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
@@ -0,0 +1,145 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/model"
+	"github.com/stretchr/testify/require"
+)
+
+func getUnreadCount(t *testing.T, srvURL string, token string, user *crud.User) int64 {
+	resp, err := authRequest(t, "GET", url(srvURL, fmt.Sprintf("/users/%s/mailbox/unread-count", user.Username)), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var data model.UnreadCount
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	require.NoError(t, err)
+	return data.Unread
+}
+
+func getMessageUnread(t *testing.T, srvURL string, token string, msg *crud.Message) bool {
+	resp, err := authRequest(t, "GET", url(srvURL, fmt.Sprintf("/messages/%d", msg.ID)), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var data model.Message
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	require.NoError(t, err)
+	require.NotNil(t, data.Unread)
+	return *data.Unread
+}
+
+func TestMessageReadUnread(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	msg := createDirectMessage(t, db, &users[0], &users[1], nil)
+	token := authToken(t, db, &users[1])
+
+	require.True(t, getMessageUnread(t, srv.URL, token, msg))
+	require.False(t, getMessageUnread(t, srv.URL, authToken(t, db, &users[0]), msg))
+
+	resp, err := authRequest(t, "PUT", url(srv.URL, fmt.Sprintf("/messages/%d/read", msg.ID)), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.False(t, getMessageUnread(t, srv.URL, token, msg))
+
+	resp, err = authRequest(t, "DELETE", url(srv.URL, fmt.Sprintf("/messages/%d/read", msg.ID)), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.True(t, getMessageUnread(t, srv.URL, token, msg))
+}
+
+func TestMessageReadNotVisible(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	msg := createDirectMessage(t, db, &users[0], &users[1], nil)
+
+	resp, err := authRequest(t, "PUT", url(srv.URL, fmt.Sprintf("/messages/%d/read", msg.ID)), authToken(t, db, &users[2]), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestGroupMessageReadStatePerMember(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	msg := createGroupMessage(t, db, &users[0], group, nil)
+	tokens := []string{authToken(t, db, &users[0]), authToken(t, db, &users[1]), authToken(t, db, &users[2])}
+
+	// the sender never has its own message unread
+	require.Equal(t, int64(0), getUnreadCount(t, srv.URL, tokens[0], &users[0]))
+	require.Equal(t, int64(1), getUnreadCount(t, srv.URL, tokens[1], &users[1]))
+	require.Equal(t, int64(1), getUnreadCount(t, srv.URL, tokens[2], &users[2]))
+
+	resp, err := authRequest(t, "PUT", url(srv.URL, fmt.Sprintf("/messages/%d/read", msg.ID)), tokens[1], nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	require.Equal(t, int64(0), getUnreadCount(t, srv.URL, tokens[1], &users[1]))
+	require.Equal(t, int64(1), getUnreadCount(t, srv.URL, tokens[2], &users[2]))
+	require.True(t, getMessageUnread(t, srv.URL, tokens[2], msg))
+}
+
+func TestMailboxMarkManyAndAll(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	direct := createDirectMessage(t, db, &users[0], &users[1], nil)
+	groupMsg := createGroupMessage(t, db, &users[2], group, nil)
+	createDirectMessage(t, db, &users[2], &users[1], nil)
+	// messages the user did not receive are ignored
+	other := createDirectMessage(t, db, &users[0], &users[2], nil)
+	token := authToken(t, db, &users[1])
+	readURL := url(srv.URL, fmt.Sprintf("/users/%s/mailbox/read", users[1].Username))
+	unreadURL := url(srv.URL, fmt.Sprintf("/users/%s/mailbox/unread", users[1].Username))
+	require.Equal(t, int64(3), getUnreadCount(t, srv.URL, token, &users[1]))
+
+	payload := toPayload(t, model.MessageStatePost{IDs: []int64{direct.ID, groupMsg.ID, other.ID}})
+	resp, err := authRequest(t, "POST", readURL, token, payload)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Equal(t, int64(1), getUnreadCount(t, srv.URL, token, &users[1]))
+	require.Equal(t, int64(1), getUnreadCount(t, srv.URL, authToken(t, db, &users[2]), &users[2]))
+
+	resp, err = authRequest(t, "POST", readURL, token, toPayload(t, model.MessageStatePost{All: true}))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Equal(t, int64(0), getUnreadCount(t, srv.URL, token, &users[1]))
+
+	resp, err = authRequest(t, "POST", unreadURL, token, toPayload(t, model.MessageStatePost{IDs: []int64{groupMsg.ID}}))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Equal(t, int64(1), getUnreadCount(t, srv.URL, token, &users[1]))
+
+	resp, err = authRequest(t, "POST", unreadURL, token, toPayload(t, model.MessageStatePost{All: true}))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Equal(t, int64(3), getUnreadCount(t, srv.URL, token, &users[1]))
+}
+
+func TestMailboxMarkInvalidPayload(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[1])
+
+	resp, err := authRequest(t, "POST", url(srv.URL, fmt.Sprintf("/users/%s/mailbox/read", users[1].Username)), token, toPayload(t, model.MessageStatePost{}))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = authRequest(t, "POST", url(srv.URL, fmt.Sprintf("/users/%s/mailbox/read", users[0].Username)), token, toPayload(t, model.MessageStatePost{All: true}))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
@@ -0,0 +1,275 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aorticweb/msg-app/app/config"
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/events"
+	api "github.com/aorticweb/msg-app/app/handlers"
+	"github.com/aorticweb/msg-app/app/model"
+	"github.com/aorticweb/msg-app/app/storage"
+	"github.com/stretchr/testify/require"
+)
+
+type streamEvent struct {
+	ID    int64
+	Kind  string
+	Event model.MailboxEvent
+}
+
+// openStream ... events read from the mailbox stream of user, the stream ends with the test
+func openStream(t *testing.T, srvURL string, token string, user *crud.User, lastID string) (*http.Response, <-chan streamEvent) {
+	req, err := http.NewRequest("GET", url(srvURL, fmt.Sprintf("/users/%s/mailbox/stream", user.Username)), nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	received := make(chan streamEvent, 16)
+	if resp.StatusCode != http.StatusOK {
+		close(received)
+		return resp, received
+	}
+	go func() {
+		defer close(received)
+		scanner := bufio.NewScanner(resp.Body)
+		var event streamEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				event.ID, _ = strconv.ParseInt(strings.TrimPrefix(line, "id: "), 10, 64)
+			case strings.HasPrefix(line, "event: "):
+				event.Kind = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.Event)
+			case line == "" && event.Kind != "":
+				received <- event
+				event = streamEvent{}
+			}
+		}
+	}()
+	return resp, received
+}
+
+func nextStreamEvent(t *testing.T, received <-chan streamEvent) streamEvent {
+	select {
+	case event, ok := <-received:
+		require.True(t, ok, "stream closed")
+		return event
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no event received")
+	}
+	return streamEvent{}
+}
+
+func TestMailboxStreamEvents(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[1])
+
+	resp, received := openStream(t, srv.URL, token, &users[1], "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	resp = postMessage(t, srv.URL, authToken(t, db, &users[0]), messageUserSuccess(t, &users[0], &users[1]))
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var sent model.Message
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&sent))
+	event := nextStreamEvent(t, received)
+	require.Equal(t, "message", event.Kind)
+	require.NotZero(t, event.ID)
+	require.Equal(t, event.ID, event.Event.ID)
+	require.Equal(t, sent.ID, event.Event.Message.ID)
+
+	reply := replySuccess(t, srv.URL, authToken(t, db, &users[0]), sent.ID, &users[0], model.ReplyModeAll)
+	event = nextStreamEvent(t, received)
+	require.Equal(t, "reply", event.Kind)
+	require.Equal(t, reply.ID, event.Event.MessageID)
+
+	route := url(srv.URL, fmt.Sprintf("/messages/%d/read", sent.ID))
+	resp, err := authRequest(t, "PUT", route, token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	event = nextStreamEvent(t, received)
+	require.Equal(t, "read", event.Kind)
+	require.Equal(t, sent.ID, event.Event.MessageID)
+
+	resp, err = authRequest(t, "POST", url(srv.URL, fmt.Sprintf("/users/%s/mailbox/unread", users[1].Username)), token, toPayload(t, model.MessageStatePost{All: true}))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	event = nextStreamEvent(t, received)
+	require.Equal(t, "unread", event.Kind)
+	require.Zero(t, event.Event.MessageID)
+
+	resp, err = authRequest(t, "DELETE", url(srv.URL, fmt.Sprintf("/messages/%d", sent.ID)), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	event = nextStreamEvent(t, received)
+	require.Equal(t, "delete", event.Kind)
+	require.Equal(t, sent.ID, event.Event.MessageID)
+}
+
+func TestMailboxStreamResume(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[1])
+	senderToken := authToken(t, db, &users[0])
+
+	var sent []model.Message
+	for i := 0; i < 3; i++ {
+		resp := postMessage(t, srv.URL, senderToken, messageUserSuccess(t, &users[0], &users[1]))
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+		var data model.Message
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&data))
+		sent = append(sent, data)
+	}
+	stored, err := crud.GetMailboxEvents(db, users[1].ID, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, stored, 3)
+
+	// the events following Last-Event-ID are replayed, in order
+	resp, received := openStream(t, srv.URL, token, &users[1], strconv.FormatInt(stored[0].ID, 10))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, sent[1].ID, nextStreamEvent(t, received).Event.MessageID)
+	require.Equal(t, sent[2].ID, nextStreamEvent(t, received).Event.MessageID)
+
+	resp = postMessage(t, srv.URL, senderToken, messageUserSuccess(t, &users[0], &users[1]))
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	event := nextStreamEvent(t, received)
+	require.Equal(t, "message", event.Kind)
+	require.Greater(t, event.ID, stored[2].ID)
+}
+
+func TestMailboxStreamAuth(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[0])
+
+	resp, _ := openStream(t, srv.URL, "not-a-token", &users[0], "")
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp, _ = openStream(t, srv.URL, token, &users[1], "")
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp, _ = openStream(t, srv.URL, token, &users[0], "yesterday")
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// EventSource cannot set headers
+	route := url(srv.URL, fmt.Sprintf("/users/%s/mailbox/stream?access_token=%s", users[0].Username, token))
+	resp, err := http.Get(route)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestMailboxStreamOutlivesWriteTimeout(t *testing.T) {
+	db := testDB(t)
+	defer clean(t, db, nil)
+	users := createUsers(t, db)
+	blobs, err := storage.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	srv := httptest.NewUnstartedServer(api.NewAPI(db, log.New(os.Stdout, "msg-app: ", log.LstdFlags), config.Default(), blobs, events.NewMemoryBus()))
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, received := openStream(t, srv.URL, authToken(t, db, &users[1]), &users[1], "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	time.Sleep(300 * time.Millisecond)
+
+	resp = postMessage(t, srv.URL, authToken(t, db, &users[0]), messageUserSuccess(t, &users[0], &users[1]))
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	require.Equal(t, "message", nextStreamEvent(t, received).Kind)
+}
+
+func TestMailboxStreamOutOfOrder(t *testing.T) {
+	db := testDB(t)
+	defer clean(t, db, nil)
+	users := createUsers(t, db)
+	blobs, err := storage.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	bus := events.NewMemoryBus()
+	srv := httptest.NewServer(api.NewAPI(db, log.New(os.Stdout, "msg-app: ", log.LstdFlags), config.Default(), blobs, bus))
+	defer srv.Close()
+	token := authToken(t, db, &users[1])
+	senderToken := authToken(t, db, &users[0])
+
+	for i := 0; i < 3; i++ {
+		resp := postMessage(t, srv.URL, senderToken, messageUserSuccess(t, &users[0], &users[1]))
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	}
+	stored, err := crud.GetMailboxEvents(db, users[1].ID, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, stored, 3)
+	live := func(dbEvent crud.MailboxEvent) events.Event {
+		return events.Event{ID: dbEvent.ID, UserID: dbEvent.UserID, Kind: dbEvent.Kind, MessageID: *dbEvent.MessageID}
+	}
+
+	// events published out of order are all pushed
+	resp, received := openStream(t, srv.URL, token, &users[1], "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, bus.Publish(context.Background(), live(stored[2]), live(stored[1])))
+	require.Equal(t, stored[2].ID, nextStreamEvent(t, received).ID)
+	require.Equal(t, stored[1].ID, nextStreamEvent(t, received).ID)
+
+	// the events up to the last one replayed are not pushed again
+	resp, received = openStream(t, srv.URL, token, &users[1], strconv.FormatInt(stored[0].ID, 10))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, stored[1].ID, nextStreamEvent(t, received).ID)
+	require.Equal(t, stored[2].ID, nextStreamEvent(t, received).ID)
+	require.NoError(t, bus.Publish(context.Background(), live(stored[2]), live(stored[1])))
+	resp = postMessage(t, srv.URL, senderToken, messageUserSuccess(t, &users[0], &users[1]))
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	require.Greater(t, nextStreamEvent(t, received).ID, stored[2].ID)
+}
+
+func TestMailboxStreamReplayUnreadable(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	token := authToken(t, db, &users[2])
+
+	resp := postMessage(t, srv.URL, authToken(t, db, &users[1]), messageUserSuccess(t, &users[1], &users[2]))
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	resp = postMessage(t, srv.URL, authToken(t, db, &users[0]), messageGroupSuccess(t, &users[0], group))
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	resp = postMessage(t, srv.URL, authToken(t, db, &users[1]), messageUserSuccess(t, &users[1], &users[2]))
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var direct model.Message
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&direct))
+	stored, err := crud.GetMailboxEvents(db, users[2].ID, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, stored, 3)
+
+	// the group message is no longer readable once its reader left the group, it is not replayed
+	removed, err := crud.RemoveGroupMember(db, group.ID, users[2].ID)
+	require.NoError(t, err)
+	require.True(t, removed)
+	resp, received := openStream(t, srv.URL, token, &users[2], strconv.FormatInt(stored[0].ID, 10))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	event := nextStreamEvent(t, received)
+	require.Equal(t, stored[2].ID, event.ID)
+	require.Equal(t, direct.ID, event.Event.MessageID)
+}
@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/aorticweb/msg-app/app/model"
+	"github.com/stretchr/testify/require"
+)
+
+func getThread(t *testing.T, srvURL string, token string, id int64, query string) *model.Thread {
+	resp, err := authRequest(t, "GET", url(srvURL, fmt.Sprintf("/messages/%d/thread%s", id, query)), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var data model.Thread
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	require.NoError(t, err)
+	return &data
+}
+
+func TestThreadIDInheritedByReplies(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	root := createDirectMessage(t, db, &users[0], &users[1], nil)
+	reply := createDirectMessage(t, db, &users[1], &users[0], &root.ID)
+	nested := createDirectMessage(t, db, &users[0], &users[1], &reply.ID)
+
+	require.NotNil(t, root.ThreadID)
+	require.Equal(t, root.ID, *root.ThreadID)
+	require.Equal(t, root.ID, *reply.ThreadID)
+	require.Equal(t, root.ID, *nested.ThreadID)
+}
+
+func TestGetThreadTree(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	root := createGroupMessage(t, db, &users[0], group, nil)
+	first := createGroupMessage(t, db, &users[1], group, &root.ID)
+	second := createGroupMessage(t, db, &users[2], group, &root.ID)
+	nested := createGroupMessage(t, db, &users[0], group, &first.ID)
+
+	thread := getThread(t, srv.URL, authToken(t, db, &users[1]), root.ID, "")
+	require.Len(t, thread.Messages, 1)
+	require.Equal(t, root.ID, thread.Messages[0].ID)
+	replies := thread.Messages[0].Replies
+	require.Len(t, replies, 2)
+	require.Equal(t, first.ID, replies[0].ID)
+	require.Equal(t, second.ID, replies[1].ID)
+	require.Len(t, replies[0].Replies, 1)
+	require.Equal(t, nested.ID, replies[0].Replies[0].ID)
+	require.Equal(t, 2, replies[0].Replies[0].Depth)
+}
+
+func TestGetThreadFlatMaxDepth(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	root := createDirectMessage(t, db, &users[0], &users[1], nil)
+	reply := createDirectMessage(t, db, &users[1], &users[0], &root.ID)
+	createDirectMessage(t, db, &users[0], &users[1], &reply.ID)
+
+	token := authToken(t, db, &users[0])
+	thread := getThread(t, srv.URL, token, root.ID, "?format=flat")
+	require.Len(t, thread.Messages, 3)
+	for i, msg := range thread.Messages {
+		require.Equal(t, i, msg.Depth)
+		require.Empty(t, msg.Replies)
+	}
+
+	thread = getThread(t, srv.URL, token, root.ID, "?format=flat&max_depth=1")
+	require.Len(t, thread.Messages, 2)
+	require.Equal(t, reply.ID, thread.Messages[1].ID)
+	require.Equal(t, root.ID, *thread.Messages[1].RE)
+}
+
+func TestGetThreadFromReply(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	root := createGroupMessage(t, db, &users[0], group, nil)
+	first := createGroupMessage(t, db, &users[1], group, &root.ID)
+	second := createGroupMessage(t, db, &users[2], group, &root.ID)
+	nested := createGroupMessage(t, db, &users[0], group, &first.ID)
+
+	// asking for a reply in the middle of the thread gets the whole thread
+	thread := getThread(t, srv.URL, authToken(t, db, &users[2]), nested.ID, "?format=flat")
+	ids := []int64{}
+	for _, msg := range thread.Messages {
+		ids = append(ids, msg.ID)
+	}
+	require.Equal(t, []int64{root.ID, first.ID, second.ID, nested.ID}, ids)
+	require.Equal(t, 0, thread.Messages[0].Depth)
+	require.Equal(t, 2, thread.Messages[3].Depth)
+}
+
+func TestGetThreadHidesPrivateReplies(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	root := createGroupMessage(t, db, &users[0], group, nil)
+	// a direct reply to the group message stays between its sender and recipient
+	private := createDirectMessage(t, db, &users[1], &users[0], &root.ID)
+	createDirectMessage(t, db, &users[0], &users[1], &private.ID)
+
+	thread := getThread(t, srv.URL, authToken(t, db, &users[2]), root.ID, "?format=flat")
+	require.Len(t, thread.Messages, 1)
+	require.Equal(t, root.ID, thread.Messages[0].ID)
+
+	thread = getThread(t, srv.URL, authToken(t, db, &users[1]), root.ID, "?format=flat")
+	require.Len(t, thread.Messages, 3)
+}
+
+func TestGetThreadInvalidQuery(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	root := createDirectMessage(t, db, &users[0], &users[1], nil)
+
+	token := authToken(t, db, &users[0])
+	for _, query := range []string{"?format=graph", "?max_depth=-1", "?max_depth=deep"} {
+		resp, err := authRequest(t, "GET", url(srv.URL, fmt.Sprintf("/messages/%d/thread%s", root.ID, query)), token, nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+	}
+}
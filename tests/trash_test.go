@@ -0,0 +1,169 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/model"
+	"github.com/stretchr/testify/require"
+)
+
+func deleteMessage(t *testing.T, srvURL string, token string, msg *crud.Message, scope string) int {
+	resp, err := authRequest(t, "DELETE", url(srvURL, fmt.Sprintf("/messages/%d?scope=%s", msg.ID, scope)), token, nil)
+	require.NoError(t, err)
+	return resp.StatusCode
+}
+
+func restoreMessage(t *testing.T, srvURL string, token string, msg *crud.Message) int {
+	resp, err := authRequest(t, "POST", url(srvURL, fmt.Sprintf("/messages/%d/restore", msg.ID)), token, nil)
+	require.NoError(t, err)
+	return resp.StatusCode
+}
+
+func getMessage(t *testing.T, srvURL string, token string, id int64) *model.Message {
+	resp, err := authRequest(t, "GET", url(srvURL, fmt.Sprintf("/messages/%d", id)), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var data model.Message
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	require.NoError(t, err)
+	return &data
+}
+
+func getTrashIDs(t *testing.T, srvURL string, token string, user *crud.User) []int64 {
+	resp, err := authRequest(t, "GET", url(srvURL, fmt.Sprintf("/users/%s/trash", user.Username)), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var data model.MessagePage
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	require.NoError(t, err)
+	ids := []int64{}
+	for _, msg := range data.Messages {
+		require.NotNil(t, msg.TrashedAt)
+		ids = append(ids, msg.ID)
+	}
+	return ids
+}
+
+func TestMessageDeleteMovesToTrash(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	msg := createGroupMessage(t, db, &users[0], group, nil)
+	token := authToken(t, db, &users[1])
+
+	require.Equal(t, http.StatusNoContent, deleteMessage(t, srv.URL, token, msg, "me"))
+	require.Empty(t, getMailboxIDs(t, srv.URL, token, &users[1], ""))
+	require.Equal(t, []int64{msg.ID}, getTrashIDs(t, srv.URL, token, &users[1]))
+	require.Equal(t, int64(0), getUnreadCount(t, srv.URL, token, &users[1]))
+	// the other members keep the message
+	require.Equal(t, []int64{msg.ID}, getMailboxIDs(t, srv.URL, authToken(t, db, &users[2]), &users[2], ""))
+
+	require.Equal(t, http.StatusNoContent, restoreMessage(t, srv.URL, token, msg))
+	require.Equal(t, []int64{msg.ID}, getMailboxIDs(t, srv.URL, token, &users[1], ""))
+	require.Empty(t, getTrashIDs(t, srv.URL, token, &users[1]))
+	require.Equal(t, http.StatusNotFound, restoreMessage(t, srv.URL, token, msg))
+}
+
+func TestMessageDeleteNotVisible(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	msg := createDirectMessage(t, db, &users[0], &users[1], nil)
+
+	require.Equal(t, http.StatusNotFound, deleteMessage(t, srv.URL, authToken(t, db, &users[2]), msg, "me"))
+	require.Equal(t, http.StatusBadRequest, deleteMessage(t, srv.URL, authToken(t, db, &users[0]), msg, "all"))
+}
+
+func TestMessageDeleteForEveryone(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	msg := createDirectMessage(t, db, &users[0], &users[1], nil)
+	reply := createDirectMessage(t, db, &users[1], &users[0], &msg.ID)
+	recipientToken := authToken(t, db, &users[1])
+
+	require.Equal(t, http.StatusForbidden, deleteMessage(t, srv.URL, recipientToken, msg, "everyone"))
+	require.Equal(t, http.StatusNoContent, deleteMessage(t, srv.URL, authToken(t, db, &users[0]), msg, "everyone"))
+	require.Equal(t, []int64{}, getMailboxIDs(t, srv.URL, recipientToken, &users[1], ""))
+
+	// the reply still points at a tombstone
+	data := getMessage(t, srv.URL, recipientToken, reply.ID)
+	require.Equal(t, msg.ID, *data.RE)
+	tombstone := getMessage(t, srv.URL, recipientToken, msg.ID)
+	require.True(t, tombstone.Deleted)
+	require.Empty(t, tombstone.Subject)
+	require.Empty(t, tombstone.Body)
+
+	resp, err := authRequest(t, "POST", url(srv.URL, fmt.Sprintf("/messages/%d/replies", msg.ID)), recipientToken, toPayload(t, messageReplySuccess(t, &users[1])))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusGone, resp.StatusCode)
+	require.Equal(t, http.StatusGone, deleteMessage(t, srv.URL, authToken(t, db, &users[0]), msg, "everyone"))
+}
+
+func TestMessageEditRacingDeleteForEveryone(t *testing.T) {
+	db := testDB(t)
+	defer clean(t, db, nil)
+	users := createUsers(t, db)
+	msg := createDirectMessage(t, db, &users[0], &users[1], nil)
+
+	// the edit was authorized before the deletion went through
+	require.NoError(t, crud.DeleteMessageForEveryone(db, msg.ID))
+	body := "edited"
+	require.ErrorIs(t, crud.EditMessage(db, msg, nil, &body), crud.ErrMessageDeleted)
+
+	var stored crud.Message
+	require.NoError(t, db.Where("message.id = ?", msg.ID).First(&stored).Error)
+	require.NotNil(t, stored.DeletedAt)
+	require.NotEqual(t, body, stored.Body)
+	require.Nil(t, stored.EditedAt)
+	revisions, err := crud.GetMessageRevisions(db, msg.ID)
+	require.NoError(t, err)
+	require.Empty(t, revisions)
+}
+
+func TestMessageDeleteForEveryoneWindowExpired(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	msg := createDirectMessage(t, db, &users[0], &users[1], nil)
+	err := db.Model(msg).Update("sent_at", time.Now().UTC().Add(-2*time.Hour)).Error
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusForbidden, deleteMessage(t, srv.URL, authToken(t, db, &users[0]), msg, "everyone"))
+}
+
+func TestPurgeTrash(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	trashed := createDirectMessage(t, db, &users[0], &users[1], nil)
+	deleted := createDirectMessage(t, db, &users[0], &users[1], nil)
+	token := authToken(t, db, &users[1])
+	require.Equal(t, http.StatusNoContent, deleteMessage(t, srv.URL, token, trashed, "me"))
+	require.Equal(t, http.StatusNoContent, deleteMessage(t, srv.URL, authToken(t, db, &users[0]), deleted, "everyone"))
+
+	purged, err := crud.PurgeTrash(db, time.Now().UTC().Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, int64(2), purged)
+
+	require.Empty(t, getTrashIDs(t, srv.URL, token, &users[1]))
+	require.Equal(t, http.StatusNotFound, restoreMessage(t, srv.URL, token, trashed))
+	// the sender copy of a message trashed by its recipient is left untouched
+	require.Equal(t, trashed.Subject, getMessage(t, srv.URL, authToken(t, db, &users[0]), trashed.ID).Subject)
+	dbMessage, exist, err := crud.GetMessage(db, deleted.ID)
+	require.NoError(t, err)
+	require.True(t, exist)
+	require.Empty(t, dbMessage.Body)
+	require.NotNil(t, dbMessage.PurgedAt)
+}
@@ -6,15 +6,23 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/model"
 	"github.com/stretchr/testify/require"
 )
 
 var user crud.User = crud.User{Username: "Bobby"}
+var password string = "correct horse battery staple"
 
 func userSuccessPayload(t *testing.T) io.Reader {
+	jsonStr := []byte(fmt.Sprintf(`{"username": "%s", "password": "%s"}`, user.Username, password))
+	return bytes.NewBuffer(jsonStr)
+}
+
+func userMissingPasswordPayload(t *testing.T) io.Reader {
 	jsonStr := []byte(fmt.Sprintf(`{"username": "%s"}`, user.Username))
 	return bytes.NewBuffer(jsonStr)
 }
@@ -82,3 +90,36 @@ func TestUserPostInvalidPayload(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
 }
+
+func TestUserPostFailsMissingPassword(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+
+	resp, err := http.Post(url(srv.URL, "/users"), "application/json", userMissingPasswordPayload(t))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestUserPostFailsLongPassword(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+
+	payload := toPayload(t, model.UserPost{Username: user.Username, Password: strings.Repeat("a", 73)})
+	resp, err := http.Post(url(srv.URL, "/users"), "application/json", payload)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestUserPostFailsLongMultibytePassword(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+
+	// 72 characters but 144 bytes, bcrypt would only use the first half
+	payload := toPayload(t, model.UserPost{Username: user.Username, Password: strings.Repeat("é", 72)})
+	resp, err := http.Post(url(srv.URL, "/users"), "application/json", payload)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,395 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aorticweb/msg-app/app/config"
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/model"
+	"github.com/aorticweb/msg-app/app/webhooks"
+	"github.com/stretchr/testify/require"
+)
+
+// testWebhookClient ... the receivers of the tests listen on loopback
+var testWebhookClient = webhooks.NewClient(time.Second, true)
+
+// webhookConfig ... lets webhooks target the loopback receivers of the tests
+func webhookConfig() config.Config {
+	cfg := config.Default()
+	cfg.WebhookAllowPrivate = true
+	return cfg
+}
+
+type receivedWebhook struct {
+	header  http.Header
+	body    []byte
+	payload model.WebhookPayload
+}
+
+// webhookReceiver ... records what it receives and answers with the status codes of statuses in turn,
+// then 200
+func webhookReceiver(t *testing.T, statuses ...int) (*httptest.Server, *[]receivedWebhook) {
+	received := []receivedWebhook{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		hook := receivedWebhook{header: r.Header, body: body}
+		require.NoError(t, json.Unmarshal(body, &hook.payload))
+		received = append(received, hook)
+		if len(statuses) > 0 {
+			w.WriteHeader(statuses[0])
+			statuses = statuses[1:]
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &received
+}
+
+func createWebhook(t *testing.T, srvURL string, token string, webhook model.WebhookPost) *http.Response {
+	resp, err := authRequest(t, "POST", url(srvURL, "/webhooks"), token, toPayload(t, webhook))
+	require.NoError(t, err)
+	return resp
+}
+
+func webhookSuccess(t *testing.T, srvURL string, token string, webhook model.WebhookPost) *model.Webhook {
+	resp := createWebhook(t, srvURL, token, webhook)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var data model.Webhook
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&data))
+	require.NotEmpty(t, data.Secret)
+	require.True(t, data.Enabled)
+	return &data
+}
+
+func getWebhookDeliveries(t *testing.T, srvURL string, token string, id int64) []model.WebhookDelivery {
+	resp, err := authRequest(t, "GET", url(srvURL, fmt.Sprintf("/webhooks/%d/deliveries", id)), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var data model.WebhookDeliveries
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&data))
+	return data.Deliveries
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	db := testDB(t)
+	srv := testServerWithConfig(t, db, webhookConfig())
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	outsider := createOutsider(t, db)
+	receiver, received := webhookReceiver(t)
+	token := authToken(t, db, &users[1])
+	webhook := webhookSuccess(t, srv.URL, token, model.WebhookPost{URL: receiver.URL, Scope: crud.WebhookScopeUser})
+
+	msg := messageUserSuccess(t, &users[0], &users[1])
+	msg.Bcc = []map[string]string{username(outsider)}
+	resp := postMessage(t, srv.URL, authToken(t, db, &users[0]), msg)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var sent model.Message
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&sent))
+	// messages the owner does not receive are not sent
+	resp = postMessage(t, srv.URL, authToken(t, db, &users[0]), messageUserSuccess(t, &users[0], &users[2]))
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	require.NoError(t, webhooks.DeliverDue(context.Background(), db, testWebhookClient, nil, time.Now().UTC()))
+	require.Len(t, *received, 1)
+	hook := (*received)[0]
+	require.Equal(t, model.WebhookEventMessage, hook.header.Get(webhooks.HeaderEvent))
+	timestamp := hook.header.Get(webhooks.HeaderTimestamp)
+	require.Equal(t, "sha256="+webhooks.Sign(webhook.Secret, timestamp, hook.body), hook.header.Get(webhooks.HeaderSignature))
+	require.Equal(t, webhook.ID, hook.payload.WebhookID)
+	require.Equal(t, sent.ID, hook.payload.Message.ID)
+	require.Equal(t, sent.Subject, hook.payload.Message.Subject)
+	require.Empty(t, hook.payload.Message.Bcc)
+
+	deliveries := getWebhookDeliveries(t, srv.URL, token, webhook.ID)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, crud.WebhookDeliverySucceeded, deliveries[0].Status)
+	require.Equal(t, 1, deliveries[0].Attempts)
+	require.Equal(t, http.StatusOK, *deliveries[0].LastStatusCode)
+
+	// a delivered payload is not sent again
+	require.NoError(t, webhooks.DeliverDue(context.Background(), db, testWebhookClient, nil, time.Now().UTC()))
+	require.Len(t, *received, 1)
+}
+
+func TestWebhookRetry(t *testing.T) {
+	db := testDB(t)
+	srv := testServerWithConfig(t, db, webhookConfig())
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	receiver, received := webhookReceiver(t, http.StatusInternalServerError, http.StatusBadGateway)
+	token := authToken(t, db, &users[1])
+	webhook := webhookSuccess(t, srv.URL, token, model.WebhookPost{URL: receiver.URL, Scope: crud.WebhookScopeUser})
+	resp := postMessage(t, srv.URL, authToken(t, db, &users[0]), messageUserSuccess(t, &users[0], &users[1]))
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	ctx := context.Background()
+
+	before := time.Now().UTC()
+	require.NoError(t, webhooks.DeliverDue(ctx, db, testWebhookClient, nil, before))
+	after := time.Now().UTC()
+	deliveries := getWebhookDeliveries(t, srv.URL, token, webhook.ID)
+	require.Equal(t, crud.WebhookDeliveryPending, deliveries[0].Status)
+	require.Equal(t, http.StatusInternalServerError, *deliveries[0].LastStatusCode)
+	// the response of the receiver is not kept
+	require.Equal(t, "unexpected status 500", deliveries[0].LastError)
+	next := *deliveries[0].NextAttemptAt
+	require.False(t, next.Before(before.Add(webhooks.RetryDelay(1)).Truncate(time.Microsecond)))
+	require.False(t, next.After(after.Add(webhooks.RetryDelay(1))))
+
+	// not due yet
+	require.NoError(t, webhooks.DeliverDue(ctx, db, testWebhookClient, nil, next.Add(-time.Second)))
+	require.Len(t, *received, 1)
+
+	require.NoError(t, webhooks.DeliverDue(ctx, db, testWebhookClient, nil, next))
+	require.Len(t, *received, 2)
+	deliveries = getWebhookDeliveries(t, srv.URL, token, webhook.ID)
+	require.Equal(t, 2, deliveries[0].Attempts)
+	require.True(t, deliveries[0].NextAttemptAt.After(next))
+
+	require.NoError(t, webhooks.DeliverDue(ctx, db, testWebhookClient, nil, *deliveries[0].NextAttemptAt))
+	require.Len(t, *received, 3)
+	deliveries = getWebhookDeliveries(t, srv.URL, token, webhook.ID)
+	require.Equal(t, crud.WebhookDeliverySucceeded, deliveries[0].Status)
+	require.Nil(t, deliveries[0].NextAttemptAt)
+	// every attempt is stamped with the time it is sent and signed again
+	for _, hook := range *received {
+		timestamp, err := strconv.ParseInt(hook.header.Get(webhooks.HeaderTimestamp), 10, 64)
+		require.NoError(t, err)
+		require.WithinDuration(t, time.Now(), time.Unix(timestamp, 0), 5*time.Second)
+		require.Equal(t, "sha256="+webhooks.Sign(webhook.Secret, hook.header.Get(webhooks.HeaderTimestamp), hook.body), hook.header.Get(webhooks.HeaderSignature))
+	}
+	require.Equal(t, (*received)[0].header.Get(webhooks.HeaderDelivery), (*received)[2].header.Get(webhooks.HeaderDelivery))
+}
+
+func TestWebhookDisabledAfterFailures(t *testing.T) {
+	db := testDB(t)
+	srv := testServerWithConfig(t, db, webhookConfig())
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	receiver, received := webhookReceiver(t, http.StatusInternalServerError)
+	token := authToken(t, db, &users[1])
+	webhook := webhookSuccess(t, srv.URL, token, model.WebhookPost{URL: receiver.URL, Scope: crud.WebhookScopeUser})
+	require.NoError(t, db.Model(&crud.Webhook{}).Where("id = ?", webhook.ID).Update("failure_count", webhooks.DisableAfter-1).Error)
+	senderToken := authToken(t, db, &users[0])
+	resp := postMessage(t, srv.URL, senderToken, messageUserSuccess(t, &users[0], &users[1]))
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	now := time.Now().UTC()
+	require.NoError(t, webhooks.DeliverDue(context.Background(), db, testWebhookClient, nil, now))
+	resp, err := authRequest(t, "GET", url(srv.URL, "/webhooks"), token, nil)
+	require.NoError(t, err)
+	var list model.Webhooks
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	require.Len(t, list.Webhooks, 1)
+	require.False(t, list.Webhooks[0].Enabled)
+	require.Empty(t, list.Webhooks[0].Secret)
+
+	// nothing is queued nor sent while disabled
+	resp = postMessage(t, srv.URL, senderToken, messageUserSuccess(t, &users[0], &users[1]))
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	require.Len(t, getWebhookDeliveries(t, srv.URL, token, webhook.ID), 1)
+	require.NoError(t, webhooks.DeliverDue(context.Background(), db, testWebhookClient, nil, now.Add(time.Hour)))
+	require.Len(t, *received, 1)
+
+	// enabling it resumes the pending deliveries
+	resp, err = authRequest(t, "POST", url(srv.URL, fmt.Sprintf("/webhooks/%d/enable", webhook.ID)), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, webhooks.DeliverDue(context.Background(), db, testWebhookClient, nil, now.Add(time.Hour)))
+	require.Len(t, *received, 2)
+	require.Equal(t, crud.WebhookDeliverySucceeded, getWebhookDeliveries(t, srv.URL, token, webhook.ID)[0].Status)
+}
+
+func TestWebhookDeliveryCanceled(t *testing.T) {
+	db := testDB(t)
+	srv := testServerWithConfig(t, db, webhookConfig())
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	receiver, received := webhookReceiver(t)
+	token := authToken(t, db, &users[1])
+	webhook := webhookSuccess(t, srv.URL, token, model.WebhookPost{URL: receiver.URL, Scope: crud.WebhookScopeUser})
+	senderToken := authToken(t, db, &users[0])
+	ids := []int64{}
+	for i := 0; i < 3; i++ {
+		resp := postMessage(t, srv.URL, senderToken, messageUserSuccess(t, &users[0], &users[1]))
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+		var sent model.Message
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&sent))
+		ids = append(ids, sent.ID)
+	}
+	// the payload is rendered when sending, from the message as it is then
+	now := time.Now().UTC()
+	require.NoError(t, db.Model(&crud.Message{}).Where("id = ?", ids[0]).Update("body", "Edited before sending").Error)
+	require.NoError(t, db.Model(&crud.Message{}).Where("id = ?", ids[1]).Update("deleted_at", now).Error)
+	require.NoError(t, db.Model(&crud.Message{}).Where("id = ?", ids[2]).Update("expires_at", now).Error)
+
+	require.NoError(t, webhooks.DeliverDue(context.Background(), db, testWebhookClient, nil, now))
+	require.Len(t, *received, 1)
+	require.Equal(t, ids[0], (*received)[0].payload.Message.ID)
+	require.Equal(t, "Edited before sending", (*received)[0].payload.Message.Body)
+	statuses := map[int64]string{}
+	for _, delivery := range getWebhookDeliveries(t, srv.URL, token, webhook.ID) {
+		statuses[*delivery.MessageID] = delivery.Status
+	}
+	require.Equal(t, map[int64]string{
+		ids[0]: crud.WebhookDeliverySucceeded, ids[1]: crud.WebhookDeliveryCanceled, ids[2]: crud.WebhookDeliveryCanceled,
+	}, statuses)
+
+	// deliveries done leave the log after the retention, pending ones stay
+	resp := postMessage(t, srv.URL, senderToken, messageUserSuccess(t, &users[0], &users[1]))
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	purged, err := crud.PurgeWebhookDeliveries(db, time.Now().UTC().Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, int64(3), purged)
+	deliveries := getWebhookDeliveries(t, srv.URL, token, webhook.ID)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, crud.WebhookDeliveryPending, deliveries[0].Status)
+}
+
+func TestWebhookQueuedWithMessage(t *testing.T) {
+	db := testDB(t)
+	srv := testServerWithConfig(t, db, webhookConfig())
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	receiver, _ := webhookReceiver(t)
+	token := authToken(t, db, &users[1])
+	webhook := webhookSuccess(t, srv.URL, token, model.WebhookPost{URL: receiver.URL, Scope: crud.WebhookScopeUser})
+
+	// creating the message is enough, whoever creates it
+	direct := crud.Message{Sender: &users[0], Recipient: &users[1], Subject: "Owl", Body: "Direct", SentAt: time.Now().UTC()}
+	_, err := crud.CreateMessage(db, &direct)
+	require.NoError(t, err)
+	sendAt := time.Now().UTC().Add(time.Hour)
+	scheduled := crud.Message{Sender: &users[0], Recipient: &users[1], Subject: "Owl", Body: "Later", SentAt: sendAt, SendAt: &sendAt}
+	_, err = crud.CreateMessage(db, &scheduled)
+	require.NoError(t, err)
+	deliveries := getWebhookDeliveries(t, srv.URL, token, webhook.ID)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, direct.ID, *deliveries[0].MessageID)
+
+	// scheduled messages are queued when delivered
+	delivered, err := crud.DeliverScheduledMessages(db, sendAt, 10)
+	require.NoError(t, err)
+	require.Equal(t, []int64{scheduled.ID}, delivered)
+	deliveries = getWebhookDeliveries(t, srv.URL, token, webhook.ID)
+	require.Len(t, deliveries, 2)
+	require.Equal(t, scheduled.ID, *deliveries[0].MessageID)
+}
+
+func TestWebhookScopes(t *testing.T) {
+	db := testDB(t)
+	cfg := webhookConfig()
+	cfg.Admins = []string{usernames[2]}
+	srv := testServerWithConfig(t, db, cfg)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+	outsider := createOutsider(t, db)
+	receiver, received := webhookReceiver(t)
+
+	// group webhooks are restricted to the group managers, global ones to admins
+	resp := createWebhook(t, srv.URL, authToken(t, db, &users[1]), model.WebhookPost{URL: receiver.URL, Scope: crud.WebhookScopeGroup, Groupname: group.Groupname})
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = createWebhook(t, srv.URL, authToken(t, db, &users[0]), model.WebhookPost{URL: receiver.URL, Scope: crud.WebhookScopeGlobal})
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = createWebhook(t, srv.URL, authToken(t, db, &users[0]), model.WebhookPost{URL: receiver.URL, Scope: crud.WebhookScopeGroup})
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = createWebhook(t, srv.URL, authToken(t, db, &users[0]), model.WebhookPost{URL: "ftp://example.com", Scope: crud.WebhookScopeUser})
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	groupHook := webhookSuccess(t, srv.URL, authToken(t, db, &users[0]), model.WebhookPost{URL: receiver.URL, Scope: crud.WebhookScopeGroup, Groupname: group.Groupname})
+	require.Equal(t, group.Groupname, groupHook.Groupname)
+	globalHook := webhookSuccess(t, srv.URL, authToken(t, db, &users[2]), model.WebhookPost{URL: receiver.URL, Scope: crud.WebhookScopeGlobal})
+
+	resp = postMessage(t, srv.URL, authToken(t, db, &users[1]), messageGroupSuccess(t, &users[1], group))
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	resp = postMessage(t, srv.URL, authToken(t, db, &users[1]), messageUserSuccess(t, &users[1], outsider))
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	require.NoError(t, webhooks.DeliverDue(context.Background(), db, testWebhookClient, cfg.Admins, time.Now().UTC()))
+	counts := map[int64]int{}
+	for _, hook := range *received {
+		counts[hook.payload.WebhookID]++
+	}
+	require.Equal(t, map[int64]int{groupHook.ID: 1, globalHook.ID: 2}, counts)
+
+	// a group webhook stops receiving once its owner no longer manages the group, a global one
+	// once its owner is no longer an admin
+	require.NoError(t, crud.TransferGroupOwnership(db, group.ID, users[0].ID, users[1].ID))
+	require.NoError(t, crud.SetGroupMemberRole(db, group.ID, users[0].ID, crud.RoleMember))
+	resp = postMessage(t, srv.URL, authToken(t, db, &users[1]), messageGroupSuccess(t, &users[1], group))
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	require.Len(t, getWebhookDeliveries(t, srv.URL, authToken(t, db, &users[0]), groupHook.ID), 1)
+	require.NoError(t, webhooks.DeliverDue(context.Background(), db, testWebhookClient, nil, time.Now().UTC()))
+	require.Len(t, *received, 3)
+	deliveries := getWebhookDeliveries(t, srv.URL, authToken(t, db, &users[2]), globalHook.ID)
+	require.Len(t, deliveries, 3)
+	require.Equal(t, crud.WebhookDeliveryCanceled, deliveries[0].Status)
+
+	// webhooks are private to their owner
+	route := url(srv.URL, fmt.Sprintf("/webhooks/%d", groupHook.ID))
+	resp, err := authRequest(t, "DELETE", route, authToken(t, db, &users[2]), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, err = authRequest(t, "DELETE", route, authToken(t, db, &users[0]), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	webhooksOwned, err := crud.GetUserWebhooks(db, users[0].ID)
+	require.NoError(t, err)
+	require.Empty(t, webhooksOwned)
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	require.Equal(t, 30*time.Second, webhooks.RetryDelay(1))
+	require.Equal(t, time.Minute, webhooks.RetryDelay(2))
+	require.Equal(t, 4*time.Minute, webhooks.RetryDelay(4))
+	require.Equal(t, 6*time.Hour, webhooks.RetryDelay(50))
+}
+
+func TestWebhookPrivateURL(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[0])
+	for _, target := range []string{"http://127.0.0.1:8080/hook", "http://10.0.0.1/hook", "http://169.254.169.254/latest/meta-data", "http://[::1]/hook", "http://localhost/hook"} {
+		resp := createWebhook(t, srv.URL, token, model.WebhookPost{URL: target, Scope: crud.WebhookScopeUser})
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, target)
+	}
+}
+
+func TestWebhookCheckURL(t *testing.T) {
+	ctx := context.Background()
+	for _, target := range []string{"http://127.0.0.1/", "http://192.168.1.10/", "http://172.16.0.1/", "http://169.254.169.254/", "http://[fe80::1]/", "http://0.0.0.0/"} {
+		require.ErrorIs(t, webhooks.CheckURL(ctx, target), webhooks.ErrForbiddenAddress, target)
+	}
+	require.NoError(t, webhooks.CheckURL(ctx, "https://93.184.216.34/hook"))
+}
+
+func TestWebhookClient(t *testing.T) {
+	redirected := false
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected = true
+	}))
+	defer target.Close()
+	receiver := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusFound))
+	defer receiver.Close()
+
+	// a receiver on a private address is refused when connecting
+	_, err := webhooks.NewClient(time.Second, false).Post(receiver.URL, "application/json", nil)
+	require.ErrorIs(t, err, webhooks.ErrForbiddenAddress)
+
+	// redirects are not followed
+	resp, err := webhooks.NewClient(time.Second, true).Post(receiver.URL, "application/json", nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	require.False(t, redirected)
+}
@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aorticweb/msg-app/app/config"
+	"github.com/aorticweb/msg-app/app/crud"
+	"github.com/aorticweb/msg-app/app/events"
+	api "github.com/aorticweb/msg-app/app/handlers"
+	"github.com/aorticweb/msg-app/app/model"
+	"github.com/aorticweb/msg-app/app/storage"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func dialMailbox(t *testing.T, srvURL string, token string, user *crud.User) (*websocket.Conn, *http.Response, error) {
+	route := strings.Replace(url(srvURL, fmt.Sprintf("/users/%s/mailbox/ws", user.Username)), "http", "ws", 1)
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+	return websocket.DefaultDialer.Dial(route, header)
+}
+
+func readMailboxEvent(t *testing.T, conn *websocket.Conn) model.MailboxEvent {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var event model.MailboxEvent
+	require.NoError(t, conn.ReadJSON(&event))
+	return event
+}
+
+func TestWebSocketPushesMessages(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	group := createGroup(t, db, users)
+
+	conn, _, err := dialMailbox(t, srv.URL, authToken(t, db, &users[1]), &users[1])
+	require.NoError(t, err)
+	defer conn.Close()
+
+	resp := postMessage(t, srv.URL, authToken(t, db, &users[0]), messageGroupSuccess(t, &users[0], group))
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var sent model.Message
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&sent))
+
+	event := readMailboxEvent(t, conn)
+	require.Equal(t, "message", event.Kind)
+	require.Equal(t, sent.ID, event.MessageID)
+	require.Equal(t, sent.Subject, event.Message.Subject)
+	require.True(t, *event.Message.Unread)
+
+	// replies are pushed too
+	reply := replySuccess(t, srv.URL, authToken(t, db, &users[2]), sent.ID, &users[2], model.ReplyModeAll)
+	event = readMailboxEvent(t, conn)
+	require.Equal(t, reply.ID, event.MessageID)
+}
+
+func TestWebSocketHidesBcc(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	outsider := createOutsider(t, db)
+
+	conn, _, err := dialMailbox(t, srv.URL, authToken(t, db, &users[1]), &users[1])
+	require.NoError(t, err)
+	defer conn.Close()
+
+	msg := messageUserSuccess(t, &users[0], &users[1])
+	msg.Bcc = []map[string]string{username(outsider)}
+	resp := postMessage(t, srv.URL, authToken(t, db, &users[0]), msg)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	event := readMailboxEvent(t, conn)
+	require.Empty(t, event.Message.Bcc)
+}
+
+func TestWebSocketAuth(t *testing.T) {
+	db := testDB(t)
+	srv := testServer(t, db)
+	defer clean(t, db, srv)
+	users := createUsers(t, db)
+	token := authToken(t, db, &users[0])
+
+	_, resp, err := dialMailbox(t, srv.URL, "not-a-token", &users[0])
+	require.Error(t, err)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	_, resp, err = dialMailbox(t, srv.URL, token, &users[1])
+	require.Error(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// browsers pass the token in the query string
+	route := strings.Replace(url(srv.URL, fmt.Sprintf("/users/%s/mailbox/ws?access_token=%s", users[0].Username, token)), "http", "ws", 1)
+	conn, _, err := websocket.DefaultDialer.Dial(route, nil)
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestWebSocketShutdown(t *testing.T) {
+	db := testDB(t)
+	defer clean(t, db, nil)
+	users := createUsers(t, db)
+	blobs, err := storage.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	API := api.NewAPI(db, log.New(os.Stdout, "msg-app: ", log.LstdFlags), config.Default(), blobs, events.NewMemoryBus())
+	srv := httptest.NewServer(API)
+	defer srv.Close()
+
+	conn, _, err := dialMailbox(t, srv.URL, authToken(t, db, &users[0]), &users[0])
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, API.Shutdown(ctx))
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, _, err = conn.ReadMessage()
+	require.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway))
+}